@@ -1,7 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/jaibhavaya/gogo-files/pkg/config"
 	"github.com/jaibhavaya/gogo-files/pkg/db"
@@ -14,20 +24,260 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	dbPool, err := db.Connect(cfg.DatabaseURL)
-	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+	// replay only talks to SQS, so it runs without the database or keys
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "rekey":
+			dbPool := connect(cfg)
+			defer dbPool.Close()
+			rekey(dbPool, os.Args[2:])
+		case "replay":
+			replay(*cfg, os.Args[2:])
+		case "jobs":
+			dbPool := connect(cfg)
+			defer dbPool.Close()
+			jobs(dbPool, os.Args[2:])
+		default:
+			log.Fatalf("Unknown command %q", os.Args[1])
+		}
+		return
 	}
+
+	dbPool := connect(cfg)
 	defer dbPool.Close()
 
+	ctx := context.Background()
+
+	encrypted, err := db.EncryptPlaintextRefreshTokens(ctx, dbPool)
+	if err != nil {
+		log.Fatalf("Failed to encrypt stored refresh tokens: %v", err)
+	}
+	if encrypted > 0 {
+		log.Printf("Encrypted %d plaintext refresh tokens", encrypted)
+	}
+
+	pruned, err := db.DeleteProcessedMessagesBefore(ctx, dbPool, time.Now().Add(-cfg.IdempotencyRetentionPeriod()))
+	if err != nil {
+		log.Fatalf("Failed to prune processed messages: %v", err)
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d processed messages older than %s", pruned, cfg.IdempotencyRetention)
+	}
+
+	pruned, err = db.DeleteSyncWorkItemsBefore(ctx, dbPool, time.Now().Add(-cfg.IdempotencyRetentionPeriod()))
+	if err != nil {
+		log.Fatalf("Failed to prune sync work items: %v", err)
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d sync work items older than %s", pruned, cfg.IdempotencyRetention)
+	}
+
 	processor := processor.NewSQSProcessor(
 		*cfg,
 		dbPool,
 	)
 
-	if err := processor.Start(); err != nil {
-		log.Fatalf("Failed to start SQS processor: %v", err)
+	code := serve(processor)
+	dbPool.Close()
+	os.Exit(code)
+}
+
+// connect opens the database pool with the configured encryption keyring.
+func connect(cfg *config.Config) *db.Pool {
+	keys, currentKeyID, err := cfg.EncryptionKeyring()
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
 	}
 
-	select {}
+	keyring, err := db.NewKeyring(keys, currentKeyID)
+	if err != nil {
+		log.Fatalf("Failed to create encryption keyring: %v", err)
+	}
+
+	dbPool, err := db.Connect(cfg.DatabaseURL, keyring)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	dbPool.Timeout = cfg.DBTimeoutDuration()
+
+	return dbPool
+}
+
+// Exit codes of the service.
+const (
+	// exitDrained means the service shut down after every in-flight message
+	// finished.
+	exitDrained = 0
+	// exitFailed means the service couldn't start, stopped unexpectedly or
+	// couldn't close cleanly.
+	exitFailed = 1
+	// exitAbandoned means in-flight messages had to be cancelled on shutdown.
+	// They are redelivered by the queue.
+	exitAbandoned = 2
+)
+
+// serve runs the processor until SIGTERM or SIGINT, then shuts it down and
+// returns the exit code.
+func serve(p *processor.SQSProcessor) int {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	if err := p.Start(); err != nil {
+		log.Printf("Failed to start SQS processor: %v", err)
+		return exitFailed
+	}
+
+	code := exitDrained
+	select {
+	case sig := <-signals:
+		log.Printf("Received %s, shutting down", sig)
+	case err := <-p.Stopped():
+		log.Printf("SQS processor stopped unexpectedly: %v", err)
+		code = exitFailed
+	}
+
+	err := p.Shutdown()
+	switch {
+	case errors.Is(err, processor.ErrAbandoned):
+		log.Printf("Shut down with messages abandoned: %v", err)
+		return exitAbandoned
+	case err != nil:
+		log.Printf("Failed to shut down cleanly: %v", err)
+		return exitFailed
+	}
+
+	if code == exitDrained {
+		log.Println("Shut down cleanly")
+	}
+	return code
+}
+
+// rekey re-encrypts stored refresh tokens under the current encryption key.
+func rekey(dbPool *db.Pool, args []string) {
+	flags := flag.NewFlagSet("rekey", flag.ExitOnError)
+	batchSize := flags.Int("batch-size", 100, "rows to re-encrypt per transaction")
+	_ = flags.Parse(args)
+
+	rekeyed, err := db.RekeyRefreshTokens(context.Background(), dbPool, *batchSize)
+	if err != nil {
+		log.Fatalf("Failed to rekey refresh tokens after %d rows: %v", rekeyed, err)
+	}
+
+	log.Printf("Re-encrypted %d refresh tokens under key %q", rekeyed, dbPool.Keyring.CurrentKeyID())
+}
+
+// replay moves dead-lettered messages back to the topics they came from.
+func replay(cfg config.Config, args []string) {
+	var opts processor.ReplayOptions
+	var since, until string
+	set := payloadFields{}
+
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	flags.Int64Var(&opts.Filter.OwnerID, "owner-id", 0, "only replay messages for this owner")
+	flags.StringVar(&opts.Filter.EventType, "type", "", "only replay messages with this event_type")
+	flags.StringVar(&opts.Filter.ErrorClass, "error-class", "", "only replay messages dead-lettered with this error class")
+	flags.StringVar(&since, "since", "", "only replay messages first received at or after this RFC 3339 time")
+	flags.StringVar(&until, "until", "", "only replay messages first received at or before this RFC 3339 time")
+	flags.Var(set, "set", "overwrite a payload field, as field=value; may be repeated")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "count matching messages without replaying them")
+	_ = flags.Parse(args)
+
+	var err error
+	if opts.Filter.Since, err = parseTimeFlag(since); err != nil {
+		log.Fatalf("Invalid -since: %v", err)
+	}
+	if opts.Filter.Until, err = parseTimeFlag(until); err != nil {
+		log.Fatalf("Invalid -until: %v", err)
+	}
+	opts.Set = set
+
+	result, err := processor.Replay(context.Background(), cfg, opts)
+	if err != nil {
+		log.Fatalf("Failed to replay dead letters after %d messages: %v", result.Replayed, err)
+	}
+
+	if opts.DryRun {
+		log.Printf("Would replay %d of %d dead-lettered messages", result.Replayed, result.Scanned)
+		return
+	}
+	log.Printf("Replayed %d of %d dead-lettered messages", result.Replayed, result.Scanned)
+}
+
+// jobs prints sync jobs as JSON: the job with -job-id, or the most recently
+// started jobs of an owner or user.
+func jobs(dbPool *db.Pool, args []string) {
+	var jobID string
+	var filter db.SyncJobFilter
+
+	flags := flag.NewFlagSet("jobs", flag.ExitOnError)
+	flags.StringVar(&jobID, "job-id", "", "print the job with this ID")
+	flags.Int64Var(&filter.OwnerID, "owner-id", 0, "only print jobs for this owner")
+	flags.StringVar(&filter.UserID, "user-id", "", "only print jobs for this user")
+	limit := flags.Int("limit", 20, "how many jobs to print")
+	_ = flags.Parse(args)
+
+	var found []*db.SyncJob
+	if jobID != "" {
+		job, err := db.GetSyncJob(context.Background(), dbPool, jobID)
+		if err != nil {
+			log.Fatalf("Failed to get sync job: %v", err)
+		}
+		if job == nil {
+			log.Fatalf("No sync job %q", jobID)
+		}
+		found = append(found, job)
+	} else {
+		var err error
+		found, err = db.ListSyncJobs(context.Background(), dbPool, filter, *limit)
+		if err != nil {
+			log.Fatalf("Failed to list sync jobs: %v", err)
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	for _, job := range found {
+		if err := encoder.Encode(job); err != nil {
+			log.Fatalf("Failed to print sync job: %v", err)
+		}
+	}
+}
+
+func parseTimeFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// payloadFields collects -set flags. Values are used as JSON when they parse
+// as JSON, and as strings otherwise.
+type payloadFields map[string]json.RawMessage
+
+func (f payloadFields) String() string {
+	fields := make([]string, 0, len(f))
+	for field, value := range f {
+		fields = append(fields, field+"="+string(value))
+	}
+	return strings.Join(fields, ",")
+}
+
+func (f payloadFields) Set(value string) error {
+	field, raw, ok := strings.Cut(value, "=")
+	if !ok || field == "" {
+		return fmt.Errorf("expected field=value, got %q", value)
+	}
+
+	if json.Valid([]byte(raw)) {
+		f[field] = json.RawMessage(raw)
+		return nil
+	}
+
+	quoted, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	f[field] = quoted
+	return nil
 }
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS upload_sessions (
+    id SERIAL PRIMARY KEY,
+    owner_id BIGINT NOT NULL,
+    s3_bucket TEXT NOT NULL,
+    s3_key TEXT NOT NULL,
+    destination TEXT NOT NULL,
+    upload_url TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    bytes_committed BIGINT NOT NULL DEFAULT 0,
+    s3_etag TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_upload_sessions_owner_key_destination
+ON upload_sessions(owner_id, s3_bucket, s3_key, destination);
+
+CREATE TRIGGER set_timestamp
+BEFORE UPDATE ON upload_sessions
+FOR EACH ROW
+EXECUTE FUNCTION trigger_set_timestamp();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS set_timestamp ON upload_sessions;
+
+DROP INDEX IF EXISTS idx_upload_sessions_owner_key_destination;
+
+DROP TABLE IF EXISTS upload_sessions;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE onedrive_integrations
+ADD COLUMN token_refreshed_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE onedrive_integrations
+DROP COLUMN IF EXISTS token_refreshed_at;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE onedrive_integrations
+ADD COLUMN encryption_key_id TEXT;
+
+-- Tokens encrypted so far were written with ENCRYPTION_KEY, which the keyring
+-- knows as "default".
+UPDATE onedrive_integrations
+SET encryption_key_id = 'default'
+WHERE refresh_token LIKE 'enc:v1:%';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE onedrive_integrations
+DROP COLUMN IF EXISTS encryption_key_id;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS processed_messages (
+    idempotency_key TEXT PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    result JSONB NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_processed_messages_processed_at
+ON processed_messages(processed_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_processed_messages_processed_at;
+
+DROP TABLE IF EXISTS processed_messages;
+-- +goose StatementEnd
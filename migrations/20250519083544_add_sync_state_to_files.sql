@@ -0,0 +1,69 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Rows written before this migration have no object or destination to
+-- backfill from, so these columns are nullable. The check, added NOT VALID,
+-- requires them on every row written from now on without scanning the
+-- existing ones; those rows are never matched by the sync state lookup.
+ALTER TABLE files
+ADD COLUMN owner_id BIGINT,
+ADD COLUMN s3_bucket TEXT,
+ADD COLUMN s3_key TEXT,
+ADD COLUMN s3_version_id TEXT,
+ADD COLUMN s3_etag TEXT,
+ADD COLUMN drive_id TEXT,
+ADD COLUMN onedrive_item_id TEXT,
+ADD COLUMN destination TEXT,
+ADD COLUMN status TEXT NOT NULL DEFAULT 'pending'
+    CHECK (status IN ('pending', 'uploading', 'synced', 'failed')),
+ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN last_error TEXT,
+ADD COLUMN synced_at TIMESTAMPTZ,
+ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+ALTER TABLE files
+ADD CONSTRAINT files_sync_state_present CHECK (
+    owner_id IS NOT NULL
+    AND s3_bucket IS NOT NULL
+    AND s3_key IS NOT NULL
+    AND drive_id IS NOT NULL
+    AND destination IS NOT NULL
+) NOT VALID;
+
+CREATE UNIQUE INDEX idx_files_owner_key_destination
+ON files(owner_id, s3_bucket, s3_key, destination);
+
+CREATE INDEX idx_files_owner_status
+ON files(owner_id, status);
+
+CREATE TRIGGER set_timestamp
+BEFORE UPDATE ON files
+FOR EACH ROW
+EXECUTE FUNCTION trigger_set_timestamp();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS set_timestamp ON files;
+
+DROP INDEX IF EXISTS idx_files_owner_status;
+
+DROP INDEX IF EXISTS idx_files_owner_key_destination;
+
+ALTER TABLE files
+DROP CONSTRAINT IF EXISTS files_sync_state_present;
+
+ALTER TABLE files
+DROP COLUMN IF EXISTS owner_id,
+DROP COLUMN IF EXISTS s3_bucket,
+DROP COLUMN IF EXISTS s3_key,
+DROP COLUMN IF EXISTS s3_version_id,
+DROP COLUMN IF EXISTS s3_etag,
+DROP COLUMN IF EXISTS drive_id,
+DROP COLUMN IF EXISTS onedrive_item_id,
+DROP COLUMN IF EXISTS destination,
+DROP COLUMN IF EXISTS status,
+DROP COLUMN IF EXISTS attempts,
+DROP COLUMN IF EXISTS last_error,
+DROP COLUMN IF EXISTS synced_at,
+DROP COLUMN IF EXISTS updated_at;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files
+ADD COLUMN s3_size BIGINT,
+ADD COLUMN s3_last_modified TIMESTAMPTZ,
+ADD COLUMN onedrive_ctag TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE files
+DROP COLUMN IF EXISTS s3_size,
+DROP COLUMN IF EXISTS s3_last_modified,
+DROP COLUMN IF EXISTS onedrive_ctag;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- NULL keeps the default of replacing whatever is at the destination.
+ALTER TABLE onedrive_integrations
+ADD COLUMN conflict_behavior TEXT
+    CHECK (conflict_behavior IN ('replace', 'rename', 'fail', 'keep-newer'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE onedrive_integrations
+DROP COLUMN IF EXISTS conflict_behavior;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Filled in from Graph's /me/drive the next time each owner authorizes.
+ALTER TABLE onedrive_integrations
+ADD COLUMN drive_id TEXT,
+ADD COLUMN drive_type TEXT,
+ADD COLUMN quota_total BIGINT,
+ADD COLUMN quota_used BIGINT,
+ADD COLUMN quota_remaining BIGINT,
+ADD COLUMN drive_updated_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE onedrive_integrations
+DROP COLUMN IF EXISTS drive_id,
+DROP COLUMN IF EXISTS drive_type,
+DROP COLUMN IF EXISTS quota_total,
+DROP COLUMN IF EXISTS quota_used,
+DROP COLUMN IF EXISTS quota_remaining,
+DROP COLUMN IF EXISTS drive_updated_at;
+-- +goose StatementEnd
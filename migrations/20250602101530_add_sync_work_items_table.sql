@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS sync_work_items (
+    job_id TEXT NOT NULL,
+    item_index INTEGER NOT NULL,
+    owner_id BIGINT NOT NULL,
+    s3_key TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    result JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (job_id, item_index)
+);
+
+CREATE INDEX idx_sync_work_items_updated_at
+ON sync_work_items(updated_at);
+
+CREATE TRIGGER set_timestamp
+BEFORE UPDATE ON sync_work_items
+FOR EACH ROW
+EXECUTE FUNCTION trigger_set_timestamp();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS set_timestamp ON sync_work_items;
+
+DROP INDEX IF EXISTS idx_sync_work_items_updated_at;
+
+DROP TABLE IF EXISTS sync_work_items;
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS sync_jobs (
+    id TEXT PRIMARY KEY,
+    owner_id BIGINT NOT NULL,
+    user_id TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running',
+    total_items INTEGER NOT NULL,
+    succeeded INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    bytes_transferred BIGINT NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    last_error TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_sync_jobs_owner_id_started_at
+ON sync_jobs(owner_id, started_at DESC);
+
+CREATE INDEX idx_sync_jobs_user_id_started_at
+ON sync_jobs(user_id, started_at DESC);
+
+CREATE TRIGGER set_timestamp
+BEFORE UPDATE ON sync_jobs
+FOR EACH ROW
+EXECUTE FUNCTION trigger_set_timestamp();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS set_timestamp ON sync_jobs;
+
+DROP INDEX IF EXISTS idx_sync_jobs_user_id_started_at;
+
+DROP INDEX IF EXISTS idx_sync_jobs_owner_id_started_at;
+
+DROP TABLE IF EXISTS sync_jobs;
+-- +goose StatementEnd
@@ -3,23 +3,49 @@ package config
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
+// DefaultEncryptionKey is the ENCRYPTION_KEY used when none is set. It is only
+// accepted in the development environment.
+const DefaultEncryptionKey = "default-dev-key-please-change-in-production"
+
+// DefaultEncryptionKeyID is the ID given to ENCRYPTION_KEY when no keyring is
+// configured. Tokens encrypted before key IDs were recorded belong to it, and
+// migration 20250512093027 backfilled it into existing rows, so it must not
+// change.
+const DefaultEncryptionKeyID = "default"
+
+const developmentEnvironment = "development"
+
 type Config struct {
-	DatabaseURL          string `env:"DATABASE_URL" required:"true"`
-	QueueURL             string `env:"QUEUE_URL" required:"true"`
-	AWSRegion            string `env:"AWS_REGION" default:"us-west-1"`
-	AWSAccessKey         string `env:"AWS_ACCESS_KEY" default:"test"`
-	AWSSecretKey         string `env:"AWS_SECRET_KEY" default:"test"`
-	S3Bucket             string `env:"S3_BUCKET" required:"true"`
-	S3Endpoint           string `env:"S3_ENDPOINT"`
-	Environment          string `env:"ENVIRONMENT" default:"development"`
-	EncryptionKey        string `env:"ENCRYPTION_KEY" default:"default-dev-key-please-change-in-production"`
-	OnedriveClientID     string `env:"ONEDRIVE_CLIENT_ID" default:"your-client-id"`
-	OnedriveClientSecret string `env:"ONEDRIVE_CLIENT_SECRET" default:"your-client-secret"`
+	DatabaseURL            string `env:"DATABASE_URL" required:"true"`
+	QueueURL               string `env:"QUEUE_URL" required:"true"`
+	DeadLetterQueue        string `env:"DEAD_LETTER_QUEUE" default:"one-drive-dlq"`
+	AWSRegion              string `env:"AWS_REGION" default:"us-west-1"`
+	AWSAccessKey           string `env:"AWS_ACCESS_KEY" default:"test"`
+	AWSSecretKey           string `env:"AWS_SECRET_KEY" default:"test"`
+	S3Bucket               string `env:"S3_BUCKET" required:"true"`
+	S3Endpoint             string `env:"S3_ENDPOINT"`
+	Environment            string `env:"ENVIRONMENT" default:"development"`
+	EncryptionKey          string `env:"ENCRYPTION_KEY" default:"default-dev-key-please-change-in-production"`
+	EncryptionKeys         string `env:"ENCRYPTION_KEYS"`
+	EncryptionKeyID        string `env:"ENCRYPTION_KEY_ID"`
+	OnedriveClientID       string `env:"ONEDRIVE_CLIENT_ID" default:"your-client-id"`
+	OnedriveClientSecret   string `env:"ONEDRIVE_CLIENT_SECRET" default:"your-client-secret"`
+	IdempotencyRetention   string `env:"IDEMPOTENCY_RETENTION" default:"168h"`
+	DBTimeout              string `env:"DB_TIMEOUT" default:"10s"`
+	GraphTimeout           string `env:"GRAPH_TIMEOUT" default:"2m"`
+	S3Timeout              string `env:"S3_TIMEOUT" default:"30m"`
+	FileSyncWorkers        string `env:"FILE_SYNC_WORKERS" default:"8"`
+	FileSyncSplitThreshold string `env:"FILE_SYNC_SPLIT_THRESHOLD" default:"50"`
+	VisibilityHeartbeat    string `env:"VISIBILITY_HEARTBEAT" default:"1m"`
+	VisibilityTimeout      string `env:"VISIBILITY_TIMEOUT" default:"2m"`
+	MaxProcessingTime      string `env:"MAX_PROCESSING_TIME" default:"2h"`
 }
 
 func FromEnv() (*Config, error) {
@@ -53,6 +79,165 @@ func FromEnv() (*Config, error) {
 		reflect.ValueOf(config).Elem().Field(i).SetString(v.GetString(envTag))
 	}
 
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
 
+func (c *Config) validate() error {
+	keys, _, err := c.EncryptionKeyring()
+	if err != nil {
+		return err
+	}
+
+	durations := []struct {
+		env   string
+		value string
+	}{
+		{"IDEMPOTENCY_RETENTION", c.IdempotencyRetention},
+		{"DB_TIMEOUT", c.DBTimeout},
+		{"GRAPH_TIMEOUT", c.GraphTimeout},
+		{"S3_TIMEOUT", c.S3Timeout},
+		{"VISIBILITY_HEARTBEAT", c.VisibilityHeartbeat},
+		{"VISIBILITY_TIMEOUT", c.VisibilityTimeout},
+		{"MAX_PROCESSING_TIME", c.MaxProcessingTime},
+	}
+	for _, d := range durations {
+		if parsed, err := time.ParseDuration(d.value); err != nil || parsed <= 0 {
+			return fmt.Errorf("%s must be a positive duration, got %q", d.env, d.value)
+		}
+	}
+
+	counts := []struct {
+		env   string
+		value string
+	}{
+		{"FILE_SYNC_WORKERS", c.FileSyncWorkers},
+		{"FILE_SYNC_SPLIT_THRESHOLD", c.FileSyncSplitThreshold},
+	}
+	for _, n := range counts {
+		if parsed, err := strconv.Atoi(n.value); err != nil || parsed <= 0 {
+			return fmt.Errorf("%s must be a positive integer, got %q", n.env, n.value)
+		}
+	}
+
+	// a message whose visibility runs out between heartbeats is redelivered
+	// while it is still being handled
+	if c.VisibilityHeartbeatInterval() >= c.VisibilityTimeoutDuration() {
+		return fmt.Errorf("VISIBILITY_HEARTBEAT must be shorter than VISIBILITY_TIMEOUT, got %q and %q", c.VisibilityHeartbeat, c.VisibilityTimeout)
+	}
+
+	if c.Environment != developmentEnvironment {
+		for id, key := range keys {
+			if key == DefaultEncryptionKey {
+				return fmt.Errorf("encryption key %q must not be the default key when ENVIRONMENT is %q", id, c.Environment)
+			}
+		}
+	}
+
+	return nil
+}
+
+// IdempotencyRetentionPeriod returns how long processed messages are
+// remembered, so that redeliveries within it aren't processed again.
+func (c *Config) IdempotencyRetentionPeriod() time.Duration {
+	retention, _ := time.ParseDuration(c.IdempotencyRetention)
+	return retention
+}
+
+// DBTimeoutDuration returns how long a database query, or a transaction, may
+// take.
+func (c *Config) DBTimeoutDuration() time.Duration {
+	timeout, _ := time.ParseDuration(c.DBTimeout)
+	return timeout
+}
+
+// GraphTimeoutDuration returns how long a single Graph request may take,
+// including reading its response. Retries each get their own.
+func (c *Config) GraphTimeoutDuration() time.Duration {
+	timeout, _ := time.ParseDuration(c.GraphTimeout)
+	return timeout
+}
+
+// S3TimeoutDuration returns how long a single S3 request may take, including
+// reading the object it returns. An upload streams its object through one
+// request, so this bounds how long the largest file may take to upload.
+func (c *Config) S3TimeoutDuration() time.Duration {
+	timeout, _ := time.ParseDuration(c.S3Timeout)
+	return timeout
+}
+
+// FileSyncWorkerCount returns how many items of a file sync are synced at
+// once.
+func (c *Config) FileSyncWorkerCount() int {
+	workers, _ := strconv.Atoi(c.FileSyncWorkers)
+	return workers
+}
+
+// SplitFileSync reports whether a file sync of that many items is split into
+// work items that are tracked in the database.
+func (c *Config) SplitFileSync(items int) bool {
+	threshold, _ := strconv.Atoi(c.FileSyncSplitThreshold)
+	return items > threshold
+}
+
+// VisibilityHeartbeatInterval returns how often the visibility of a message
+// being handled is extended.
+func (c *Config) VisibilityHeartbeatInterval() time.Duration {
+	interval, _ := time.ParseDuration(c.VisibilityHeartbeat)
+	return interval
+}
+
+// VisibilityTimeoutDuration returns how long each heartbeat keeps a message
+// hidden from other workers. A queue configured with a longer visibility
+// timeout keeps its own.
+func (c *Config) VisibilityTimeoutDuration() time.Duration {
+	timeout, _ := time.ParseDuration(c.VisibilityTimeout)
+	return timeout
+}
+
+// MaxProcessingDuration returns how long a message may be handled before it
+// is abandoned and left for the queue to redeliver.
+func (c *Config) MaxProcessingDuration() time.Duration {
+	ceiling, _ := time.ParseDuration(c.MaxProcessingTime)
+	return ceiling
+}
+
+// EncryptionKeyring returns the encryption keys by ID and the ID of the key
+// new ciphertexts are written with. ENCRYPTION_KEYS holds a comma separated
+// list of id:key pairs, the current key first unless ENCRYPTION_KEY_ID names
+// another; when it is unset, ENCRYPTION_KEY is the only key.
+func (c *Config) EncryptionKeyring() (map[string]string, string, error) {
+	if c.EncryptionKeys == "" {
+		if c.EncryptionKeyID != "" && c.EncryptionKeyID != DefaultEncryptionKeyID {
+			return nil, "", fmt.Errorf("ENCRYPTION_KEY_ID %q requires ENCRYPTION_KEYS", c.EncryptionKeyID)
+		}
+		return map[string]string{DefaultEncryptionKeyID: c.EncryptionKey}, DefaultEncryptionKeyID, nil
+	}
+
+	keys := make(map[string]string)
+	currentID := c.EncryptionKeyID
+
+	for _, entry := range strings.Split(c.EncryptionKeys, ",") {
+		id, key, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" || key == "" {
+			return nil, "", fmt.Errorf("ENCRYPTION_KEYS entries must be id:key pairs")
+		}
+		if _, exists := keys[id]; exists {
+			return nil, "", fmt.Errorf("ENCRYPTION_KEYS has duplicate key ID %q", id)
+		}
+		keys[id] = key
+
+		if currentID == "" {
+			currentID = id
+		}
+	}
+
+	if _, ok := keys[currentID]; !ok {
+		return nil, "", fmt.Errorf("ENCRYPTION_KEY_ID %q is not in ENCRYPTION_KEYS", currentID)
+	}
+
+	return keys, currentID, nil
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptionKeyring(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    Config
+		wantKeys  map[string]string
+		wantID    string
+		wantError string
+	}{
+		{
+			name:     "single key",
+			config:   Config{EncryptionKey: "secret"},
+			wantKeys: map[string]string{"default": "secret"},
+			wantID:   "default",
+		},
+		{
+			name:     "first key is current",
+			config:   Config{EncryptionKeys: "2025-05:new, default:old"},
+			wantKeys: map[string]string{"2025-05": "new", "default": "old"},
+			wantID:   "2025-05",
+		},
+		{
+			name:     "explicit current key",
+			config:   Config{EncryptionKeys: "2025-05:new,default:old", EncryptionKeyID: "default"},
+			wantKeys: map[string]string{"2025-05": "new", "default": "old"},
+			wantID:   "default",
+		},
+		{
+			name:      "malformed entry",
+			config:    Config{EncryptionKeys: "2025-05"},
+			wantError: "id:key pairs",
+		},
+		{
+			name:      "duplicate ID",
+			config:    Config{EncryptionKeys: "a:one,a:two"},
+			wantError: "duplicate key ID",
+		},
+		{
+			name:      "unknown current key",
+			config:    Config{EncryptionKeys: "a:one", EncryptionKeyID: "b"},
+			wantError: "is not in ENCRYPTION_KEYS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, currentID, err := tt.config.EncryptionKeyring()
+			if tt.wantError != "" {
+				assert.ErrorContains(t, err, tt.wantError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantKeys, keys)
+			assert.Equal(t, tt.wantID, currentID)
+		})
+	}
+}
+
+// validConfig returns a development config with every duration set.
+func validConfig() Config {
+	return Config{
+		Environment:            "development",
+		IdempotencyRetention:   "168h",
+		DBTimeout:              "10s",
+		GraphTimeout:           "2m",
+		S3Timeout:              "30m",
+		FileSyncWorkers:        "8",
+		FileSyncSplitThreshold: "50",
+		VisibilityHeartbeat:    "1m",
+		VisibilityTimeout:      "2m",
+		MaxProcessingTime:      "2h",
+	}
+}
+
+func TestValidate_DefaultKeyOutsideDevelopment(t *testing.T) {
+	config := validConfig()
+	config.Environment = "production"
+	config.EncryptionKey = DefaultEncryptionKey
+	assert.Error(t, config.validate())
+
+	config.Environment = "development"
+	assert.NoError(t, config.validate())
+
+	config = validConfig()
+	config.Environment = "production"
+	config.EncryptionKeys = "new:secret,default:" + DefaultEncryptionKey
+	assert.Error(t, config.validate())
+}
+
+func TestValidate_IdempotencyRetention(t *testing.T) {
+	config := validConfig()
+	config.IdempotencyRetention = "24h"
+	assert.NoError(t, config.validate())
+	assert.Equal(t, 24*time.Hour, config.IdempotencyRetentionPeriod())
+
+	for _, retention := range []string{"", "a week", "-1h"} {
+		config.IdempotencyRetention = retention
+		assert.ErrorContains(t, config.validate(), "IDEMPOTENCY_RETENTION")
+	}
+}
+
+func TestValidate_Timeouts(t *testing.T) {
+	config := validConfig()
+	assert.NoError(t, config.validate())
+	assert.Equal(t, 10*time.Second, config.DBTimeoutDuration())
+	assert.Equal(t, 2*time.Minute, config.GraphTimeoutDuration())
+	assert.Equal(t, 30*time.Minute, config.S3TimeoutDuration())
+
+	config.GraphTimeout = "0s"
+	assert.ErrorContains(t, config.validate(), "GRAPH_TIMEOUT")
+}
+
+func TestValidate_FileSync(t *testing.T) {
+	config := validConfig()
+	assert.NoError(t, config.validate())
+	assert.Equal(t, 8, config.FileSyncWorkerCount())
+	assert.False(t, config.SplitFileSync(50))
+	assert.True(t, config.SplitFileSync(51))
+
+	config.FileSyncWorkers = "0"
+	assert.ErrorContains(t, config.validate(), "FILE_SYNC_WORKERS")
+
+	config = validConfig()
+	config.FileSyncSplitThreshold = "many"
+	assert.ErrorContains(t, config.validate(), "FILE_SYNC_SPLIT_THRESHOLD")
+}
+
+func TestValidate_Visibility(t *testing.T) {
+	config := validConfig()
+	assert.NoError(t, config.validate())
+	assert.Equal(t, time.Minute, config.VisibilityHeartbeatInterval())
+	assert.Equal(t, 2*time.Minute, config.VisibilityTimeoutDuration())
+	assert.Equal(t, 2*time.Hour, config.MaxProcessingDuration())
+
+	config.MaxProcessingTime = "forever"
+	assert.ErrorContains(t, config.validate(), "MAX_PROCESSING_TIME")
+
+	config = validConfig()
+	config.VisibilityHeartbeat = "2m"
+	assert.ErrorContains(t, config.validate(), "VISIBILITY_HEARTBEAT must be shorter")
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jaibhavaya/gogo-files/pkg/config"
+)
+
+// encryptedTokenPrefix marks values written by TokenCipher. Values without it
+// are plaintext tokens stored before encryption was introduced.
+const encryptedTokenPrefix = "enc:v1:"
+
+const tokenKeyInfo = "gogo-files onedrive refresh token"
+
+// legacyKeyID is the key that encrypted tokens stored without a key ID, from
+// when ENCRYPTION_KEY was the only key.
+const legacyKeyID = config.DefaultEncryptionKeyID
+
+var ErrNoTokenCipher = errors.New("no token cipher configured")
+
+// TokenCipher encrypts refresh tokens at rest with AES-256-GCM, using a key
+// derived from the configured encryption key with HKDF-SHA256. Each
+// ciphertext is bound to its owner ID, so a token can't be moved to another
+// owner's row and still decrypt.
+type TokenCipher struct {
+	aead cipher.AEAD
+}
+
+func NewTokenCipher(encryptionKey string) (*TokenCipher, error) {
+	if encryptionKey == "" {
+		return nil, fmt.Errorf("encryption key is empty")
+	}
+
+	key, err := hkdf.Key(sha256.New, []byte(encryptionKey), nil, tokenKeyInfo, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive token key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return &TokenCipher{aead: aead}, nil
+}
+
+// Encrypt returns the token in its stored form.
+func (c *TokenCipher) Encrypt(ownerID int64, token string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, []byte(token), ownerAAD(ownerID))
+
+	return encryptedTokenPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of a stored token. Legacy plaintext values are
+// returned unchanged.
+func (c *TokenCipher) Decrypt(ownerID int64, stored string) (string, error) {
+	encoded, encrypted := strings.CutPrefix(stored, encryptedTokenPrefix)
+	if !encrypted {
+		return stored, nil
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted token: %w", err)
+	}
+
+	nonceSize := c.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", fmt.Errorf("encrypted token is too short")
+	}
+
+	token, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], ownerAAD(ownerID))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt token: %w", err)
+	}
+
+	return string(token), nil
+}
+
+// IsEncrypted reports whether a stored value was written by a TokenCipher.
+func IsEncrypted(stored string) bool {
+	return strings.HasPrefix(stored, encryptedTokenPrefix)
+}
+
+func ownerAAD(ownerID int64) []byte {
+	return []byte(strconv.FormatInt(ownerID, 10))
+}
+
+// Keyring holds the token ciphers for every configured encryption key. New
+// tokens are encrypted with the current key; stored tokens are decrypted with
+// the key whose ID was recorded alongside them, so retired keys keep working
+// until their rows are re-encrypted.
+type Keyring struct {
+	ciphers   map[string]*TokenCipher
+	currentID string
+}
+
+// NewKeyring creates a keyring from encryption keys by ID.
+func NewKeyring(keys map[string]string, currentID string) (*Keyring, error) {
+	if _, ok := keys[currentID]; !ok {
+		return nil, fmt.Errorf("current encryption key %q is not in the keyring", currentID)
+	}
+
+	ciphers := make(map[string]*TokenCipher, len(keys))
+	for id, key := range keys {
+		cipher, err := NewTokenCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", id, err)
+		}
+		ciphers[id] = cipher
+	}
+
+	return &Keyring{ciphers: ciphers, currentID: currentID}, nil
+}
+
+// CurrentKeyID returns the ID of the key new tokens are encrypted with.
+func (k *Keyring) CurrentKeyID() string {
+	return k.currentID
+}
+
+// Encrypt returns the token in its stored form and the ID of the key used.
+func (k *Keyring) Encrypt(ownerID int64, token string) (string, string, error) {
+	stored, err := k.ciphers[k.currentID].Encrypt(ownerID, token)
+	if err != nil {
+		return "", "", err
+	}
+	return stored, k.currentID, nil
+}
+
+// Decrypt returns the plaintext of a stored token using the key it was
+// encrypted with. Tokens stored before key IDs were recorded have an empty
+// keyID and belong to legacyKeyID.
+func (k *Keyring) Decrypt(ownerID int64, stored, keyID string) (string, error) {
+	if !IsEncrypted(stored) {
+		return stored, nil
+	}
+
+	if keyID == "" {
+		keyID = legacyKeyID
+	}
+
+	cipher, ok := k.ciphers[keyID]
+	if !ok {
+		return "", fmt.Errorf("unknown encryption key %q", keyID)
+	}
+
+	return cipher.Decrypt(ownerID, stored)
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenCipher_RoundTrip(t *testing.T) {
+	cipher, err := NewTokenCipher("test-encryption-key")
+	assert.NoError(t, err)
+
+	stored, err := cipher.Encrypt(123, "refresh-token")
+	assert.NoError(t, err)
+	assert.True(t, IsEncrypted(stored))
+	assert.NotContains(t, stored, "refresh-token")
+
+	again, err := cipher.Encrypt(123, "refresh-token")
+	assert.NoError(t, err)
+	assert.NotEqual(t, stored, again)
+
+	token, err := cipher.Decrypt(123, stored)
+	assert.NoError(t, err)
+	assert.Equal(t, "refresh-token", token)
+}
+
+func TestTokenCipher_Decrypt(t *testing.T) {
+	cipher, err := NewTokenCipher("test-encryption-key")
+	assert.NoError(t, err)
+
+	stored, err := cipher.Encrypt(123, "refresh-token")
+	assert.NoError(t, err)
+
+	other, err := NewTokenCipher("other-encryption-key")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		cipher  *TokenCipher
+		ownerID int64
+		stored  string
+		want    string
+		wantErr bool
+	}{
+		{name: "legacy plaintext", cipher: cipher, ownerID: 123, stored: "plaintext-token", want: "plaintext-token"},
+		{name: "wrong owner", cipher: cipher, ownerID: 456, stored: stored, wantErr: true},
+		{name: "wrong key", cipher: other, ownerID: 123, stored: stored, wantErr: true},
+		{name: "tampered", cipher: cipher, ownerID: 123, stored: tamper(stored), wantErr: true},
+		{name: "truncated", cipher: cipher, ownerID: 123, stored: encryptedTokenPrefix + "AAAA", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.cipher.Decrypt(tt.ownerID, tt.stored)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, token)
+		})
+	}
+}
+
+func TestNewTokenCipher_EmptyKey(t *testing.T) {
+	_, err := NewTokenCipher("")
+	assert.Error(t, err)
+}
+
+// tamper flips a character inside the encoded nonce.
+func tamper(stored string) string {
+	i := len(encryptedTokenPrefix) + 4
+	replacement := byte('A')
+	if stored[i] == 'A' {
+		replacement = 'B'
+	}
+	return stored[:i] + string(replacement) + stored[i+1:]
+}
+
+func TestKeyring_DecryptsWithRecordedKey(t *testing.T) {
+	old, err := NewKeyring(map[string]string{"default": "old-key"}, "default")
+	assert.NoError(t, err)
+
+	rotated, err := NewKeyring(map[string]string{"default": "old-key", "2025-05": "new-key"}, "2025-05")
+	assert.NoError(t, err)
+
+	legacy, keyID, err := old.Encrypt(123, "legacy-token")
+	assert.NoError(t, err)
+	assert.Equal(t, "default", keyID)
+
+	current, keyID, err := rotated.Encrypt(123, "current-token")
+	assert.NoError(t, err)
+	assert.Equal(t, "2025-05", keyID)
+
+	token, err := rotated.Decrypt(123, legacy, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy-token", token)
+
+	token, err = rotated.Decrypt(123, legacy, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy-token", token)
+
+	token, err = rotated.Decrypt(123, current, "2025-05")
+	assert.NoError(t, err)
+	assert.Equal(t, "current-token", token)
+
+	_, err = old.Decrypt(123, current, "2025-05")
+	assert.ErrorContains(t, err, "unknown encryption key")
+}
+
+func TestNewKeyring_UnknownCurrentKey(t *testing.T) {
+	_, err := NewKeyring(map[string]string{"a": "key"}, "b")
+	assert.Error(t, err)
+}
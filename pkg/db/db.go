@@ -1,26 +1,178 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// ErrNoOneDriveIntegration reports that an owner has not authorized OneDrive.
+var ErrNoOneDriveIntegration = errors.New("no onedrive integration found")
+
 type Repository interface {
-	GetOneDriveIntegration(ownerID int64) (*OneDriveIntegration, error)
-	SaveOneDriveRefreshToken(ownerID int64, userID string, refreshToken string) error
-	GetOneDriveRefreshToken(ownerID int64) (string, error)
+	GetOneDriveIntegration(ctx context.Context, ownerID int64) (*OneDriveIntegration, error)
+	SaveOneDriveRefreshToken(ctx context.Context, ownerID int64, userID string, refreshToken string) error
+	GetOneDriveRefreshToken(ctx context.Context, ownerID int64) (string, error)
+	RotateOneDriveRefreshToken(ctx context.Context, ownerID int64, previousToken, newToken string) (bool, error)
+	GetUploadSession(ctx context.Context, ownerID int64, bucket, key, destination string) (*UploadSession, error)
+	SaveUploadSession(ctx context.Context, session *UploadSession) error
+	DeleteUploadSession(ctx context.Context, ownerID int64, bucket, key, destination string) error
+	GetFile(ctx context.Context, ownerID int64, bucket, key, destination string) (*File, error)
+	SaveFile(ctx context.Context, file *File) error
 }
 
 type OneDriveIntegration struct {
 	OwnerID      int64  `db:"owner_id"`
 	UserID       string `db:"user_id"`
 	RefreshToken string `db:"refresh_token"`
+	// ConflictBehavior is the owner's default for uploads to a path that is
+	// already taken, or empty to use the service default.
+	ConflictBehavior string `db:"conflict_behavior"`
+	// DriveID and DriveType describe the user's default drive, discovered
+	// when they authorized. Both are empty until then.
+	DriveID   string `db:"drive_id"`
+	DriveType string `db:"drive_type"`
+}
+
+// OneDriveDrive is a user's default drive and its quota, in bytes.
+type OneDriveDrive struct {
+	ID             string `db:"drive_id"`
+	Type           string `db:"drive_type"`
+	QuotaTotal     int64  `db:"quota_total"`
+	QuotaUsed      int64  `db:"quota_used"`
+	QuotaRemaining int64  `db:"quota_remaining"`
+}
+
+// Sync states of a file
+const (
+	FileStatusPending   = "pending"
+	FileStatusUploading = "uploading"
+	FileStatusSynced    = "synced"
+	FileStatusFailed    = "failed"
+)
+
+// File is the sync state of an S3 object copied to a OneDrive destination.
+type File struct {
+	ID             int64      `db:"id"`
+	OwnerID        int64      `db:"owner_id"`
+	Name           string     `db:"name"`
+	Bucket         string     `db:"s3_bucket"`
+	Key            string     `db:"s3_key"`
+	VersionID      string     `db:"s3_version_id"`
+	ETag           string     `db:"s3_etag"`
+	Size           int64      `db:"s3_size"`
+	LastModified   *time.Time `db:"s3_last_modified"`
+	DriveID        string     `db:"drive_id"`
+	OneDriveItemID string     `db:"onedrive_item_id"`
+	CTag           string     `db:"onedrive_ctag"`
+	Destination    string     `db:"destination"`
+	Status         string     `db:"status"`
+	Attempts       int        `db:"attempts"`
+	LastError      string     `db:"last_error"`
+	SyncedAt       *time.Time `db:"synced_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at"`
+}
+
+// ProcessedMessage records the outcome of a message that was processed, so a
+// redelivery of it can be answered without processing it again.
+type ProcessedMessage struct {
+	IdempotencyKey string          `db:"idempotency_key"`
+	EventType      string          `db:"event_type"`
+	Result         json.RawMessage `db:"result"`
+	ProcessedAt    time.Time       `db:"processed_at"`
+}
+
+// UploadSession tracks an in-flight OneDrive upload session for an S3 object,
+// so a redelivered sync can continue it instead of starting over.
+type UploadSession struct {
+	OwnerID        int64     `db:"owner_id"`
+	Bucket         string    `db:"s3_bucket"`
+	Key            string    `db:"s3_key"`
+	Destination    string    `db:"destination"`
+	UploadURL      string    `db:"upload_url"`
+	ExpiresAt      time.Time `db:"expires_at"`
+	BytesCommitted int64     `db:"bytes_committed"`
+	ETag           string    `db:"s3_etag"`
+}
+
+// Work states of an item of a split file sync
+const (
+	SyncWorkItemPending = "pending"
+	SyncWorkItemDone    = "done"
+)
+
+// SyncWorkItem is one item of a file sync that was split into work items,
+// identified by the job it belongs to and its position in the sync. Result
+// holds the outcome of an item that is done.
+type SyncWorkItem struct {
+	JobID     string          `db:"job_id"`
+	ItemIndex int             `db:"item_index"`
+	OwnerID   int64           `db:"owner_id"`
+	Key       string          `db:"s3_key"`
+	Status    string          `db:"status"`
+	Attempts  int             `db:"attempts"`
+	LastError string          `db:"last_error"`
+	Result    json.RawMessage `db:"result"`
+}
+
+// States of a sync job. A job is running until every item has an outcome
+// or its message is dead-lettered.
+const (
+	SyncJobRunning         = "running"
+	SyncJobSucceeded       = "succeeded"
+	SyncJobPartiallyFailed = "partially_failed"
+	SyncJobFailed          = "failed"
+)
+
+// SyncJob tracks the progress of a file_sync message. Succeeded, Failed and
+// Skipped count the items of the current delivery that have an outcome;
+// BytesTransferred counts every byte uploaded for the job, across deliveries.
+type SyncJob struct {
+	ID               string     `db:"id"`
+	OwnerID          int64      `db:"owner_id"`
+	UserID           string     `db:"user_id"`
+	Status           string     `db:"status"`
+	TotalItems       int        `db:"total_items"`
+	Succeeded        int        `db:"succeeded"`
+	Failed           int        `db:"failed"`
+	Skipped          int        `db:"skipped"`
+	BytesTransferred int64      `db:"bytes_transferred"`
+	Attempts         int        `db:"attempts"`
+	LastError        string     `db:"last_error"`
+	StartedAt        time.Time  `db:"started_at"`
+	FinishedAt       *time.Time `db:"finished_at"`
+}
+
+// SyncJobProgress is added to a sync job's counts as items get an outcome.
+type SyncJobProgress struct {
+	Succeeded        int
+	Failed           int
+	Skipped          int
+	BytesTransferred int64
+}
+
+// SyncJobFilter selects sync jobs by owner and user. Zero fields match any
+// job.
+type SyncJobFilter struct {
+	OwnerID int64
+	UserID  string
 }
 
 type Pool struct {
 	DB *sql.DB
+	// Keyring encrypts refresh tokens at rest; the repository refuses to read
+	// or write tokens without one.
+	Keyring *Keyring
+	// Timeout limits how long each query, or each transaction, may take. Zero
+	// means no limit beyond the caller's context.
+	Timeout time.Duration
 }
 
 type PostgresRepository struct {
@@ -33,7 +185,7 @@ func NewPostgresRepository(dbPool *Pool) *PostgresRepository {
 	}
 }
 
-func Connect(connectionString string) (*Pool, error) {
+func Connect(connectionString string, keyring *Keyring) (*Pool, error) {
 	db, err := sql.Open("postgres", connectionString)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -43,25 +195,48 @@ func Connect(connectionString string) (*Pool, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &Pool{DB: db}, nil
+	return &Pool{DB: db, Keyring: keyring}, nil
 }
 
 func (p *Pool) Close() error {
 	return p.DB.Close()
 }
 
-func (r *PostgresRepository) GetOneDriveIntegration(ownerID int64) (*OneDriveIntegration, error) {
+// withTimeout bounds ctx by the pool's Timeout.
+func (p *Pool) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.Timeout)
+}
+
+func (r *PostgresRepository) keyring() (*Keyring, error) {
+	if r.dbPool.Keyring == nil {
+		return nil, ErrNoTokenCipher
+	}
+	return r.dbPool.Keyring, nil
+}
+
+func (r *PostgresRepository) GetOneDriveIntegration(ctx context.Context, ownerID int64) (*OneDriveIntegration, error) {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
 	query := `
-        SELECT owner_id, user_id, refresh_token
+        SELECT owner_id, user_id, refresh_token, encryption_key_id, conflict_behavior, drive_id, drive_type
         FROM onedrive_integrations
         WHERE owner_id = $1
     `
 
 	var integration OneDriveIntegration
-	err := r.dbPool.DB.QueryRow(query, ownerID).Scan(
+	var keyID, conflictBehavior, driveID, driveType sql.NullString
+	err := r.dbPool.DB.QueryRowContext(ctx, query, ownerID).Scan(
 		&integration.OwnerID,
 		&integration.UserID,
 		&integration.RefreshToken,
+		&keyID,
+		&conflictBehavior,
+		&driveID,
+		&driveType,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -70,21 +245,48 @@ func (r *PostgresRepository) GetOneDriveIntegration(ownerID int64) (*OneDriveInt
 		return nil, fmt.Errorf("failed to get OneDrive integration: %w", err)
 	}
 
+	keyring, err := r.keyring()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OneDrive integration: %w", err)
+	}
+
+	integration.RefreshToken, err = keyring.Decrypt(ownerID, integration.RefreshToken, keyID.String)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OneDrive integration: %w", err)
+	}
+	integration.ConflictBehavior = conflictBehavior.String
+	integration.DriveID = driveID.String
+	integration.DriveType = driveType.String
+
 	return &integration, nil
 }
 
-func (r *PostgresRepository) SaveOneDriveRefreshToken(ownerID int64, userID string, refreshToken string) error {
+func (r *PostgresRepository) SaveOneDriveRefreshToken(ctx context.Context, ownerID int64, userID string, refreshToken string) error {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO onedrive_integrations
-		(owner_id, user_id, refresh_token)
-		VALUES ($1, $2, $3)
+		(owner_id, user_id, refresh_token, encryption_key_id)
+		VALUES ($1, $2, $3, $4)
 		ON CONFLICT (owner_id)
 		DO UPDATE SET
 			user_id = EXCLUDED.user_id,
-			refresh_token = EXCLUDED.refresh_token
+			refresh_token = EXCLUDED.refresh_token,
+			encryption_key_id = EXCLUDED.encryption_key_id
 	`
 
-	_, err := r.dbPool.DB.Exec(query, ownerID, userID, refreshToken)
+	keyring, err := r.keyring()
+	if err != nil {
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	encrypted, keyID, err := keyring.Encrypt(ownerID, refreshToken)
+	if err != nil {
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	_, err = r.dbPool.DB.ExecContext(ctx, query, ownerID, userID, encrypted, keyID)
 	if err != nil {
 		return fmt.Errorf("failed to save refresh token: %w", err)
 	}
@@ -92,16 +294,61 @@ func (r *PostgresRepository) SaveOneDriveRefreshToken(ownerID int64, userID stri
 	return nil
 }
 
+// SaveOneDriveDrive records the drive discovered for an owner's integration.
+func (r *PostgresRepository) SaveOneDriveDrive(ctx context.Context, ownerID int64, drive *OneDriveDrive) error {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE onedrive_integrations
+		SET drive_id = $2,
+			drive_type = $3,
+			quota_total = $4,
+			quota_used = $5,
+			quota_remaining = $6,
+			drive_updated_at = NOW()
+		WHERE owner_id = $1
+	`
+
+	result, err := r.dbPool.DB.ExecContext(
+		ctx,
+		query,
+		ownerID,
+		drive.ID,
+		drive.Type,
+		drive.QuotaTotal,
+		drive.QuotaUsed,
+		drive.QuotaRemaining,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save drive: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to save drive: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("failed to save drive: %w for owner: %d", ErrNoOneDriveIntegration, ownerID)
+	}
+
+	return nil
+}
+
 // GetOneDriveRefreshToken retrieves an OneDrive refresh token by owner ID
-func (r *PostgresRepository) GetOneDriveRefreshToken(ownerID int64) (string, error) {
+func (r *PostgresRepository) GetOneDriveRefreshToken(ctx context.Context, ownerID int64) (string, error) {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT refresh_token
+		SELECT refresh_token, encryption_key_id
 		FROM onedrive_integrations
 		WHERE owner_id = $1
 	`
 
 	var refreshToken string
-	err := r.dbPool.DB.QueryRow(query, ownerID).Scan(&refreshToken)
+	var keyID sql.NullString
+	err := r.dbPool.DB.QueryRowContext(ctx, query, ownerID).Scan(&refreshToken, &keyID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return "", fmt.Errorf("no active OneDrive integration found for owner %d", ownerID)
@@ -109,21 +356,941 @@ func (r *PostgresRepository) GetOneDriveRefreshToken(ownerID int64) (string, err
 		return "", fmt.Errorf("failed to query refresh token: %w", err)
 	}
 
+	keyring, err := r.keyring()
+	if err != nil {
+		return "", fmt.Errorf("failed to query refresh token: %w", err)
+	}
+
+	refreshToken, err = keyring.Decrypt(ownerID, refreshToken, keyID.String)
+	if err != nil {
+		return "", fmt.Errorf("failed to query refresh token: %w", err)
+	}
+
 	return refreshToken, nil
 }
 
-func GetOneDriveIntegration(pool *Pool, ownerID int64) (*OneDriveIntegration, error) {
+// RotateOneDriveRefreshToken replaces the refresh token issued by a token
+// exchange and records when it happened. The update only applies if the stored
+// token is still previousToken, so a token rotated or re-authorized in the
+// meantime is never overwritten; the result reports whether it applied.
+//
+// Stored tokens are encrypted with a random nonce, so the comparison is made
+// on the decrypted value under a row lock rather than in the UPDATE itself.
+func (r *PostgresRepository) RotateOneDriveRefreshToken(ctx context.Context, ownerID int64, previousToken, newToken string) (bool, error) {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	keyring, err := r.keyring()
+	if err != nil {
+		return false, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	tx, err := r.dbPool.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	defer tx.Rollback()
+
+	selectQuery := `
+		SELECT refresh_token, encryption_key_id
+		FROM onedrive_integrations
+		WHERE owner_id = $1
+		FOR UPDATE
+	`
+
+	var stored string
+	var keyID sql.NullString
+	err = tx.QueryRowContext(ctx, selectQuery, ownerID).Scan(&stored, &keyID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	current, err := keyring.Decrypt(ownerID, stored, keyID.String)
+	if err != nil {
+		return false, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if current != previousToken {
+		return false, nil
+	}
+
+	encrypted, newKeyID, err := keyring.Encrypt(ownerID, newToken)
+	if err != nil {
+		return false, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	updateQuery := `
+		UPDATE onedrive_integrations
+		SET refresh_token = $2, encryption_key_id = $3, token_refreshed_at = NOW()
+		WHERE owner_id = $1
+	`
+
+	if _, err := tx.ExecContext(ctx, updateQuery, ownerID, encrypted, newKeyID); err != nil {
+		return false, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	return true, nil
+}
+
+// EncryptPlaintextRefreshTokens encrypts refresh tokens that were stored
+// before encryption at rest was introduced, returning how many were updated.
+// Each row is only rewritten if it still holds the plaintext that was read, so
+// it is safe to run while tokens are being rotated.
+func (r *PostgresRepository) EncryptPlaintextRefreshTokens(ctx context.Context) (int, error) {
+	keyring, err := r.keyring()
+	if err != nil {
+		return 0, fmt.Errorf("failed to encrypt refresh tokens: %w", err)
+	}
+
+	query := `
+		SELECT owner_id, refresh_token
+		FROM onedrive_integrations
+		WHERE refresh_token NOT LIKE $1
+	`
+
+	queryCtx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.dbPool.DB.QueryContext(queryCtx, query, encryptedTokenPrefix+"%")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query plaintext refresh tokens: %w", err)
+	}
+
+	plaintext := make(map[int64]string)
+	for rows.Next() {
+		var ownerID int64
+		var token string
+		if err := rows.Scan(&ownerID, &token); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan plaintext refresh token: %w", err)
+		}
+		plaintext[ownerID] = token
+	}
+	if err := rows.Close(); err != nil {
+		return 0, fmt.Errorf("failed to query plaintext refresh tokens: %w", err)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to query plaintext refresh tokens: %w", err)
+	}
+
+	updateQuery := `
+		UPDATE onedrive_integrations
+		SET refresh_token = $3, encryption_key_id = $4
+		WHERE owner_id = $1 AND refresh_token = $2
+	`
+
+	updated := 0
+	for ownerID, token := range plaintext {
+		encrypted, keyID, err := keyring.Encrypt(ownerID, token)
+		if err != nil {
+			return updated, fmt.Errorf("failed to encrypt refresh token for owner %d: %w", ownerID, err)
+		}
+
+		result, err := r.encryptPlaintextRefreshToken(ctx, updateQuery, ownerID, token, encrypted, keyID)
+		if err != nil {
+			return updated, fmt.Errorf("failed to encrypt refresh token for owner %d: %w", ownerID, err)
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return updated, fmt.Errorf("failed to encrypt refresh token for owner %d: %w", ownerID, err)
+		}
+		updated += int(n)
+	}
+
+	return updated, nil
+}
+
+// encryptPlaintextRefreshToken runs updateQuery for a single owner, under its
+// own deadline.
+func (r *PostgresRepository) encryptPlaintextRefreshToken(ctx context.Context, updateQuery string, args ...any) (sql.Result, error) {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	return r.dbPool.DB.ExecContext(ctx, updateQuery, args...)
+}
+
+// RekeyRefreshTokens re-encrypts every refresh token that isn't stored under
+// the current encryption key, batchSize rows per transaction, and returns how
+// many were rewritten. Rows are locked while their batch is re-encrypted, so
+// it is safe to run while the service is rotating tokens.
+func (r *PostgresRepository) RekeyRefreshTokens(ctx context.Context, batchSize int) (int, error) {
+	keyring, err := r.keyring()
+	if err != nil {
+		return 0, fmt.Errorf("failed to rekey refresh tokens: %w", err)
+	}
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("failed to rekey refresh tokens: batch size must be positive")
+	}
+
+	rekeyed := 0
+	afterOwnerID := int64(math.MinInt64)
+	for {
+		n, lastOwnerID, err := r.rekeyBatch(ctx, keyring, afterOwnerID, batchSize)
+		rekeyed += n
+		if err != nil {
+			return rekeyed, err
+		}
+		if lastOwnerID == nil {
+			return rekeyed, nil
+		}
+		afterOwnerID = *lastOwnerID
+	}
+}
+
+// rekeyBatch re-encrypts up to batchSize rows with an owner ID above
+// afterOwnerID, returning how many it rewrote and the last owner ID it
+// visited, or nil once there are none left.
+func (r *PostgresRepository) rekeyBatch(ctx context.Context, keyring *Keyring, afterOwnerID int64, batchSize int) (int, *int64, error) {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.dbPool.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to rekey refresh tokens: %w", err)
+	}
+	defer tx.Rollback()
+
+	selectQuery := `
+		SELECT owner_id, refresh_token, encryption_key_id
+		FROM onedrive_integrations
+		WHERE owner_id > $1 AND encryption_key_id IS DISTINCT FROM $2
+		ORDER BY owner_id
+		LIMIT $3
+		FOR UPDATE
+	`
+
+	rows, err := tx.QueryContext(ctx, selectQuery, afterOwnerID, keyring.CurrentKeyID(), batchSize)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to query refresh tokens to rekey: %w", err)
+	}
+
+	type storedToken struct {
+		ownerID int64
+		token   string
+		keyID   sql.NullString
+	}
+
+	var batch []storedToken
+	for rows.Next() {
+		var stored storedToken
+		if err := rows.Scan(&stored.ownerID, &stored.token, &stored.keyID); err != nil {
+			rows.Close()
+			return 0, nil, fmt.Errorf("failed to scan refresh token to rekey: %w", err)
+		}
+		batch = append(batch, stored)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, nil, fmt.Errorf("failed to query refresh tokens to rekey: %w", err)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("failed to query refresh tokens to rekey: %w", err)
+	}
+
+	if len(batch) == 0 {
+		return 0, nil, nil
+	}
+
+	updateQuery := `
+		UPDATE onedrive_integrations
+		SET refresh_token = $2, encryption_key_id = $3
+		WHERE owner_id = $1
+	`
+
+	for _, stored := range batch {
+		token, err := keyring.Decrypt(stored.ownerID, stored.token, stored.keyID.String)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to rekey refresh token for owner %d: %w", stored.ownerID, err)
+		}
+
+		encrypted, keyID, err := keyring.Encrypt(stored.ownerID, token)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to rekey refresh token for owner %d: %w", stored.ownerID, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, updateQuery, stored.ownerID, encrypted, keyID); err != nil {
+			return 0, nil, fmt.Errorf("failed to rekey refresh token for owner %d: %w", stored.ownerID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, fmt.Errorf("failed to rekey refresh tokens: %w", err)
+	}
+
+	lastOwnerID := batch[len(batch)-1].ownerID
+	return len(batch), &lastOwnerID, nil
+}
+
+// GetUploadSession retrieves the upload session recorded for an object and
+// destination, or nil if there is none
+func (r *PostgresRepository) GetUploadSession(ctx context.Context, ownerID int64, bucket, key, destination string) (*UploadSession, error) {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT owner_id, s3_bucket, s3_key, destination, upload_url, expires_at, bytes_committed, s3_etag
+		FROM upload_sessions
+		WHERE owner_id = $1 AND s3_bucket = $2 AND s3_key = $3 AND destination = $4
+	`
+
+	var session UploadSession
+	err := r.dbPool.DB.QueryRowContext(ctx, query, ownerID, bucket, key, destination).Scan(
+		&session.OwnerID,
+		&session.Bucket,
+		&session.Key,
+		&session.Destination,
+		&session.UploadURL,
+		&session.ExpiresAt,
+		&session.BytesCommitted,
+		&session.ETag,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get upload session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// SaveUploadSession records the current state of an upload session
+func (r *PostgresRepository) SaveUploadSession(ctx context.Context, session *UploadSession) error {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO upload_sessions
+		(owner_id, s3_bucket, s3_key, destination, upload_url, expires_at, bytes_committed, s3_etag)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (owner_id, s3_bucket, s3_key, destination)
+		DO UPDATE SET
+			upload_url = EXCLUDED.upload_url,
+			expires_at = EXCLUDED.expires_at,
+			bytes_committed = EXCLUDED.bytes_committed,
+			s3_etag = EXCLUDED.s3_etag
+	`
+
+	_, err := r.dbPool.DB.ExecContext(
+		ctx,
+		query,
+		session.OwnerID,
+		session.Bucket,
+		session.Key,
+		session.Destination,
+		session.UploadURL,
+		session.ExpiresAt,
+		session.BytesCommitted,
+		session.ETag,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save upload session: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUploadSession forgets the upload session for an object and destination
+func (r *PostgresRepository) DeleteUploadSession(ctx context.Context, ownerID int64, bucket, key, destination string) error {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		DELETE FROM upload_sessions
+		WHERE owner_id = $1 AND s3_bucket = $2 AND s3_key = $3 AND destination = $4
+	`
+
+	_, err := r.dbPool.DB.ExecContext(ctx, query, ownerID, bucket, key, destination)
+	if err != nil {
+		return fmt.Errorf("failed to delete upload session: %w", err)
+	}
+
+	return nil
+}
+
+// GetFile retrieves the sync state of an object and destination, or nil if
+// it has never been synced
+func (r *PostgresRepository) GetFile(ctx context.Context, ownerID int64, bucket, key, destination string) (*File, error) {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, owner_id, name, s3_bucket, s3_key, s3_version_id, s3_etag, s3_size, s3_last_modified,
+			drive_id, onedrive_item_id, onedrive_ctag, destination, status, attempts, last_error, synced_at,
+			created_at, updated_at
+		FROM files
+		WHERE owner_id = $1 AND s3_bucket = $2 AND s3_key = $3 AND destination = $4
+	`
+
+	var file File
+	var versionID, etag, itemID, cTag, lastError sql.NullString
+	var size sql.NullInt64
+	var lastModified, syncedAt sql.NullTime
+	err := r.dbPool.DB.QueryRowContext(ctx, query, ownerID, bucket, key, destination).Scan(
+		&file.ID,
+		&file.OwnerID,
+		&file.Name,
+		&file.Bucket,
+		&file.Key,
+		&versionID,
+		&etag,
+		&size,
+		&lastModified,
+		&file.DriveID,
+		&itemID,
+		&cTag,
+		&file.Destination,
+		&file.Status,
+		&file.Attempts,
+		&lastError,
+		&syncedAt,
+		&file.CreatedAt,
+		&file.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+
+	file.VersionID = versionID.String
+	file.ETag = etag.String
+	file.Size = size.Int64
+	file.OneDriveItemID = itemID.String
+	file.CTag = cTag.String
+	file.LastError = lastError.String
+	if lastModified.Valid {
+		file.LastModified = &lastModified.Time
+	}
+	if syncedAt.Valid {
+		file.SyncedAt = &syncedAt.Time
+	}
+
+	return &file, nil
+}
+
+// SaveFile records the sync state of an object and destination
+func (r *PostgresRepository) SaveFile(ctx context.Context, file *File) error {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO files
+		(owner_id, name, s3_bucket, s3_key, s3_version_id, s3_etag, s3_size, s3_last_modified,
+			drive_id, onedrive_item_id, onedrive_ctag, destination, status, attempts, last_error, synced_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (owner_id, s3_bucket, s3_key, destination)
+		DO UPDATE SET
+			name = EXCLUDED.name,
+			s3_version_id = EXCLUDED.s3_version_id,
+			s3_etag = EXCLUDED.s3_etag,
+			s3_size = EXCLUDED.s3_size,
+			s3_last_modified = EXCLUDED.s3_last_modified,
+			drive_id = EXCLUDED.drive_id,
+			onedrive_item_id = EXCLUDED.onedrive_item_id,
+			onedrive_ctag = EXCLUDED.onedrive_ctag,
+			status = EXCLUDED.status,
+			attempts = EXCLUDED.attempts,
+			last_error = EXCLUDED.last_error,
+			synced_at = EXCLUDED.synced_at
+		RETURNING id
+	`
+
+	err := r.dbPool.DB.QueryRowContext(
+		ctx,
+		query,
+		file.OwnerID,
+		file.Name,
+		file.Bucket,
+		file.Key,
+		nullString(file.VersionID),
+		nullString(file.ETag),
+		file.Size,
+		file.LastModified,
+		file.DriveID,
+		nullString(file.OneDriveItemID),
+		nullString(file.CTag),
+		file.Destination,
+		file.Status,
+		file.Attempts,
+		nullString(file.LastError),
+		file.SyncedAt,
+	).Scan(&file.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+
+	return nil
+}
+
+// nullString stores an empty string as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// GetProcessedMessage retrieves the outcome recorded for an idempotency key
+// since the given time, or nil if there is none
+func (r *PostgresRepository) GetProcessedMessage(ctx context.Context, idempotencyKey string, since time.Time) (*ProcessedMessage, error) {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT idempotency_key, event_type, result, processed_at
+		FROM processed_messages
+		WHERE idempotency_key = $1 AND processed_at > $2
+	`
+
+	var processed ProcessedMessage
+	err := r.dbPool.DB.QueryRowContext(ctx, query, idempotencyKey, since).Scan(
+		&processed.IdempotencyKey,
+		&processed.EventType,
+		&processed.Result,
+		&processed.ProcessedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get processed message: %w", err)
+	}
+
+	return &processed, nil
+}
+
+// SaveProcessedMessage records the outcome of processing a message
+func (r *PostgresRepository) SaveProcessedMessage(ctx context.Context, processed *ProcessedMessage) error {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO processed_messages (idempotency_key, event_type, result, processed_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (idempotency_key)
+		DO UPDATE SET
+			event_type = EXCLUDED.event_type,
+			result = EXCLUDED.result,
+			processed_at = EXCLUDED.processed_at
+	`
+
+	_, err := r.dbPool.DB.ExecContext(ctx, query, processed.IdempotencyKey, processed.EventType, []byte(processed.Result))
+	if err != nil {
+		return fmt.Errorf("failed to save processed message: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteProcessedMessagesBefore forgets messages processed before cutoff and
+// returns how many were removed
+func (r *PostgresRepository) DeleteProcessedMessagesBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		DELETE FROM processed_messages
+		WHERE processed_at < $1
+	`
+
+	result, err := r.dbPool.DB.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete processed messages: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete processed messages: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// CreateSyncWorkItems creates the work items of a job that don't exist yet,
+// one for each S3 key in order, and returns every work item of the job
+// ordered by index
+func (r *PostgresRepository) CreateSyncWorkItems(ctx context.Context, jobID string, ownerID int64, keys []string) ([]*SyncWorkItem, error) {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	insertQuery := `
+		INSERT INTO sync_work_items (job_id, item_index, owner_id, s3_key)
+		SELECT $1, ordinality - 1, $2, s3_key
+		FROM unnest($3::text[]) WITH ORDINALITY AS keys(s3_key, ordinality)
+		ON CONFLICT (job_id, item_index) DO NOTHING
+	`
+
+	_, err := r.dbPool.DB.ExecContext(ctx, insertQuery, jobID, ownerID, pq.Array(keys))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sync work items: %w", err)
+	}
+
+	selectQuery := `
+		SELECT job_id, item_index, owner_id, s3_key, status, attempts, last_error, result
+		FROM sync_work_items
+		WHERE job_id = $1
+		ORDER BY item_index
+	`
+
+	rows, err := r.dbPool.DB.QueryContext(ctx, selectQuery, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sync work items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []*SyncWorkItem
+	for rows.Next() {
+		var item SyncWorkItem
+		var lastError sql.NullString
+		var result []byte
+		err := rows.Scan(
+			&item.JobID,
+			&item.ItemIndex,
+			&item.OwnerID,
+			&item.Key,
+			&item.Status,
+			&item.Attempts,
+			&lastError,
+			&result,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get sync work items: %w", err)
+		}
+		item.LastError = lastError.String
+		item.Result = result
+		items = append(items, &item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get sync work items: %w", err)
+	}
+
+	return items, nil
+}
+
+// SaveSyncWorkItemResult marks a work item as done with the given outcome
+func (r *PostgresRepository) SaveSyncWorkItemResult(ctx context.Context, jobID string, index int, result json.RawMessage) error {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE sync_work_items
+		SET status = $3, attempts = attempts + 1, last_error = NULL, result = $4
+		WHERE job_id = $1 AND item_index = $2
+	`
+
+	_, err := r.dbPool.DB.ExecContext(ctx, query, jobID, index, SyncWorkItemDone, []byte(result))
+	if err != nil {
+		return fmt.Errorf("failed to save sync work item result: %w", err)
+	}
+
+	return nil
+}
+
+// SaveSyncWorkItemError records a failed attempt at a work item, leaving it
+// pending
+func (r *PostgresRepository) SaveSyncWorkItemError(ctx context.Context, jobID string, index int, lastError string) error {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE sync_work_items
+		SET status = $3, attempts = attempts + 1, last_error = $4
+		WHERE job_id = $1 AND item_index = $2
+	`
+
+	_, err := r.dbPool.DB.ExecContext(ctx, query, jobID, index, SyncWorkItemPending, nullString(lastError))
+	if err != nil {
+		return fmt.Errorf("failed to save sync work item error: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSyncWorkItemsBefore forgets the jobs whose work items were all last
+// updated before cutoff and returns how many work items were removed
+func (r *PostgresRepository) DeleteSyncWorkItemsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		DELETE FROM sync_work_items
+		WHERE job_id IN (
+			SELECT job_id
+			FROM sync_work_items
+			GROUP BY job_id
+			HAVING MAX(updated_at) < $1
+		)
+	`
+
+	result, err := r.dbPool.DB.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sync work items: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sync work items: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// StartSyncJob records a delivery of a sync job. A new job is created as
+// running; a job that exists already is running again with its item counts
+// reset and its attempts incremented, keeping when it started and the bytes
+// transferred so far.
+func (r *PostgresRepository) StartSyncJob(ctx context.Context, job *SyncJob) error {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO sync_jobs (id, owner_id, user_id, status, total_items)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id)
+		DO UPDATE SET
+			status = EXCLUDED.status,
+			total_items = EXCLUDED.total_items,
+			succeeded = 0,
+			failed = 0,
+			skipped = 0,
+			attempts = sync_jobs.attempts + 1,
+			last_error = NULL,
+			finished_at = NULL
+	`
+
+	_, err := r.dbPool.DB.ExecContext(ctx, query, job.ID, job.OwnerID, job.UserID, SyncJobRunning, job.TotalItems)
+	if err != nil {
+		return fmt.Errorf("failed to start sync job: %w", err)
+	}
+
+	return nil
+}
+
+// AddSyncJobProgress adds the outcome of some of a job's items to its counts
+func (r *PostgresRepository) AddSyncJobProgress(ctx context.Context, jobID string, progress SyncJobProgress) error {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE sync_jobs
+		SET
+			succeeded = succeeded + $2,
+			failed = failed + $3,
+			skipped = skipped + $4,
+			bytes_transferred = bytes_transferred + $5
+		WHERE id = $1
+	`
+
+	_, err := r.dbPool.DB.ExecContext(ctx, query, jobID, progress.Succeeded, progress.Failed, progress.Skipped, progress.BytesTransferred)
+	if err != nil {
+		return fmt.Errorf("failed to save sync job progress: %w", err)
+	}
+
+	return nil
+}
+
+// FinishSyncJob gives a running job its terminal status. lastError may be
+// empty.
+func (r *PostgresRepository) FinishSyncJob(ctx context.Context, jobID string, status string, lastError string) error {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE sync_jobs
+		SET status = $2, last_error = $3, finished_at = NOW()
+		WHERE id = $1 AND status = $4
+	`
+
+	_, err := r.dbPool.DB.ExecContext(ctx, query, jobID, status, nullString(lastError), SyncJobRunning)
+	if err != nil {
+		return fmt.Errorf("failed to finish sync job: %w", err)
+	}
+
+	return nil
+}
+
+// GetSyncJob retrieves a sync job by ID, or nil if there is none
+func (r *PostgresRepository) GetSyncJob(ctx context.Context, jobID string) (*SyncJob, error) {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, owner_id, user_id, status, total_items, succeeded, failed, skipped,
+			bytes_transferred, attempts, last_error, started_at, finished_at
+		FROM sync_jobs
+		WHERE id = $1
+	`
+
+	job, err := scanSyncJob(r.dbPool.DB.QueryRowContext(ctx, query, jobID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get sync job: %w", err)
+	}
+
+	return job, nil
+}
+
+// ListSyncJobs retrieves up to limit of the jobs matching filter, most
+// recently started first
+func (r *PostgresRepository) ListSyncJobs(ctx context.Context, filter SyncJobFilter, limit int) ([]*SyncJob, error) {
+	ctx, cancel := r.dbPool.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, owner_id, user_id, status, total_items, succeeded, failed, skipped,
+			bytes_transferred, attempts, last_error, started_at, finished_at
+		FROM sync_jobs
+		WHERE ($1::bigint = 0 OR owner_id = $1) AND ($2::text = '' OR user_id = $2)
+		ORDER BY started_at DESC
+		LIMIT $3
+	`
+
+	rows, err := r.dbPool.DB.QueryContext(ctx, query, filter.OwnerID, filter.UserID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sync jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*SyncJob
+	for rows.Next() {
+		job, err := scanSyncJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list sync jobs: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sync jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// scanSyncJob reads a sync job from a row of the queries above
+func scanSyncJob(row interface{ Scan(...any) error }) (*SyncJob, error) {
+	var job SyncJob
+	var lastError sql.NullString
+	var finishedAt sql.NullTime
+	err := row.Scan(
+		&job.ID,
+		&job.OwnerID,
+		&job.UserID,
+		&job.Status,
+		&job.TotalItems,
+		&job.Succeeded,
+		&job.Failed,
+		&job.Skipped,
+		&job.BytesTransferred,
+		&job.Attempts,
+		&lastError,
+		&job.StartedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	job.LastError = lastError.String
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	return &job, nil
+}
+
+func GetOneDriveIntegration(ctx context.Context, pool *Pool, ownerID int64) (*OneDriveIntegration, error) {
+	repo := NewPostgresRepository(pool)
+	return repo.GetOneDriveIntegration(ctx, ownerID)
+}
+
+func SaveOneDriveRefreshToken(ctx context.Context, pool *Pool, ownerID int64, userID string, refreshToken string) error {
+	repo := NewPostgresRepository(pool)
+	return repo.SaveOneDriveRefreshToken(ctx, ownerID, userID, refreshToken)
+}
+
+func SaveOneDriveDrive(ctx context.Context, pool *Pool, ownerID int64, drive *OneDriveDrive) error {
+	repo := NewPostgresRepository(pool)
+	return repo.SaveOneDriveDrive(ctx, ownerID, drive)
+}
+
+func GetOneDriveRefreshToken(ctx context.Context, pool *Pool, ownerID int64) (string, error) {
+	repo := NewPostgresRepository(pool)
+	return repo.GetOneDriveRefreshToken(ctx, ownerID)
+}
+
+func EncryptPlaintextRefreshTokens(ctx context.Context, pool *Pool) (int, error) {
+	repo := NewPostgresRepository(pool)
+	return repo.EncryptPlaintextRefreshTokens(ctx)
+}
+
+func RekeyRefreshTokens(ctx context.Context, pool *Pool, batchSize int) (int, error) {
+	repo := NewPostgresRepository(pool)
+	return repo.RekeyRefreshTokens(ctx, batchSize)
+}
+
+func GetProcessedMessage(ctx context.Context, pool *Pool, idempotencyKey string, since time.Time) (*ProcessedMessage, error) {
+	repo := NewPostgresRepository(pool)
+	return repo.GetProcessedMessage(ctx, idempotencyKey, since)
+}
+
+func SaveProcessedMessage(ctx context.Context, pool *Pool, processed *ProcessedMessage) error {
+	repo := NewPostgresRepository(pool)
+	return repo.SaveProcessedMessage(ctx, processed)
+}
+
+func DeleteProcessedMessagesBefore(ctx context.Context, pool *Pool, cutoff time.Time) (int64, error) {
 	repo := NewPostgresRepository(pool)
-	return repo.GetOneDriveIntegration(ownerID)
+	return repo.DeleteProcessedMessagesBefore(ctx, cutoff)
 }
 
-func SaveOneDriveRefreshToken(pool *Pool, ownerID int64, userID string, refreshToken string) error {
+func CreateSyncWorkItems(ctx context.Context, pool *Pool, jobID string, ownerID int64, keys []string) ([]*SyncWorkItem, error) {
 	repo := NewPostgresRepository(pool)
-	return repo.SaveOneDriveRefreshToken(ownerID, userID, refreshToken)
+	return repo.CreateSyncWorkItems(ctx, jobID, ownerID, keys)
 }
 
-func GetOneDriveRefreshToken(pool *Pool, ownerID int64) (string, error) {
+func SaveSyncWorkItemResult(ctx context.Context, pool *Pool, jobID string, index int, result json.RawMessage) error {
 	repo := NewPostgresRepository(pool)
-	return repo.GetOneDriveRefreshToken(ownerID)
+	return repo.SaveSyncWorkItemResult(ctx, jobID, index, result)
 }
 
+func SaveSyncWorkItemError(ctx context.Context, pool *Pool, jobID string, index int, lastError string) error {
+	repo := NewPostgresRepository(pool)
+	return repo.SaveSyncWorkItemError(ctx, jobID, index, lastError)
+}
+
+func DeleteSyncWorkItemsBefore(ctx context.Context, pool *Pool, cutoff time.Time) (int64, error) {
+	repo := NewPostgresRepository(pool)
+	return repo.DeleteSyncWorkItemsBefore(ctx, cutoff)
+}
+
+func StartSyncJob(ctx context.Context, pool *Pool, job *SyncJob) error {
+	repo := NewPostgresRepository(pool)
+	return repo.StartSyncJob(ctx, job)
+}
+
+func AddSyncJobProgress(ctx context.Context, pool *Pool, jobID string, progress SyncJobProgress) error {
+	repo := NewPostgresRepository(pool)
+	return repo.AddSyncJobProgress(ctx, jobID, progress)
+}
+
+func FinishSyncJob(ctx context.Context, pool *Pool, jobID string, status string, lastError string) error {
+	repo := NewPostgresRepository(pool)
+	return repo.FinishSyncJob(ctx, jobID, status, lastError)
+}
+
+func GetSyncJob(ctx context.Context, pool *Pool, jobID string) (*SyncJob, error) {
+	repo := NewPostgresRepository(pool)
+	return repo.GetSyncJob(ctx, jobID)
+}
+
+func ListSyncJobs(ctx context.Context, pool *Pool, filter SyncJobFilter, limit int) ([]*SyncJob, error) {
+	repo := NewPostgresRepository(pool)
+	return repo.ListSyncJobs(ctx, filter, limit)
+}
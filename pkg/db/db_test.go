@@ -1,9 +1,13 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
@@ -15,10 +19,46 @@ func setupMockDB(t *testing.T) (*Pool, sqlmock.Sqlmock) {
 		t.Fatalf("Error creating mock database: %v", err)
 	}
 
-	pool := &Pool{DB: db}
+	keyring, err := NewKeyring(map[string]string{
+		"current": "test-encryption-key",
+		"retired": "retired-encryption-key",
+	}, "current")
+	if err != nil {
+		t.Fatalf("Error creating keyring: %v", err)
+	}
+
+	pool := &Pool{DB: db, Keyring: keyring}
 	return pool, mock
 }
 
+// encryptWithKey stores a token the way it would have been written under the
+// given key ID.
+func encryptWithKey(t *testing.T, pool *Pool, keyID string, ownerID int64, token string) string {
+	stored, err := pool.Keyring.ciphers[keyID].Encrypt(ownerID, token)
+	if err != nil {
+		t.Fatalf("Error encrypting token: %v", err)
+	}
+	return stored
+}
+
+// encryptedToken matches a stored refresh token argument that decrypts to
+// the expected plaintext for the owner.
+type encryptedToken struct {
+	keyring *Keyring
+	ownerID int64
+	token   string
+}
+
+func (e encryptedToken) Match(v driver.Value) bool {
+	stored, ok := v.(string)
+	if !ok || !IsEncrypted(stored) {
+		return false
+	}
+
+	token, err := e.keyring.Decrypt(e.ownerID, stored, e.keyring.CurrentKeyID())
+	return err == nil && token == e.token
+}
+
 func TestGetOneDriveIntegration_Success(t *testing.T) {
 	pool, mock := setupMockDB(t)
 	defer pool.Close()
@@ -32,20 +72,25 @@ func TestGetOneDriveIntegration_Success(t *testing.T) {
 		RefreshToken: "test-token",
 	}
 
-	rows := sqlmock.NewRows([]string{"owner_id", "user_id", "refresh_token"}).
-		AddRow(expectedIntegration.OwnerID, expectedIntegration.UserID, expectedIntegration.RefreshToken)
+	stored := encryptWithKey(t, pool, "current", ownerID, expectedIntegration.RefreshToken)
+
+	rows := sqlmock.NewRows([]string{"owner_id", "user_id", "refresh_token", "encryption_key_id", "conflict_behavior", "drive_id", "drive_type"}).
+		AddRow(expectedIntegration.OwnerID, expectedIntegration.UserID, stored, "current", "keep-newer", "b!drive", "business")
 
-	mock.ExpectQuery("SELECT owner_id, user_id, refresh_token FROM onedrive_integrations WHERE owner_id = \\$1").
+	mock.ExpectQuery("SELECT owner_id, user_id, refresh_token, encryption_key_id, conflict_behavior, drive_id, drive_type FROM onedrive_integrations WHERE owner_id = \\$1").
 		WithArgs(ownerID).
 		WillReturnRows(rows)
 
-	integration, err := repo.GetOneDriveIntegration(ownerID)
+	integration, err := repo.GetOneDriveIntegration(context.Background(), ownerID)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, integration)
 	assert.Equal(t, expectedIntegration.OwnerID, integration.OwnerID)
 	assert.Equal(t, expectedIntegration.UserID, integration.UserID)
 	assert.Equal(t, expectedIntegration.RefreshToken, integration.RefreshToken)
+	assert.Equal(t, "keep-newer", integration.ConflictBehavior)
+	assert.Equal(t, "b!drive", integration.DriveID)
+	assert.Equal(t, "business", integration.DriveType)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -58,11 +103,11 @@ func TestGetOneDriveIntegration_NotFound(t *testing.T) {
 
 	ownerID := int64(123)
 
-	mock.ExpectQuery("SELECT owner_id, user_id, refresh_token FROM onedrive_integrations WHERE owner_id = \\$1").
+	mock.ExpectQuery("SELECT owner_id, user_id, refresh_token, encryption_key_id, conflict_behavior, drive_id, drive_type FROM onedrive_integrations WHERE owner_id = \\$1").
 		WithArgs(ownerID).
 		WillReturnError(sql.ErrNoRows)
 
-	integration, err := repo.GetOneDriveIntegration(ownerID)
+	integration, err := repo.GetOneDriveIntegration(context.Background(), ownerID)
 
 	assert.NoError(t, err) // No error, just nil result
 	assert.Nil(t, integration)
@@ -79,11 +124,11 @@ func TestGetOneDriveIntegration_DatabaseError(t *testing.T) {
 	ownerID := int64(123)
 
 	expectedErr := errors.New("database connection error")
-	mock.ExpectQuery("SELECT owner_id, user_id, refresh_token FROM onedrive_integrations WHERE owner_id = \\$1").
+	mock.ExpectQuery("SELECT owner_id, user_id, refresh_token, encryption_key_id, conflict_behavior, drive_id, drive_type FROM onedrive_integrations WHERE owner_id = \\$1").
 		WithArgs(ownerID).
 		WillReturnError(expectedErr)
 
-	integration, err := repo.GetOneDriveIntegration(ownerID)
+	integration, err := repo.GetOneDriveIntegration(context.Background(), ownerID)
 
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to get OneDrive integration")
@@ -92,6 +137,28 @@ func TestGetOneDriveIntegration_DatabaseError(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestGetOneDriveIntegration_Timeout(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+	pool.Timeout = 10 * time.Millisecond
+
+	repo := NewPostgresRepository(pool)
+
+	ownerID := int64(123)
+
+	mock.ExpectQuery("SELECT owner_id, user_id, refresh_token, encryption_key_id, conflict_behavior, drive_id, drive_type FROM onedrive_integrations WHERE owner_id = \\$1").
+		WithArgs(ownerID).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}))
+
+	start := time.Now()
+	integration, err := repo.GetOneDriveIntegration(context.Background(), ownerID)
+
+	assert.Error(t, err)
+	assert.Nil(t, integration)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
 func TestSaveOneDriveRefreshToken_Success(t *testing.T) {
 	pool, mock := setupMockDB(t)
 	defer pool.Close()
@@ -103,10 +170,10 @@ func TestSaveOneDriveRefreshToken_Success(t *testing.T) {
 	refreshToken := "new-refresh-token"
 
 	mock.ExpectExec("INSERT INTO onedrive_integrations").
-		WithArgs(ownerID, userID, refreshToken).
+		WithArgs(ownerID, userID, encryptedToken{pool.Keyring, ownerID, refreshToken}, "current").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err := repo.SaveOneDriveRefreshToken(ownerID, userID, refreshToken)
+	err := repo.SaveOneDriveRefreshToken(context.Background(), ownerID, userID, refreshToken)
 
 	assert.NoError(t, err)
 
@@ -125,10 +192,10 @@ func TestSaveOneDriveRefreshToken_Error(t *testing.T) {
 
 	expectedErr := errors.New("database constraint violation")
 	mock.ExpectExec("INSERT INTO onedrive_integrations").
-		WithArgs(ownerID, userID, refreshToken).
+		WithArgs(ownerID, userID, encryptedToken{pool.Keyring, ownerID, refreshToken}, "current").
 		WillReturnError(expectedErr)
 
-	err := repo.SaveOneDriveRefreshToken(ownerID, userID, refreshToken)
+	err := repo.SaveOneDriveRefreshToken(context.Background(), ownerID, userID, refreshToken)
 
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to save refresh token")
@@ -136,6 +203,265 @@ func TestSaveOneDriveRefreshToken_Error(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestSaveOneDriveDrive_Success(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	drive := &OneDriveDrive{
+		ID:             "b!drive",
+		Type:           "business",
+		QuotaTotal:     1099511627776,
+		QuotaUsed:      1024,
+		QuotaRemaining: 1099511626752,
+	}
+
+	mock.ExpectExec("UPDATE onedrive_integrations").
+		WithArgs(int64(123), "b!drive", "business", drive.QuotaTotal, drive.QuotaUsed, drive.QuotaRemaining).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.SaveOneDriveDrive(context.Background(), 123, drive)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveOneDriveDrive_NoIntegration(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectExec("UPDATE onedrive_integrations").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repo.SaveOneDriveDrive(context.Background(), 123, &OneDriveDrive{ID: "b!drive"})
+
+	assert.ErrorIs(t, err, ErrNoOneDriveIntegration)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetOneDriveIntegration_LegacyPlaintextToken(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	rows := sqlmock.NewRows([]string{"owner_id", "user_id", "refresh_token", "encryption_key_id", "conflict_behavior", "drive_id", "drive_type"}).
+		AddRow(int64(123), "test-user", "plaintext-token", nil, nil, nil, nil)
+
+	mock.ExpectQuery("SELECT owner_id, user_id, refresh_token, encryption_key_id, conflict_behavior, drive_id, drive_type FROM onedrive_integrations").
+		WithArgs(int64(123)).
+		WillReturnRows(rows)
+
+	integration, err := repo.GetOneDriveIntegration(context.Background(), 123)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "plaintext-token", integration.RefreshToken)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetOneDriveIntegration_WrongOwner(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	stored := encryptWithKey(t, pool, "current", 456, "test-token")
+
+	rows := sqlmock.NewRows([]string{"owner_id", "user_id", "refresh_token", "encryption_key_id", "conflict_behavior", "drive_id", "drive_type"}).
+		AddRow(int64(123), "test-user", stored, "current", nil, nil, nil)
+
+	mock.ExpectQuery("SELECT owner_id, user_id, refresh_token, encryption_key_id, conflict_behavior, drive_id, drive_type FROM onedrive_integrations").
+		WithArgs(int64(123)).
+		WillReturnRows(rows)
+
+	integration, err := repo.GetOneDriveIntegration(context.Background(), 123)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to decrypt token")
+	assert.Nil(t, integration)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveOneDriveRefreshToken_NoCipher(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+	pool.Keyring = nil
+
+	repo := NewPostgresRepository(pool)
+
+	err := repo.SaveOneDriveRefreshToken(context.Background(), 123, "test-user", "new-refresh-token")
+
+	assert.ErrorIs(t, err, ErrNoTokenCipher)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRotateOneDriveRefreshToken_Success(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	stored := encryptWithKey(t, pool, "retired", 123, "old-token")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT refresh_token, encryption_key_id FROM onedrive_integrations WHERE owner_id = \\$1 FOR UPDATE").
+		WithArgs(int64(123)).
+		WillReturnRows(sqlmock.NewRows([]string{"refresh_token", "encryption_key_id"}).AddRow(stored, "retired"))
+	mock.ExpectExec("UPDATE onedrive_integrations SET refresh_token = \\$2, encryption_key_id = \\$3, token_refreshed_at = NOW\\(\\) WHERE owner_id = \\$1").
+		WithArgs(int64(123), encryptedToken{pool.Keyring, 123, "new-token"}, "current").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rotated, err := repo.RotateOneDriveRefreshToken(context.Background(), 123, "old-token", "new-token")
+
+	assert.NoError(t, err)
+	assert.True(t, rotated)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRotateOneDriveRefreshToken_ConcurrentlyRotated(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	stored := encryptWithKey(t, pool, "current", 123, "other-token")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT refresh_token, encryption_key_id FROM onedrive_integrations").
+		WithArgs(int64(123)).
+		WillReturnRows(sqlmock.NewRows([]string{"refresh_token", "encryption_key_id"}).AddRow(stored, "current"))
+	mock.ExpectRollback()
+
+	rotated, err := repo.RotateOneDriveRefreshToken(context.Background(), 123, "old-token", "new-token")
+
+	assert.NoError(t, err)
+	assert.False(t, rotated)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRotateOneDriveRefreshToken_LegacyPlaintextToken(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT refresh_token, encryption_key_id FROM onedrive_integrations").
+		WithArgs(int64(123)).
+		WillReturnRows(sqlmock.NewRows([]string{"refresh_token", "encryption_key_id"}).AddRow("old-token", nil))
+	mock.ExpectExec("UPDATE onedrive_integrations").
+		WithArgs(int64(123), encryptedToken{pool.Keyring, 123, "new-token"}, "current").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rotated, err := repo.RotateOneDriveRefreshToken(context.Background(), 123, "old-token", "new-token")
+
+	assert.NoError(t, err)
+	assert.True(t, rotated)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEncryptPlaintextRefreshTokens(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	rows := sqlmock.NewRows([]string{"owner_id", "refresh_token"}).
+		AddRow(int64(123), "plaintext-token")
+
+	mock.ExpectQuery("SELECT owner_id, refresh_token FROM onedrive_integrations WHERE refresh_token NOT LIKE \\$1").
+		WithArgs("enc:v1:%").
+		WillReturnRows(rows)
+	mock.ExpectExec("UPDATE onedrive_integrations SET refresh_token = \\$3, encryption_key_id = \\$4 WHERE owner_id = \\$1 AND refresh_token = \\$2").
+		WithArgs(int64(123), "plaintext-token", encryptedToken{pool.Keyring, 123, "plaintext-token"}, "current").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	updated, err := repo.EncryptPlaintextRefreshTokens(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updated)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRekeyRefreshTokens(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	selectQuery := "SELECT owner_id, refresh_token, encryption_key_id FROM onedrive_integrations WHERE owner_id > \\$1 AND encryption_key_id IS DISTINCT FROM \\$2 ORDER BY owner_id LIMIT \\$3 FOR UPDATE"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectQuery).
+		WithArgs(int64(math.MinInt64), "current", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id", "refresh_token", "encryption_key_id"}).
+			AddRow(int64(1), encryptWithKey(t, pool, "retired", 1, "token-1"), "retired").
+			AddRow(int64(2), "token-2", nil))
+	mock.ExpectExec("UPDATE onedrive_integrations SET refresh_token = \\$2, encryption_key_id = \\$3 WHERE owner_id = \\$1").
+		WithArgs(int64(1), encryptedToken{pool.Keyring, 1, "token-1"}, "current").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE onedrive_integrations").
+		WithArgs(int64(2), encryptedToken{pool.Keyring, 2, "token-2"}, "current").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectQuery).
+		WithArgs(int64(2), "current", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id", "refresh_token", "encryption_key_id"}).
+			AddRow(int64(3), encryptWithKey(t, pool, "retired", 3, "token-3"), "retired"))
+	mock.ExpectExec("UPDATE onedrive_integrations").
+		WithArgs(int64(3), encryptedToken{pool.Keyring, 3, "token-3"}, "current").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectQuery).
+		WithArgs(int64(3), "current", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id", "refresh_token", "encryption_key_id"}))
+	mock.ExpectRollback()
+
+	rekeyed, err := repo.RekeyRefreshTokens(context.Background(), 2)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, rekeyed)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRekeyRefreshTokens_UnknownKey(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT owner_id, refresh_token, encryption_key_id FROM onedrive_integrations").
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id", "refresh_token", "encryption_key_id"}).
+			AddRow(int64(1), encryptWithKey(t, pool, "retired", 1, "token-1"), "removed"))
+	mock.ExpectRollback()
+
+	rekeyed, err := repo.RekeyRefreshTokens(context.Background(), 100)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown encryption key \"removed\"")
+	assert.Equal(t, 0, rekeyed)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGetOneDriveRefreshToken_Success(t *testing.T) {
 	pool, mock := setupMockDB(t)
 	defer pool.Close()
@@ -145,12 +471,13 @@ func TestGetOneDriveRefreshToken_Success(t *testing.T) {
 	ownerID := int64(123)
 	expectedToken := "test-refresh-token"
 
-	rows := sqlmock.NewRows([]string{"refresh_token"}).AddRow(expectedToken)
-	mock.ExpectQuery("SELECT refresh_token FROM onedrive_integrations WHERE owner_id = \\$1").
+	rows := sqlmock.NewRows([]string{"refresh_token", "encryption_key_id"}).
+		AddRow(encryptWithKey(t, pool, "retired", ownerID, expectedToken), "retired")
+	mock.ExpectQuery("SELECT refresh_token, encryption_key_id FROM onedrive_integrations WHERE owner_id = \\$1").
 		WithArgs(ownerID).
 		WillReturnRows(rows)
 
-	token, err := repo.GetOneDriveRefreshToken(ownerID)
+	token, err := repo.GetOneDriveRefreshToken(context.Background(), ownerID)
 
 	assert.NoError(t, err)
 	assert.Equal(t, expectedToken, token)
@@ -166,11 +493,11 @@ func TestGetOneDriveRefreshToken_NotFound(t *testing.T) {
 
 	ownerID := int64(123)
 
-	mock.ExpectQuery("SELECT refresh_token FROM onedrive_integrations WHERE owner_id = \\$1").
+	mock.ExpectQuery("SELECT refresh_token, encryption_key_id FROM onedrive_integrations WHERE owner_id = \\$1").
 		WithArgs(ownerID).
 		WillReturnError(sql.ErrNoRows)
 
-	token, err := repo.GetOneDriveRefreshToken(ownerID)
+	token, err := repo.GetOneDriveRefreshToken(context.Background(), ownerID)
 
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no active OneDrive integration found")
@@ -179,3 +506,472 @@ func TestGetOneDriveRefreshToken_NotFound(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestGetUploadSession_Success(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	expiresAt := time.Now().Add(time.Hour)
+	rows := sqlmock.NewRows([]string{
+		"owner_id", "s3_bucket", "s3_key", "destination", "upload_url", "expires_at", "bytes_committed", "s3_etag",
+	}).AddRow(int64(123), "bucket", "key", "drive:/file.pdf", "https://upload", expiresAt, int64(327680), "etag")
+
+	mock.ExpectQuery("SELECT (.+) FROM upload_sessions WHERE owner_id = \\$1").
+		WithArgs(int64(123), "bucket", "key", "drive:/file.pdf").
+		WillReturnRows(rows)
+
+	session, err := repo.GetUploadSession(context.Background(), 123, "bucket", "key", "drive:/file.pdf")
+
+	assert.NoError(t, err)
+	assert.NotNil(t, session)
+	assert.Equal(t, "https://upload", session.UploadURL)
+	assert.Equal(t, int64(327680), session.BytesCommitted)
+	assert.Equal(t, "etag", session.ETag)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetUploadSession_NotFound(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectQuery("SELECT (.+) FROM upload_sessions").
+		WithArgs(int64(123), "bucket", "key", "drive:/file.pdf").
+		WillReturnError(sql.ErrNoRows)
+
+	session, err := repo.GetUploadSession(context.Background(), 123, "bucket", "key", "drive:/file.pdf")
+
+	assert.NoError(t, err)
+	assert.Nil(t, session)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveUploadSession_Success(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	session := &UploadSession{
+		OwnerID:        123,
+		Bucket:         "bucket",
+		Key:            "key",
+		Destination:    "drive:/file.pdf",
+		UploadURL:      "https://upload",
+		ExpiresAt:      time.Now().Add(time.Hour),
+		BytesCommitted: 327680,
+		ETag:           "etag",
+	}
+
+	mock.ExpectExec("INSERT INTO upload_sessions").
+		WithArgs(
+			session.OwnerID, session.Bucket, session.Key, session.Destination,
+			session.UploadURL, session.ExpiresAt, session.BytesCommitted, session.ETag,
+		).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := repo.SaveUploadSession(context.Background(), session)
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteUploadSession_Error(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectExec("DELETE FROM upload_sessions").
+		WithArgs(int64(123), "bucket", "key", "drive:/file.pdf").
+		WillReturnError(errors.New("connection reset"))
+
+	err := repo.DeleteUploadSession(context.Background(), 123, "bucket", "key", "drive:/file.pdf")
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to delete upload session")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetProcessedMessage_Success(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	since := time.Now().Add(-time.Hour)
+	processedAt := time.Now()
+	rows := sqlmock.NewRows([]string{"idempotency_key", "event_type", "result", "processed_at"}).
+		AddRow("msg-1", "file_sync", []byte(`[]`), processedAt)
+
+	mock.ExpectQuery("SELECT (.+) FROM processed_messages WHERE idempotency_key = \\$1 AND processed_at > \\$2").
+		WithArgs("msg-1", since).
+		WillReturnRows(rows)
+
+	processed, err := repo.GetProcessedMessage(context.Background(), "msg-1", since)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, processed)
+	assert.Equal(t, "file_sync", processed.EventType)
+	assert.JSONEq(t, `[]`, string(processed.Result))
+	assert.Equal(t, processedAt, processed.ProcessedAt)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetProcessedMessage_NotFound(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectQuery("SELECT (.+) FROM processed_messages").
+		WithArgs("msg-1", sqlmock.AnyArg()).
+		WillReturnError(sql.ErrNoRows)
+
+	processed, err := repo.GetProcessedMessage(context.Background(), "msg-1", time.Now())
+
+	assert.NoError(t, err)
+	assert.Nil(t, processed)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveProcessedMessage(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectExec("INSERT INTO processed_messages (.+) ON CONFLICT \\(idempotency_key\\)").
+		WithArgs("msg-1", "file_sync", []byte(`[{"uuid":"status-1"}]`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := repo.SaveProcessedMessage(context.Background(), &ProcessedMessage{
+		IdempotencyKey: "msg-1",
+		EventType:      "file_sync",
+		Result:         []byte(`[{"uuid":"status-1"}]`),
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteProcessedMessagesBefore(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	cutoff := time.Now().Add(-7 * 24 * time.Hour)
+	mock.ExpectExec("DELETE FROM processed_messages WHERE processed_at < \\$1").
+		WithArgs(cutoff).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	deleted, err := repo.DeleteProcessedMessagesBefore(context.Background(), cutoff)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetFile_Success(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{
+		"id", "owner_id", "name", "s3_bucket", "s3_key", "s3_version_id", "s3_etag", "s3_size", "s3_last_modified",
+		"drive_id", "onedrive_item_id", "onedrive_ctag", "destination", "status", "attempts", "last_error", "synced_at",
+		"created_at", "updated_at",
+	}).AddRow(
+		int64(7), int64(123), "file.pdf", "bucket", "key", nil, `"etag"`, int64(2048), now,
+		"drive", "01ABC", "ctag", "drive:/file.pdf", FileStatusSynced, 1, nil, now,
+		now, now,
+	)
+
+	mock.ExpectQuery("SELECT (.+) FROM files WHERE owner_id = \\$1").
+		WithArgs(int64(123), "bucket", "key", "drive:/file.pdf").
+		WillReturnRows(rows)
+
+	file, err := repo.GetFile(context.Background(), 123, "bucket", "key", "drive:/file.pdf")
+
+	assert.NoError(t, err)
+	assert.NotNil(t, file)
+	assert.Equal(t, int64(7), file.ID)
+	assert.Empty(t, file.VersionID)
+	assert.Equal(t, `"etag"`, file.ETag)
+	assert.Equal(t, int64(2048), file.Size)
+	assert.Equal(t, &now, file.LastModified)
+	assert.Equal(t, "01ABC", file.OneDriveItemID)
+	assert.Equal(t, "ctag", file.CTag)
+	assert.Equal(t, FileStatusSynced, file.Status)
+	assert.Equal(t, &now, file.SyncedAt)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetFile_NotFound(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectQuery("SELECT (.+) FROM files").
+		WithArgs(int64(123), "bucket", "key", "drive:/file.pdf").
+		WillReturnError(sql.ErrNoRows)
+
+	file, err := repo.GetFile(context.Background(), 123, "bucket", "key", "drive:/file.pdf")
+
+	assert.NoError(t, err)
+	assert.Nil(t, file)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveFile(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	file := &File{
+		OwnerID:     123,
+		Name:        "file.pdf",
+		Bucket:      "bucket",
+		Key:         "key",
+		ETag:        `"etag"`,
+		Size:        2048,
+		DriveID:     "drive",
+		Destination: "drive:/file.pdf",
+		Status:      FileStatusUploading,
+		Attempts:    1,
+	}
+
+	mock.ExpectQuery("INSERT INTO files (.+) ON CONFLICT \\(owner_id, s3_bucket, s3_key, destination\\)").
+		WithArgs(
+			int64(123), "file.pdf", "bucket", "key", sql.NullString{}, sql.NullString{String: `"etag"`, Valid: true}, int64(2048), nil,
+			"drive", sql.NullString{}, sql.NullString{}, "drive:/file.pdf", FileStatusUploading, 1, sql.NullString{}, nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(7)))
+
+	err := repo.SaveFile(context.Background(), file)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), file.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateSyncWorkItems(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectExec("INSERT INTO sync_work_items (.+) ON CONFLICT \\(job_id, item_index\\) DO NOTHING").
+		WithArgs("job", int64(123), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rows := sqlmock.NewRows([]string{
+		"job_id", "item_index", "owner_id", "s3_key", "status", "attempts", "last_error", "result",
+	}).
+		AddRow("job", 0, int64(123), "a", SyncWorkItemDone, 1, nil, []byte(`{"Status":"synced"}`)).
+		AddRow("job", 1, int64(123), "b", SyncWorkItemPending, 2, "throttled", nil)
+
+	mock.ExpectQuery("SELECT (.+) FROM sync_work_items WHERE job_id = \\$1 ORDER BY item_index").
+		WithArgs("job").
+		WillReturnRows(rows)
+
+	items, err := repo.CreateSyncWorkItems(context.Background(), "job", 123, []string{"a", "b"})
+
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, SyncWorkItemDone, items[0].Status)
+	assert.JSONEq(t, `{"Status":"synced"}`, string(items[0].Result))
+	assert.Equal(t, 1, items[1].ItemIndex)
+	assert.Equal(t, "b", items[1].Key)
+	assert.Equal(t, "throttled", items[1].LastError)
+	assert.Nil(t, items[1].Result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveSyncWorkItemResult(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectExec("UPDATE sync_work_items SET status = \\$3, attempts = attempts \\+ 1, last_error = NULL").
+		WithArgs("job", 1, SyncWorkItemDone, []byte(`{"Status":"synced"}`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.SaveSyncWorkItemResult(context.Background(), "job", 1, []byte(`{"Status":"synced"}`))
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveSyncWorkItemError(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectExec("UPDATE sync_work_items SET status = \\$3, attempts = attempts \\+ 1, last_error = \\$4").
+		WithArgs("job", 1, SyncWorkItemPending, sql.NullString{String: "throttled", Valid: true}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.SaveSyncWorkItemError(context.Background(), "job", 1, "throttled")
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteSyncWorkItemsBefore(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	cutoff := time.Now().Add(-7 * 24 * time.Hour)
+	mock.ExpectExec("DELETE FROM sync_work_items WHERE job_id IN (.+) HAVING MAX\\(updated_at\\) < \\$1").
+		WithArgs(cutoff).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	deleted, err := repo.DeleteSyncWorkItemsBefore(context.Background(), cutoff)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStartSyncJob(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectExec("INSERT INTO sync_jobs (.+) ON CONFLICT \\(id\\) DO UPDATE SET (.+) attempts = sync_jobs.attempts \\+ 1").
+		WithArgs("job", int64(123), "456", SyncJobRunning, 300).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.StartSyncJob(context.Background(), &SyncJob{ID: "job", OwnerID: 123, UserID: "456", TotalItems: 300})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddSyncJobProgress(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectExec("UPDATE sync_jobs SET succeeded = succeeded \\+ \\$2, failed = failed \\+ \\$3").
+		WithArgs("job", 2, 1, 0, int64(4096)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.AddSyncJobProgress(context.Background(), "job", SyncJobProgress{Succeeded: 2, Failed: 1, BytesTransferred: 4096})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFinishSyncJob(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectExec("UPDATE sync_jobs SET status = \\$2, last_error = \\$3, finished_at = NOW\\(\\) WHERE id = \\$1 AND status = \\$4").
+		WithArgs("job", SyncJobFailed, sql.NullString{String: "no onedrive integration found", Valid: true}, SyncJobRunning).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.FinishSyncJob(context.Background(), "job", SyncJobFailed, "no onedrive integration found")
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func syncJobRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"id", "owner_id", "user_id", "status", "total_items", "succeeded", "failed", "skipped",
+		"bytes_transferred", "attempts", "last_error", "started_at", "finished_at",
+	})
+}
+
+func TestGetSyncJob_Success(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT (.+) FROM sync_jobs WHERE id = \\$1").
+		WithArgs("job").
+		WillReturnRows(syncJobRows().AddRow(
+			"job", int64(123), "456", SyncJobPartiallyFailed, 300, 297, 2, 1,
+			int64(1<<30), 2, nil, now, now,
+		))
+
+	job, err := repo.GetSyncJob(context.Background(), "job")
+
+	assert.NoError(t, err)
+	assert.Equal(t, SyncJobPartiallyFailed, job.Status)
+	assert.Equal(t, 300, job.TotalItems)
+	assert.Equal(t, 297, job.Succeeded)
+	assert.Equal(t, 2, job.Failed)
+	assert.Equal(t, 1, job.Skipped)
+	assert.Equal(t, int64(1<<30), job.BytesTransferred)
+	assert.Empty(t, job.LastError)
+	assert.Equal(t, &now, job.FinishedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetSyncJob_NotFound(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	mock.ExpectQuery("SELECT (.+) FROM sync_jobs WHERE id = \\$1").
+		WithArgs("job").
+		WillReturnError(sql.ErrNoRows)
+
+	job, err := repo.GetSyncJob(context.Background(), "job")
+
+	assert.NoError(t, err)
+	assert.Nil(t, job)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListSyncJobs(t *testing.T) {
+	pool, mock := setupMockDB(t)
+	defer pool.Close()
+
+	repo := NewPostgresRepository(pool)
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT (.+) FROM sync_jobs WHERE (.+) ORDER BY started_at DESC LIMIT \\$3").
+		WithArgs(int64(0), "456", 20).
+		WillReturnRows(syncJobRows().
+			AddRow("job-2", int64(123), "456", SyncJobRunning, 10, 4, 0, 0, int64(2048), 1, nil, now, nil).
+			AddRow("job-1", int64(123), "456", SyncJobFailed, 5, 0, 0, 0, int64(0), 5, "throttled", now.Add(-time.Hour), now))
+
+	jobs, err := repo.ListSyncJobs(context.Background(), SyncJobFilter{UserID: "456"}, 20)
+
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "job-2", jobs[0].ID)
+	assert.Nil(t, jobs[0].FinishedAt)
+	assert.Equal(t, "throttled", jobs[1].LastError)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,128 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/jaibhavaya/gogo-files/pkg/db"
+	"github.com/jaibhavaya/gogo-files/pkg/onedrive"
+)
+
+// Conflict behaviours decide what happens when a file's destination is taken
+// by an item the last sync didn't upload, such as one the user created or
+// edited in OneDrive.
+const (
+	ConflictReplace = onedrive.ConflictReplace
+	ConflictRename  = onedrive.ConflictRename
+	ConflictFail    = onedrive.ConflictFail
+	// ConflictKeepNewer replaces the item only if the S3 object was modified
+	// after it was.
+	ConflictKeepNewer = "keep-newer"
+)
+
+// Outcomes of a conflict, reported for each item that had one.
+const (
+	ConflictOutcomeReplaced     = "replaced"
+	ConflictOutcomeRenamed      = "renamed"
+	ConflictOutcomeKeptExisting = "kept_existing"
+	ConflictOutcomeRejected     = "rejected"
+)
+
+// ValidConflictBehavior reports whether behavior is a known conflict
+// behaviour. Empty is valid and means the default, ConflictReplace.
+func ValidConflictBehavior(behavior string) bool {
+	switch behavior {
+	case "", ConflictReplace, ConflictRename, ConflictFail, ConflictKeepNewer:
+		return true
+	}
+	return false
+}
+
+// uploadPlan is how a file is uploaded given what is at its destination.
+type uploadPlan struct {
+	// conflictBehavior is passed to Graph with the upload.
+	conflictBehavior string
+	// outcome is reported if the upload succeeds.
+	outcome string
+	// keep is set when the item at the destination is kept instead of
+	// uploading the file.
+	keep *onedrive.DriveItem
+}
+
+// planUpload looks for a conflicting item at the file's destination and
+// applies the file's conflict behaviour to it. With ConflictReplace there is
+// nothing to decide, so the destination isn't looked up.
+func (s *Service) planUpload(ctx context.Context, params SyncFileParams, record *db.File) (uploadPlan, error) {
+	behavior := params.ConflictBehavior
+	if behavior == "" || behavior == ConflictReplace {
+		return uploadPlan{conflictBehavior: ConflictReplace}, nil
+	}
+
+	existing, err := s.onedriveService.GetItem(ctx, params.DriveID, onedrive.ItemRef{Path: path.Join(params.FolderPath, params.FileName)})
+	if isGraphStatus(err, http.StatusNotFound) {
+		// Graph still applies the behaviour if an item appears in the meantime
+		return uploadPlan{conflictBehavior: graphConflictBehavior(behavior)}, nil
+	}
+	if err != nil {
+		return uploadPlan{}, &SyncError{ErrorCodeUpload, fmt.Errorf("couldn't check destination for conflicts: %w", err)}
+	}
+
+	if existing.ID == record.OneDriveItemID && existing.CTag == record.CTag {
+		// the item is the one the last sync uploaded, untouched since
+		return uploadPlan{conflictBehavior: ConflictReplace}, nil
+	}
+
+	switch behavior {
+	case ConflictRename:
+		return uploadPlan{conflictBehavior: ConflictRename, outcome: ConflictOutcomeRenamed}, nil
+
+	case ConflictFail:
+		return uploadPlan{}, &SyncError{ErrorCodeConflict, fmt.Errorf("%s already exists in OneDrive", existing.Path())}
+
+	case ConflictKeepNewer:
+		modified, err := s.lastModified(ctx, params)
+		if err != nil {
+			return uploadPlan{}, &SyncError{ErrorCodeS3Read, fmt.Errorf("couldn't get object: %v", err)}
+		}
+		if existing.LastModifiedDateTime.After(modified) {
+			return uploadPlan{keep: existing}, nil
+		}
+		return uploadPlan{conflictBehavior: ConflictReplace, outcome: ConflictOutcomeReplaced}, nil
+	}
+
+	return uploadPlan{}, fmt.Errorf("unknown conflict behavior %q", behavior)
+}
+
+// graphConflictBehavior maps a conflict behaviour to the one Graph applies.
+// Graph has no keep-newer, so those uploads replace what is there once the
+// comparison has been made.
+func graphConflictBehavior(behavior string) string {
+	if behavior == ConflictKeepNewer {
+		return ConflictReplace
+	}
+	return behavior
+}
+
+// lastModified returns when the S3 object was last modified.
+func (s *Service) lastModified(ctx context.Context, params SyncFileParams) (time.Time, error) {
+	head, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(params.Bucket),
+		Key:    aws.String(params.Key),
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return aws.TimeValue(head.LastModified), nil
+}
+
+// isGraphStatus reports whether err is a Graph error with the given status.
+func isGraphStatus(err error, status int) bool {
+	var graphErr *onedrive.GraphError
+	return errors.As(err, &graphErr) && graphErr.StatusCode == status
+}
@@ -0,0 +1,156 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/jaibhavaya/gogo-files/pkg/db"
+	"github.com/jaibhavaya/gogo-files/pkg/onedrive"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSyncFile_ConflictBehavior(t *testing.T) {
+	s3Modified := time.Date(2025, 5, 20, 10, 0, 0, 0, time.UTC)
+	userItem := &onedrive.DriveItem{ID: "user-item", Name: "test-file.txt", CTag: "user-ctag"}
+	notFound := &onedrive.GraphError{StatusCode: 404, Code: "itemNotFound"}
+
+	tests := []struct {
+		name     string
+		behavior string
+		// record is what the last sync left in the files table
+		record *db.File
+		// existing is the item at the destination, or nil with existingErr
+		existing    *onedrive.DriveItem
+		existingErr error
+		// uploaded is the conflict behaviour passed to Graph, or empty if
+		// nothing should be uploaded
+		uploaded  string
+		errorCode string
+		outcome   string
+	}{
+		{
+			name:     "rename",
+			behavior: ConflictRename,
+			existing: userItem,
+			uploaded: ConflictRename,
+			outcome:  ConflictOutcomeRenamed,
+		},
+		{
+			name:      "fail",
+			behavior:  ConflictFail,
+			existing:  userItem,
+			errorCode: ErrorCodeConflict,
+		},
+		{
+			name:     "keep-newer keeps newer item",
+			behavior: ConflictKeepNewer,
+			existing: &onedrive.DriveItem{ID: "user-item", CTag: "user-ctag", LastModifiedDateTime: s3Modified.Add(time.Hour)},
+			outcome:  ConflictOutcomeKeptExisting,
+		},
+		{
+			name:     "keep-newer replaces older item",
+			behavior: ConflictKeepNewer,
+			existing: &onedrive.DriveItem{ID: "user-item", CTag: "user-ctag", LastModifiedDateTime: s3Modified.Add(-time.Hour)},
+			uploaded: ConflictReplace,
+			outcome:  ConflictOutcomeReplaced,
+		},
+		{
+			name:     "item from the last sync is not a conflict",
+			behavior: ConflictFail,
+			record:   &db.File{Status: db.FileStatusSynced, OneDriveItemID: "user-item", CTag: "user-ctag"},
+			existing: userItem,
+			uploaded: ConflictReplace,
+		},
+		{
+			name:        "nothing at the destination",
+			behavior:    ConflictFail,
+			existingErr: notFound,
+			uploaded:    ConflictFail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3Client := new(MockS3Client)
+			mockOneDriveService := new(MockOneDriveService)
+			mockDBRepo := new(MockDBRepository)
+
+			mockOneDriveService.On("EnsureFolder", "test-drive", "/Documents/Test").Return(nil).Maybe()
+			mockDBRepo.On("GetFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(tt.record, nil)
+			mockDBRepo.On("SaveFile", mock.Anything).Return(nil)
+
+			mockOneDriveService.On("GetItem", "test-drive", onedrive.ItemRef{Path: "/Documents/Test/test-file.txt"}).
+				Return(tt.existing, tt.existingErr)
+			mockS3Client.On("HeadObject", mock.Anything, mock.Anything).
+				Return(&s3.HeadObjectOutput{LastModified: &s3Modified}, nil).Maybe()
+			mockS3Client.On("GetObject", mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{
+				Body:          io.NopCloser(bytes.NewReader([]byte("test file content"))),
+				ContentLength: aws.Int64(17),
+			}, nil).Maybe()
+			mockOneDriveService.On("UploadSmallFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+				Return(&onedrive.DriveItem{ID: "new-item", Name: "test-file 1.txt"}, nil).Maybe()
+
+			service := NewServiceWithDependencies(nil, mockS3Client, mockOneDriveService, mockDBRepo)
+
+			result, err := service.SyncFile(context.Background(), SyncFileParams{
+				OwnerID:          123,
+				Bucket:           "test-bucket",
+				Key:              "test-key",
+				DriveID:          "test-drive",
+				FolderPath:       "/Documents/Test",
+				FileName:         "test-file.txt",
+				ConflictBehavior: tt.behavior,
+			})
+
+			if tt.errorCode != "" {
+				assert.Error(t, err)
+				assert.Equal(t, tt.errorCode, errorCode(err))
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.outcome, result.ConflictOutcome)
+			}
+
+			if tt.uploaded == "" {
+				mockOneDriveService.AssertNotCalled(t, "UploadSmallFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				mockOneDriveService.AssertCalled(t, "UploadSmallFile", "test-drive", "/Documents/Test", "test-file.txt", int64(17), tt.uploaded)
+			}
+		})
+	}
+}
+
+func TestSyncFile_ReplaceSkipsConflictCheck(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockOneDriveService := new(MockOneDriveService)
+	mockDBRepo := new(MockDBRepository)
+	expectNewFile(mockDBRepo)
+
+	mockOneDriveService.On("EnsureFolder", "test-drive", "/Documents/Test").Return(nil)
+	mockS3Client.On("GetObject", mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader([]byte("test file content"))),
+		ContentLength: aws.Int64(17),
+	}, nil)
+	mockOneDriveService.On("UploadSmallFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, ConflictReplace).
+		Return(&onedrive.DriveItem{ID: "onedrive-id"}, nil)
+
+	service := NewServiceWithDependencies(nil, mockS3Client, mockOneDriveService, mockDBRepo)
+
+	result, err := service.SyncFile(context.Background(), SyncFileParams{
+		Bucket:     "test-bucket",
+		Key:        "test-key",
+		DriveID:    "test-drive",
+		FolderPath: "/Documents/Test",
+		FileName:   "test-file.txt",
+	})
+
+	assert.NoError(t, err)
+	assert.Empty(t, result.ConflictOutcome)
+	mockOneDriveService.AssertNotCalled(t, "GetItem", mock.Anything, mock.Anything)
+	mockOneDriveService.AssertExpectations(t)
+}
@@ -12,10 +12,14 @@ import (
 
 type S3ClientInterface interface {
 	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
 }
 
 type OneDriveServiceInterface interface {
-	UploadSmallFile(driveID, folderPath, fileName string, fileContent io.Reader, fileSize int64) error
+	UploadSmallFile(ctx context.Context, driveID, folderPath, fileName string, fileContent io.Reader, fileSize int64, conflictBehavior string) (*onedrive.DriveItem, error)
+	UploadLargeFile(ctx context.Context, params onedrive.UploadLargeFileParams) (*onedrive.DriveItem, error)
+	GetItem(ctx context.Context, driveID string, item onedrive.ItemRef) (*onedrive.DriveItem, error)
+	EnsureFolder(ctx context.Context, driveID, folderPath string) error
 	// Add other OneDrive methods as needed
 }
 
@@ -24,10 +28,13 @@ type Service struct {
 	s3Client        S3ClientInterface
 	onedriveService OneDriveServiceInterface
 	dbRepository    db.Repository
+	// driveID is the owner's default drive, used when a sync doesn't name
+	// one.
+	driveID string
 }
 
 func NewService(onedriveIntegration *db.OneDriveIntegration, dbPool *db.Pool, cfg config.Config) *Service {
-	s3Client := newS3Client(cfg.AWSRegion, cfg.S3Endpoint, cfg.AWSAccessKey, cfg.AWSSecretKey, "")
+	s3Client := newS3Client(cfg.AWSRegion, cfg.S3Endpoint, cfg.AWSAccessKey, cfg.AWSSecretKey, "", cfg.S3TimeoutDuration())
 	onedriveService := onedrive.NewService(onedriveIntegration, dbPool, cfg)
 	dbRepository := db.NewPostgresRepository(dbPool)
 
@@ -36,6 +43,7 @@ func NewService(onedriveIntegration *db.OneDriveIntegration, dbPool *db.Pool, cf
 		s3Client:        s3Client,
 		onedriveService: onedriveService,
 		dbRepository:    dbRepository,
+		driveID:         onedriveIntegration.DriveID,
 	}
 }
 
@@ -51,4 +59,4 @@ func NewServiceWithDependencies(
 		onedriveService: onedriveService,
 		dbRepository:    dbRepository,
 	}
-}
\ No newline at end of file
+}
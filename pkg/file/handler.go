@@ -1,11 +1,15 @@
 package file
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"sync"
+	"path"
+	"time"
 
 	"github.com/jaibhavaya/gogo-files/pkg/config"
 	"github.com/jaibhavaya/gogo-files/pkg/db"
+	"github.com/jaibhavaya/gogo-files/pkg/onedrive"
 )
 
 type Item interface {
@@ -20,64 +24,212 @@ type Item interface {
 type SyncHandler struct {
 	OwnerID int64
 	UserID  string
+	DriveID string
 	Items   []Item
+	// ConflictBehavior overrides the owner's conflict behaviour for this
+	// sync.
+	ConflictBehavior string
+	// JobID identifies the sync across redeliveries of its message, and its
+	// progress is tracked as a sync job under it. Syncs with more items than
+	// the configured threshold are split into work items tracked under it
+	// too, so a redelivery only syncs the items that haven't finished.
+	JobID string
 
 	DbPool *db.Pool
 	Config config.Config
+
+	// Results holds the outcome of every item once Handle returns.
+	Results []FileResult
 }
 
+const (
+	StatusSynced    = "synced"
+	StatusUnchanged = "unchanged"
+	StatusSkipped   = "skipped"
+	StatusFailed    = "failed"
+)
+
+// FileResult is the outcome of syncing a single item.
 type FileResult struct {
-	msg string
-	// definitely will have more, just a placeholder
+	ItemID       string
+	Name         string
+	Path         string
+	S3Key        string
+	Size         int64
+	LastModified time.Time
+	OneDriveID   string
+	Status       string
+	ErrorCode    string
+	Error        string
+	// GraphErrorCode and RequestID identify the Graph failure, if there was
+	// one, for raising with Microsoft support.
+	GraphErrorCode string
+	RequestID      string
+	// ConflictOutcome is how a conflict at the destination was resolved.
+	ConflictOutcome string
+
+	err error
+}
+
+// destinationPath splits an item's OneDrive path into the folder to upload
+// into and the file name to upload as. Path may be either the full path of
+// the file or the folder it belongs in; when Name is empty the last segment
+// of Path is used. Both are sanitised for OneDrive.
+func destinationPath(item Item) (string, string) {
+	itemPath := path.Clean("/" + item.Path())
+	folderPath, name := itemPath, item.Name()
+
+	switch {
+	case name == "":
+		folderPath, name = path.Dir(itemPath), path.Base(itemPath)
+	case path.Base(itemPath) == name:
+		folderPath = path.Dir(itemPath)
+	}
+
+	return onedrive.SanitizePath(folderPath), onedrive.SanitizeName(name)
 }
 
 func processItem(
+	ctx context.Context,
+	ownerID int64,
+	driveID string,
+	conflictBehavior string,
 	item Item,
 	service Service,
-	results chan<- FileResult,
-) {
+) FileResult {
 	bucket := item.Bucket()
 	key := item.Key()
-	path := item.Path()
+	folderPath, fileName := destinationPath(item)
+
+	fmt.Printf("Syncing File\nbucket: %v\n  key: %v\n    path: %v/%v\n", bucket, key, folderPath, fileName)
 
-	fmt.Printf("Syncing File\nbucket: %v\n  key: %v\n    path: %v\n", bucket, key, path)
+	result := FileResult{
+		ItemID: item.ID(),
+		Name:   fileName,
+		Path:   path.Join(folderPath, fileName),
+		S3Key:  key,
+		Size:   int64(item.Size()),
+	}
 
-	err := service.SyncFile(SyncFileParams{Bucket: bucket, Key: key})
+	synced, err := service.SyncFile(ctx, SyncFileParams{
+		OwnerID:          ownerID,
+		Bucket:           bucket,
+		Key:              key,
+		DriveID:          driveID,
+		FolderPath:       folderPath,
+		FileName:         fileName,
+		ConflictBehavior: conflictBehavior,
+	})
 	if err != nil {
-		results <- FileResult{fmt.Sprintf("failed to sync file: %v in bucket: %v because: %v", key, bucket, err)}
+		fmt.Printf("failed to sync file: %v in bucket: %v because: %v\n", key, bucket, err)
+		result.Status = StatusFailed
+		result.ErrorCode = errorCode(err)
+		result.Error = err.Error()
+		result.err = err
+		if result.ErrorCode == ErrorCodeConflict {
+			result.ConflictOutcome = ConflictOutcomeRejected
+		}
+
+		var graphErr *onedrive.GraphError
+		if errors.As(err, &graphErr) {
+			result.GraphErrorCode = graphErr.Code
+			result.RequestID = graphErr.RequestID
+		}
+		return result
 	}
 
-	results <- FileResult{fmt.Sprintf("successfully synced file: %v in bucket: %v", key, bucket)}
+	result.Status = StatusSynced
+	if synced.Unchanged {
+		result.Status = StatusUnchanged
+	}
+	if synced.ConflictOutcome == ConflictOutcomeKeptExisting {
+		result.Status = StatusSkipped
+	}
+	result.ConflictOutcome = synced.ConflictOutcome
+
+	driveItem := synced.Item
+	result.OneDriveID = driveItem.ID
+	result.Name = driveItem.Name
+	result.Path = driveItem.Path()
+	result.Size = driveItem.Size
+	result.LastModified = driveItem.LastModifiedDateTime
+	return result
 }
 
-func (h SyncHandler) Handle() error {
+// Handle syncs every item and records the results. Items that fail for good
+// are reported in Results; if any failed in a way that may succeed on a later
+// attempt, Handle returns an error so the message is retried. Cancelling ctx
+// aborts the uploads still in progress. The progress of the sync is tracked
+// as a sync job under JobID, which is finished once every item has an
+// outcome.
+func (h *SyncHandler) Handle(ctx context.Context) error {
 	fmt.Printf("Handling file sync request for owner: %d\n", h.OwnerID)
 
-	onedriveIntegration, err := db.GetOneDriveIntegration(h.DbPool, h.OwnerID)
+	h.startJob(ctx)
+
+	onedriveIntegration, err := db.GetOneDriveIntegration(ctx, h.DbPool, h.OwnerID)
 	if err != nil {
 		return fmt.Errorf("failed to get onedrive integration: %v", err)
 	}
+	if onedriveIntegration == nil {
+		return fmt.Errorf("%w for owner: %d", db.ErrNoOneDriveIntegration, h.OwnerID)
+	}
 
 	fileService := NewService(onedriveIntegration, h.DbPool, h.Config)
 
-	results := make(chan FileResult, len(h.Items))
-	wg := sync.WaitGroup{}
-	for _, item := range h.Items {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			processItem(item, *fileService, results)
-		}()
+	conflictBehavior := h.ConflictBehavior
+	if conflictBehavior == "" {
+		conflictBehavior = onedriveIntegration.ConflictBehavior
+	}
+
+	syncItem := func(item Item) FileResult {
+		result := processItem(ctx, h.OwnerID, h.DriveID, conflictBehavior, item, *fileService)
+		h.addJobProgress(ctx, itemProgress(result))
+		return result
 	}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
+	if h.Split() {
+		h.Results, err = h.syncWorkItems(ctx, syncItem)
+		if err != nil {
+			return fmt.Errorf("failed to sync job %s: %w", h.JobID, err)
+		}
+	} else {
+		h.Results = make([]FileResult, len(h.Items))
+		forEach(ctx, len(h.Items), h.Config.FileSyncWorkerCount(), func(i int) {
+			h.Results[i] = syncItem(h.Items[i])
+		})
+	}
+
+	var retryable []error
+	var revoked error
+	for _, result := range h.Results {
+		fmt.Printf("Got result for %s: %s\n", result.S3Key, result.Status)
+
+		if onedrive.IsRetryable(result.err) {
+			retryable = append(retryable, result.err)
+		}
+		if onedrive.IsAuthorizationRevoked(result.err) {
+			revoked = result.err
+		}
+	}
 
-	for result := range results {
-		fmt.Println("Got result: ", result)
+	// items cut short by shutdown are finished when the message is redelivered
+	if ctx.Err() != nil {
+		return fmt.Errorf("file sync interrupted: %w", ctx.Err())
 	}
 
-	return err
+	// nothing syncs until the owner authorizes OneDrive again
+	if revoked != nil {
+		return fmt.Errorf("OneDrive authorization revoked for owner %d: %w", h.OwnerID, revoked)
+	}
+
+	// uploads replace what is already there, so the whole batch can be sent
+	// again; split syncs only sync the items that haven't finished
+	if len(retryable) > 0 {
+		return fmt.Errorf("%d of %d items failed and can be retried: %w", len(retryable), len(h.Items), errors.Join(retryable...))
+	}
+
+	h.finishJob(ctx)
+
+	return nil
 }
@@ -0,0 +1,41 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testItem struct {
+	name string
+	path string
+}
+
+func (i testItem) Bucket() string { return "test-bucket" }
+func (i testItem) Key() string    { return "test-key" }
+func (i testItem) ID() string     { return "test-id" }
+func (i testItem) Name() string   { return i.name }
+func (i testItem) Path() string   { return i.path }
+func (i testItem) Size() int      { return 0 }
+
+func TestDestinationPath(t *testing.T) {
+	tests := []struct {
+		item       testItem
+		folderPath string
+		fileName   string
+	}{
+		{testItem{name: "Contract.docx", path: "/Documents/Contracts/Contract.docx"}, "/Documents/Contracts", "Contract.docx"},
+		{testItem{name: "Contract.docx", path: "/Documents/Contracts"}, "/Documents/Contracts", "Contract.docx"},
+		{testItem{name: "Contract.docx", path: "Documents/Contracts/"}, "/Documents/Contracts", "Contract.docx"},
+		{testItem{path: "/Documents/Contracts/Contract.docx"}, "/Documents/Contracts", "Contract.docx"},
+		{testItem{name: "Contract.docx"}, "/", "Contract.docx"},
+		{testItem{name: "Q1: Report?.pdf", path: "/Clients/CON/"}, "/Clients/CON_", "Q1： Report？.pdf"},
+	}
+
+	for _, test := range tests {
+		folderPath, fileName := destinationPath(test.item)
+
+		assert.Equal(t, test.folderPath, folderPath, "path %q name %q", test.item.path, test.item.name)
+		assert.Equal(t, test.fileName, fileName, "path %q name %q", test.item.path, test.item.name)
+	}
+}
@@ -0,0 +1,84 @@
+package file
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jaibhavaya/gogo-files/pkg/db"
+)
+
+// The sync job of a handler is tracked in the database so its progress can
+// be looked up while and after it runs. Tracking is best effort: failures are
+// logged rather than failing the sync.
+
+// startJob records that a delivery of the sync has started.
+func (h *SyncHandler) startJob(ctx context.Context) {
+	if h.JobID == "" {
+		return
+	}
+
+	err := db.StartSyncJob(ctx, h.DbPool, &db.SyncJob{
+		ID:         h.JobID,
+		OwnerID:    h.OwnerID,
+		UserID:     h.UserID,
+		TotalItems: len(h.Items),
+	})
+	if err != nil {
+		fmt.Printf("failed to start sync job %s: %v\n", h.JobID, err)
+	}
+}
+
+// addJobProgress adds the outcome of some items to the job's counts, even if
+// ctx has been cancelled since.
+func (h *SyncHandler) addJobProgress(ctx context.Context, progress db.SyncJobProgress) {
+	if h.JobID == "" {
+		return
+	}
+
+	if err := db.AddSyncJobProgress(context.WithoutCancel(ctx), h.DbPool, h.JobID, progress); err != nil {
+		fmt.Printf("failed to save progress of sync job %s: %v\n", h.JobID, err)
+	}
+}
+
+// finishJob gives the job its terminal status once every item has an outcome.
+func (h *SyncHandler) finishJob(ctx context.Context) {
+	if h.JobID == "" {
+		return
+	}
+
+	if err := db.FinishSyncJob(context.WithoutCancel(ctx), h.DbPool, h.JobID, jobStatus(h.Results), ""); err != nil {
+		fmt.Printf("failed to finish sync job %s: %v\n", h.JobID, err)
+	}
+}
+
+// itemProgress is the progress a job makes with an item's outcome. Only
+// synced items transfer bytes.
+func itemProgress(result FileResult) db.SyncJobProgress {
+	switch result.Status {
+	case StatusSynced:
+		return db.SyncJobProgress{Succeeded: 1, BytesTransferred: result.Size}
+	case StatusUnchanged:
+		return db.SyncJobProgress{Succeeded: 1}
+	case StatusSkipped:
+		return db.SyncJobProgress{Skipped: 1}
+	}
+	return db.SyncJobProgress{Failed: 1}
+}
+
+// jobStatus is the terminal status of a job with these results.
+func jobStatus(results []FileResult) string {
+	failed := 0
+	for _, result := range results {
+		if result.Status == StatusFailed {
+			failed++
+		}
+	}
+
+	switch {
+	case failed == 0:
+		return db.SyncJobSucceeded
+	case failed == len(results):
+		return db.SyncJobFailed
+	}
+	return db.SyncJobPartiallyFailed
+}
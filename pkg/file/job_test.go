@@ -0,0 +1,35 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/jaibhavaya/gogo-files/pkg/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItemProgress(t *testing.T) {
+	tests := []struct {
+		status   string
+		progress db.SyncJobProgress
+	}{
+		{StatusSynced, db.SyncJobProgress{Succeeded: 1, BytesTransferred: 2048}},
+		{StatusUnchanged, db.SyncJobProgress{Succeeded: 1}},
+		{StatusSkipped, db.SyncJobProgress{Skipped: 1}},
+		{StatusFailed, db.SyncJobProgress{Failed: 1}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.progress, itemProgress(FileResult{Status: test.status, Size: 2048}), test.status)
+	}
+}
+
+func TestJobStatus(t *testing.T) {
+	synced := FileResult{Status: StatusSynced}
+	skipped := FileResult{Status: StatusSkipped}
+	failed := FileResult{Status: StatusFailed}
+
+	assert.Equal(t, db.SyncJobSucceeded, jobStatus([]FileResult{synced, skipped}))
+	assert.Equal(t, db.SyncJobPartiallyFailed, jobStatus([]FileResult{synced, failed}))
+	assert.Equal(t, db.SyncJobFailed, jobStatus([]FileResult{failed, failed}))
+	assert.Equal(t, db.SyncJobSucceeded, jobStatus(nil))
+}
@@ -2,7 +2,11 @@ package file
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -10,11 +14,13 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
-// Creates a new S3 client that implements S3ClientInterface
-func newS3Client(region, endpoint, key, secret, session string) S3ClientInterface {
+// Creates a new S3 client that implements S3ClientInterface. Requests that
+// take longer than timeout, including reading the body, are cancelled.
+func newS3Client(region, endpoint, key, secret, session string, timeout time.Duration) S3ClientInterface {
 	cfg, err := config.LoadDefaultConfig(context.TODO(),
 		// TODO investigate what to use for production config
 		config.WithRegion(region),
+		config.WithHTTPClient(&http.Client{Timeout: timeout}),
 		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
 			key, secret, session),
 		),
@@ -27,4 +33,36 @@ func newS3Client(region, endpoint, key, secret, session string) S3ClientInterfac
 		o.BaseEndpoint = aws.String(endpoint)
 		o.UsePathStyle = true // special for localstack, check what's needed for production
 	})
-}
\ No newline at end of file
+}
+
+// s3RangeSource lets an upload session read an S3 object from any offset. The
+// body of the initial GetObject is reused for offset zero, and later ranges are
+// pinned to the same ETag so a resumed upload can't mix two object versions.
+type s3RangeSource struct {
+	s3Client S3ClientInterface
+	bucket   string
+	key      string
+	etag     *string
+	body     io.ReadCloser
+}
+
+func (r *s3RangeSource) OpenRange(ctx context.Context, offset int64) (io.ReadCloser, error) {
+	if offset == 0 && r.body != nil {
+		body := r.body
+		r.body = nil
+		// the caller of GetObject still owns closing the original body
+		return io.NopCloser(body), nil
+	}
+
+	object, err := r.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(r.bucket),
+		Key:     aws.String(r.key),
+		Range:   aws.String(fmt.Sprintf("bytes=%d-", offset)),
+		IfMatch: r.etag,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get object range from byte %d: %v", offset, err)
+	}
+
+	return object.Body, nil
+}
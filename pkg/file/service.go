@@ -2,51 +2,346 @@ package file
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/jaibhavaya/gogo-files/pkg/db"
+	"github.com/jaibhavaya/gogo-files/pkg/onedrive"
 )
 
 const FOUR_MB int64 = 4 * 1024 * 1024
 
+// Error codes reported for items that fail to sync
+const (
+	ErrorCodeS3Read    = "s3_read_failed"
+	ErrorCodeUpload    = "upload_failed"
+	ErrorCodeIntegrity = "integrity_check_failed"
+	ErrorCodeConflict  = "conflict"
+	ErrorCodeFolder    = "folder_create_failed"
+	ErrorCodeNoDrive   = "drive_unknown"
+	ErrorCodeUnknown   = "unknown"
+)
+
+// SyncError is returned by SyncFile and carries a code describing which step
+// of the sync failed.
+type SyncError struct {
+	Code string
+	Err  error
+}
+
+func (e *SyncError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SyncError) Unwrap() error {
+	return e.Err
+}
+
+// errorCode returns the code of a SyncError, or ErrorCodeUnknown.
+func errorCode(err error) string {
+	var syncErr *SyncError
+	if errors.As(err, &syncErr) {
+		return syncErr.Code
+	}
+	return ErrorCodeUnknown
+}
+
+// uploadErrorCode returns the code for a failed upload, telling uploads that
+// arrived corrupted or were refused because the destination was taken apart
+// from ones that didn't arrive.
+func uploadErrorCode(err error) string {
+	var integrityErr *onedrive.IntegrityError
+	if errors.As(err, &integrityErr) {
+		return ErrorCodeIntegrity
+	}
+	if isGraphStatus(err, http.StatusConflict) {
+		return ErrorCodeConflict
+	}
+	return ErrorCodeUpload
+}
+
 type SyncFileParams struct {
-	Bucket     string
-	Key        string
+	OwnerID int64
+	Bucket  string
+	Key     string
+	// DriveID defaults to the owner's drive, as discovered when they
+	// authorized.
 	DriveID    string
 	FolderPath string
 	FileName   string
+	// ConflictBehavior applies when the destination is taken by an item the
+	// last sync didn't upload. It defaults to ConflictReplace.
+	ConflictBehavior string
+}
+
+// SyncResult is the outcome of a successful SyncFile.
+type SyncResult struct {
+	Item *onedrive.DriveItem
+	// Unchanged is set when the upload was skipped because neither the S3
+	// object nor the OneDrive item has changed since the last sync.
+	Unchanged bool
+	// ConflictOutcome is how a conflict at the destination was resolved, or
+	// empty if there was none.
+	ConflictOutcome string
+}
+
+// SyncFile copies an S3 object to OneDrive and returns the resulting item, or
+// the item already there if the conflict behaviour kept it. Errors are
+// returned as *SyncError so callers can report what went wrong. Each attempt
+// is recorded in the files table, even if ctx is cancelled.
+func (s *Service) SyncFile(ctx context.Context, params SyncFileParams) (*SyncResult, error) {
+	if params.DriveID == "" {
+		params.DriveID = s.driveID
+	}
+	if params.DriveID == "" {
+		return nil, &SyncError{ErrorCodeNoDrive, fmt.Errorf("no drive_id given and none discovered for owner: %d", params.OwnerID)}
+	}
+
+	record := s.loadFile(ctx, params)
+
+	if item := s.unchangedItem(ctx, params, record); item != nil {
+		log.Printf("%s is unchanged since it was last synced, skipping upload", params.Key)
+		return &SyncResult{Item: item, Unchanged: true}, nil
+	}
+
+	plan, err := s.planUpload(ctx, params, record)
+	if err == nil && plan.keep != nil {
+		log.Printf("%s in OneDrive was modified after %s, keeping it", plan.keep.Path(), params.Key)
+		return &SyncResult{Item: plan.keep, ConflictOutcome: ConflictOutcomeKeptExisting}, nil
+	}
+
+	record.Attempts++
+
+	var item *onedrive.DriveItem
+	if err == nil {
+		item, err = s.syncFile(ctx, params, record, plan.conflictBehavior)
+	}
+	if err != nil {
+		record.Status = db.FileStatusFailed
+		record.LastError = err.Error()
+		s.saveFile(ctx, record)
+		return nil, err
+	}
+
+	now := time.Now()
+	record.Status = db.FileStatusSynced
+	record.OneDriveItemID = item.ID
+	record.CTag = item.CTag
+	record.LastError = ""
+	record.SyncedAt = &now
+	s.saveFile(ctx, record)
+
+	outcome := plan.outcome
+	if plan.conflictBehavior == ConflictRename && item.Name != "" && item.Name != params.FileName {
+		outcome = ConflictOutcomeRenamed
+	}
+
+	return &SyncResult{Item: item, ConflictOutcome: outcome}, nil
+}
+
+// unchangedItem returns the OneDrive item a file was last synced to, if the
+// S3 object still has the ETag, size and last-modified time that were
+// uploaded and the OneDrive item still has the content that was uploaded to
+// it. Otherwise, or if either can't be checked, it returns nil.
+func (s *Service) unchangedItem(ctx context.Context, params SyncFileParams, record *db.File) *onedrive.DriveItem {
+	if record.Status != db.FileStatusSynced || record.OneDriveItemID == "" || record.ETag == "" || record.CTag == "" {
+		return nil
+	}
+
+	head, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(params.Bucket),
+		Key:    aws.String(params.Key),
+	})
+	if err != nil {
+		log.Printf("Failed to check %s for changes: %v", params.Key, err)
+		return nil
+	}
+	if aws.StringValue(head.ETag) != record.ETag ||
+		aws.Int64Value(head.ContentLength) != record.Size ||
+		record.LastModified == nil || !aws.TimeValue(head.LastModified).Equal(*record.LastModified) {
+		return nil
+	}
+
+	item, err := s.onedriveService.GetItem(ctx, params.DriveID, onedrive.ItemRef{ID: record.OneDriveItemID})
+	if err != nil {
+		log.Printf("Failed to check OneDrive item %s for changes: %v", record.OneDriveItemID, err)
+		return nil
+	}
+	if item.CTag != record.CTag || item.Size != record.Size {
+		return nil
+	}
+
+	return item
 }
 
-func (s *Service) SyncFile(params SyncFileParams) error {
-	file, err := s.s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+func (s *Service) syncFile(ctx context.Context, params SyncFileParams, record *db.File, conflictBehavior string) (*onedrive.DriveItem, error) {
+	file, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(params.Bucket),
 		Key:    aws.String(params.Key),
 	})
 	if err != nil {
-		return fmt.Errorf("couldn't get object: %v", err)
+		return nil, &SyncError{ErrorCodeS3Read, fmt.Errorf("couldn't get object: %v", err)}
 	}
 
 	defer file.Body.Close()
 
+	err = s.onedriveService.EnsureFolder(ctx, params.DriveID, params.FolderPath)
+	if err != nil {
+		return nil, &SyncError{ErrorCodeFolder, err}
+	}
+
+	record.Status = db.FileStatusUploading
+	record.ETag = aws.StringValue(file.ETag)
+	record.VersionID = aws.StringValue(file.VersionId)
+	record.Size = aws.Int64Value(file.ContentLength)
+	record.LastModified = file.LastModified
+	s.saveFile(ctx, record)
+
 	size := *file.ContentLength
 
+	var item *onedrive.DriveItem
 	if size < FOUR_MB {
-		fmt.Println("Under four mb! sync normally")
-		err = s.onedriveService.UploadSmallFile(
+		item, err = s.onedriveService.UploadSmallFile(
+			ctx,
 			params.DriveID,
 			params.FolderPath,
 			params.FileName,
 			file.Body,
 			*file.ContentLength,
+			conflictBehavior,
 		)
 		if err != nil {
-			return fmt.Errorf("failed to upload small file: %w", err)
+			return nil, &SyncError{uploadErrorCode(err), fmt.Errorf("failed to upload small file: %w", err)}
 		}
 	} else {
-		fmt.Println("Over 4mb! stream sync this bad boy!")
-		// TODO: Implement large file upload
+		log.Printf("Streaming %s (%d bytes) through an upload session", params.Key, size)
+		source := &s3RangeSource{
+			s3Client: s.s3Client,
+			bucket:   params.Bucket,
+			key:      params.Key,
+			etag:     file.ETag,
+			body:     file.Body,
+		}
+		etag := aws.StringValue(file.ETag)
+		item, err = s.onedriveService.UploadLargeFile(ctx, onedrive.UploadLargeFileParams{
+			DriveID:          params.DriveID,
+			FolderPath:       params.FolderPath,
+			FileName:         params.FileName,
+			Source:           source,
+			FileSize:         size,
+			ConflictBehavior: conflictBehavior,
+			Session:          s.findUploadSession(ctx, params, etag),
+			OnProgress: func(session onedrive.UploadSession, committed int64) {
+				s.saveUploadSession(ctx, params, etag, session, committed)
+			},
+		})
+		if errors.Is(err, context.Canceled) {
+			// the session was cancelled with the upload, so it can't be resumed
+			s.clearUploadSession(ctx, params)
+		}
+		if err != nil {
+			return nil, &SyncError{uploadErrorCode(err), fmt.Errorf("failed to upload large file: %w", err)}
+		}
+
+		s.clearUploadSession(ctx, params)
+	}
+
+	return item, nil
+}
+
+// clearUploadSession forgets the upload session stored for a file.
+func (s *Service) clearUploadSession(ctx context.Context, params SyncFileParams) {
+	err := s.dbRepository.DeleteUploadSession(context.WithoutCancel(ctx), params.OwnerID, params.Bucket, params.Key, params.destination())
+	if err != nil {
+		log.Printf("Failed to clear upload session for %s: %v", params.Key, err)
+	}
+}
+
+// destination identifies where in OneDrive the file is going, for keying
+// persisted upload sessions
+func (p SyncFileParams) destination() string {
+	return p.DriveID + ":" + path.Join("/", p.FolderPath, p.FileName)
+}
+
+// findUploadSession returns the upload session a previous attempt left behind
+// for this file, discarding it if it has expired or the S3 object has changed
+// since it was started.
+func (s *Service) findUploadSession(ctx context.Context, params SyncFileParams, etag string) *onedrive.UploadSession {
+	record, err := s.dbRepository.GetUploadSession(ctx, params.OwnerID, params.Bucket, params.Key, params.destination())
+	if err != nil {
+		log.Printf("Failed to look up upload session for %s: %v", params.Key, err)
+		return nil
+	}
+	if record == nil {
+		return nil
+	}
+
+	if !record.ExpiresAt.After(time.Now()) || record.ETag != etag {
+		log.Printf("Discarding stale upload session for %s", params.Key)
+		err = s.dbRepository.DeleteUploadSession(ctx, params.OwnerID, params.Bucket, params.Key, params.destination())
+		if err != nil {
+			log.Printf("Failed to clear upload session for %s: %v", params.Key, err)
+		}
+		return nil
 	}
 
-	return nil
-}
\ No newline at end of file
+	log.Printf("Resuming upload session for %s (%d bytes committed)", params.Key, record.BytesCommitted)
+	return &onedrive.UploadSession{
+		UploadURL:          record.UploadURL,
+		ExpirationDateTime: record.ExpiresAt,
+	}
+}
+
+// saveUploadSession records how far an upload got, even if ctx has been
+// cancelled, so the next attempt can resume it.
+func (s *Service) saveUploadSession(ctx context.Context, params SyncFileParams, etag string, session onedrive.UploadSession, committed int64) {
+	err := s.dbRepository.SaveUploadSession(context.WithoutCancel(ctx), &db.UploadSession{
+		OwnerID:        params.OwnerID,
+		Bucket:         params.Bucket,
+		Key:            params.Key,
+		Destination:    params.destination(),
+		UploadURL:      session.UploadURL,
+		ExpiresAt:      session.ExpirationDateTime,
+		BytesCommitted: committed,
+		ETag:           etag,
+	})
+	if err != nil {
+		log.Printf("Failed to save upload session for %s: %v", params.Key, err)
+	}
+}
+
+// loadFile returns the recorded sync state of the file, or a new record if it
+// has none.
+func (s *Service) loadFile(ctx context.Context, params SyncFileParams) *db.File {
+	record, err := s.dbRepository.GetFile(ctx, params.OwnerID, params.Bucket, params.Key, params.destination())
+	if err != nil {
+		log.Printf("Failed to look up sync state for %s: %v", params.Key, err)
+	}
+	if record == nil {
+		record = &db.File{
+			OwnerID:     params.OwnerID,
+			Bucket:      params.Bucket,
+			Key:         params.Key,
+			Destination: params.destination(),
+			Status:      db.FileStatusPending,
+		}
+	}
+
+	record.Name = params.FileName
+	record.DriveID = params.DriveID
+	return record
+}
+
+// saveFile records the sync state of the file, even if ctx has been
+// cancelled.
+func (s *Service) saveFile(ctx context.Context, record *db.File) {
+	if err := s.dbRepository.SaveFile(context.WithoutCancel(ctx), record); err != nil {
+		log.Printf("Failed to save sync state for %s: %v", record.Key, err)
+	}
+}
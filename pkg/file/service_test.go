@@ -6,10 +6,12 @@ import (
 	"errors"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/jaibhavaya/gogo-files/pkg/db"
+	"github.com/jaibhavaya/gogo-files/pkg/onedrive"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -26,20 +28,52 @@ func (m *MockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput,
 	return args.Get(0).(*s3.GetObjectOutput), args.Error(1)
 }
 
+func (m *MockS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	args := m.Called(ctx, params)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.HeadObjectOutput), args.Error(1)
+}
+
 type MockOneDriveService struct {
 	mock.Mock
 }
 
-func (m *MockOneDriveService) UploadSmallFile(driveID, folderPath, fileName string, fileContent io.Reader, fileSize int64) error {
-	args := m.Called(driveID, folderPath, fileName, fileSize)
+func (m *MockOneDriveService) UploadSmallFile(ctx context.Context, driveID, folderPath, fileName string, fileContent io.Reader, fileSize int64, conflictBehavior string) (*onedrive.DriveItem, error) {
+	args := m.Called(driveID, folderPath, fileName, fileSize, conflictBehavior)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*onedrive.DriveItem), args.Error(1)
+}
+
+func (m *MockOneDriveService) UploadLargeFile(ctx context.Context, params onedrive.UploadLargeFileParams) (*onedrive.DriveItem, error) {
+	args := m.Called(params)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*onedrive.DriveItem), args.Error(1)
+}
+
+func (m *MockOneDriveService) EnsureFolder(ctx context.Context, driveID, folderPath string) error {
+	args := m.Called(driveID, folderPath)
 	return args.Error(0)
 }
 
+func (m *MockOneDriveService) GetItem(ctx context.Context, driveID string, item onedrive.ItemRef) (*onedrive.DriveItem, error) {
+	args := m.Called(driveID, item)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*onedrive.DriveItem), args.Error(1)
+}
+
 type MockDBRepository struct {
 	mock.Mock
 }
 
-func (m *MockDBRepository) GetOneDriveIntegration(ownerID int64) (*db.OneDriveIntegration, error) {
+func (m *MockDBRepository) GetOneDriveIntegration(ctx context.Context, ownerID int64) (*db.OneDriveIntegration, error) {
 	args := m.Called(ownerID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -47,20 +81,70 @@ func (m *MockDBRepository) GetOneDriveIntegration(ownerID int64) (*db.OneDriveIn
 	return args.Get(0).(*db.OneDriveIntegration), args.Error(1)
 }
 
-func (m *MockDBRepository) SaveOneDriveRefreshToken(ownerID int64, userID, refreshToken string) error {
+func (m *MockDBRepository) SaveOneDriveRefreshToken(ctx context.Context, ownerID int64, userID, refreshToken string) error {
 	args := m.Called(ownerID, userID, refreshToken)
 	return args.Error(0)
 }
 
-func (m *MockDBRepository) GetOneDriveRefreshToken(ownerID int64) (string, error) {
+func (m *MockDBRepository) GetOneDriveRefreshToken(ctx context.Context, ownerID int64) (string, error) {
 	args := m.Called(ownerID)
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockDBRepository) RotateOneDriveRefreshToken(ctx context.Context, ownerID int64, previousToken, newToken string) (bool, error) {
+	args := m.Called(ownerID, previousToken, newToken)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockDBRepository) GetUploadSession(ctx context.Context, ownerID int64, bucket, key, destination string) (*db.UploadSession, error) {
+	args := m.Called(ownerID, bucket, key, destination)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*db.UploadSession), args.Error(1)
+}
+
+func (m *MockDBRepository) SaveUploadSession(ctx context.Context, session *db.UploadSession) error {
+	args := m.Called(session)
+	return args.Error(0)
+}
+
+func (m *MockDBRepository) DeleteUploadSession(ctx context.Context, ownerID int64, bucket, key, destination string) error {
+	args := m.Called(ownerID, bucket, key, destination)
+	return args.Error(0)
+}
+
+func (m *MockDBRepository) GetFile(ctx context.Context, ownerID int64, bucket, key, destination string) (*db.File, error) {
+	args := m.Called(ownerID, bucket, key, destination)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*db.File), args.Error(1)
+}
+
+func (m *MockDBRepository) SaveFile(ctx context.Context, file *db.File) error {
+	args := m.Called(file)
+	return args.Error(0)
+}
+
+// expectNewFile sets up a file with no recorded sync state, and returns the
+// states it is saved in, in order.
+func expectNewFile(mockDBRepo *MockDBRepository) *[]db.File {
+	var saved []db.File
+	mockDBRepo.On("GetFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	mockDBRepo.On("SaveFile", mock.Anything).Run(func(args mock.Arguments) {
+		saved = append(saved, *args.Get(0).(*db.File))
+	}).Return(nil)
+	return &saved
+}
+
 func TestSyncFile_SmallFile_Success(t *testing.T) {
 	mockS3Client := new(MockS3Client)
 	mockOneDriveService := new(MockOneDriveService)
 	mockDBRepo := new(MockDBRepository)
+	expectNewFile(mockDBRepo)
+
+	mockOneDriveService.On("EnsureFolder", "test-drive", "/Documents/Test").Return(nil)
 
 	testContent := []byte("test file content")
 	testContentReader := io.NopCloser(bytes.NewReader(testContent))
@@ -83,7 +167,8 @@ func TestSyncFile_SmallFile_Success(t *testing.T) {
 		"/Documents/Test",
 		"test-file.txt",
 		contentLength,
-	).Return(nil)
+		ConflictReplace,
+	).Return(&onedrive.DriveItem{ID: "onedrive-id", Name: "test-file.txt"}, nil)
 
 	service := NewServiceWithDependencies(
 		nil,
@@ -100,9 +185,11 @@ func TestSyncFile_SmallFile_Success(t *testing.T) {
 		FileName:   "test-file.txt",
 	}
 
-	err := service.SyncFile(params)
+	result, err := service.SyncFile(context.Background(), params)
 
 	assert.NoError(t, err)
+	assert.Equal(t, "onedrive-id", result.Item.ID)
+	assert.False(t, result.Unchanged)
 	mockS3Client.AssertExpectations(t)
 	mockOneDriveService.AssertExpectations(t)
 }
@@ -111,6 +198,7 @@ func TestSyncFile_S3Error(t *testing.T) {
 	mockS3Client := new(MockS3Client)
 	mockOneDriveService := new(MockOneDriveService)
 	mockDBRepo := new(MockDBRepository)
+	expectNewFile(mockDBRepo)
 
 	expectedErr := errors.New("s3 error")
 	mockS3Client.On("GetObject", mock.Anything, mock.Anything).Return(nil, expectedErr)
@@ -130,10 +218,11 @@ func TestSyncFile_S3Error(t *testing.T) {
 		FileName:   "test-file.txt",
 	}
 
-	err := service.SyncFile(params)
+	_, err := service.SyncFile(context.Background(), params)
 
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "couldn't get object")
+	assert.Equal(t, ErrorCodeS3Read, errorCode(err))
 	mockS3Client.AssertExpectations(t)
 	mockOneDriveService.AssertNotCalled(t, "UploadSmallFile")
 }
@@ -142,6 +231,9 @@ func TestSyncFile_OneDriveError(t *testing.T) {
 	mockS3Client := new(MockS3Client)
 	mockOneDriveService := new(MockOneDriveService)
 	mockDBRepo := new(MockDBRepository)
+	expectNewFile(mockDBRepo)
+
+	mockOneDriveService.On("EnsureFolder", "test-drive", "/Documents/Test").Return(nil)
 
 	testContent := []byte("test file content")
 	testContentReader := io.NopCloser(bytes.NewReader(testContent))
@@ -154,7 +246,7 @@ func TestSyncFile_OneDriveError(t *testing.T) {
 
 	expectedErr := errors.New("upload failed")
 	mockOneDriveService.On("UploadSmallFile",
-		mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(expectedErr)
+		mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, expectedErr)
 
 	service := NewServiceWithDependencies(
 		nil,
@@ -171,10 +263,467 @@ func TestSyncFile_OneDriveError(t *testing.T) {
 		FileName:   "test-file.txt",
 	}
 
-	err := service.SyncFile(params)
+	_, err := service.SyncFile(context.Background(), params)
 
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to upload small file")
+	assert.Equal(t, ErrorCodeUpload, errorCode(err))
+	mockS3Client.AssertExpectations(t)
+	mockOneDriveService.AssertExpectations(t)
+}
+
+func TestSyncFile_FolderError(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockOneDriveService := new(MockOneDriveService)
+	mockDBRepo := new(MockDBRepository)
+	expectNewFile(mockDBRepo)
+
+	mockS3Client.On("GetObject", mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader([]byte("test file content"))),
+		ContentLength: aws.Int64(17),
+	}, nil)
+	mockOneDriveService.On("EnsureFolder", "test-drive", "/Documents/Test").
+		Return(errors.New("failed to ensure folder /Documents/Test: a file already exists there"))
+
+	service := NewServiceWithDependencies(nil, mockS3Client, mockOneDriveService, mockDBRepo)
+
+	_, err := service.SyncFile(context.Background(), SyncFileParams{
+		Bucket:     "test-bucket",
+		Key:        "test-key",
+		DriveID:    "test-drive",
+		FolderPath: "/Documents/Test",
+		FileName:   "test-file.txt",
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrorCodeFolder, errorCode(err))
+	mockOneDriveService.AssertNotCalled(t, "UploadSmallFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSyncFile_DefaultsToOwnersDrive(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockOneDriveService := new(MockOneDriveService)
+	mockDBRepo := new(MockDBRepository)
+	expectNewFile(mockDBRepo)
+
+	mockOneDriveService.On("EnsureFolder", "b!owner-drive", "/Documents/Test").Return(nil)
+	mockS3Client.On("GetObject", mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader([]byte("test file content"))),
+		ContentLength: aws.Int64(17),
+	}, nil)
+	mockOneDriveService.On("UploadSmallFile", "b!owner-drive", "/Documents/Test", "test-file.txt", int64(17), ConflictReplace).
+		Return(&onedrive.DriveItem{ID: "onedrive-id"}, nil)
+
+	service := NewServiceWithDependencies(nil, mockS3Client, mockOneDriveService, mockDBRepo)
+	service.driveID = "b!owner-drive"
+
+	_, err := service.SyncFile(context.Background(), SyncFileParams{
+		Bucket:     "test-bucket",
+		Key:        "test-key",
+		FolderPath: "/Documents/Test",
+		FileName:   "test-file.txt",
+	})
+
+	assert.NoError(t, err)
+	mockOneDriveService.AssertExpectations(t)
+}
+
+func TestSyncFile_NoDrive(t *testing.T) {
+	mockOneDriveService := new(MockOneDriveService)
+	mockDBRepo := new(MockDBRepository)
+
+	service := NewServiceWithDependencies(nil, new(MockS3Client), mockOneDriveService, mockDBRepo)
+
+	_, err := service.SyncFile(context.Background(), SyncFileParams{
+		OwnerID:    123,
+		Bucket:     "test-bucket",
+		Key:        "test-key",
+		FolderPath: "/Documents/Test",
+		FileName:   "test-file.txt",
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrorCodeNoDrive, errorCode(err))
+	mockDBRepo.AssertNotCalled(t, "SaveFile", mock.Anything)
+}
+
+func TestSyncFile_IntegrityError(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockOneDriveService := new(MockOneDriveService)
+	mockDBRepo := new(MockDBRepository)
+	saved := expectNewFile(mockDBRepo)
+
+	mockOneDriveService.On("EnsureFolder", "test-drive", "/Documents/Test").Return(nil)
+
+	testContent := []byte("test file content")
+	mockS3Client.On("GetObject", mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(testContent)),
+		ContentLength: aws.Int64(int64(len(testContent))),
+	}, nil)
+
+	mockOneDriveService.On("UploadSmallFile",
+		mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, &onedrive.IntegrityError{ItemID: "item-id", Expected: "expected", Actual: "actual"})
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockS3Client,
+		mockOneDriveService,
+		mockDBRepo,
+	)
+
+	_, err := service.SyncFile(context.Background(), SyncFileParams{
+		Bucket:     "test-bucket",
+		Key:        "test-key",
+		DriveID:    "test-drive",
+		FolderPath: "/Documents/Test",
+		FileName:   "test-file.txt",
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrorCodeIntegrity, errorCode(err))
+	assert.False(t, onedrive.IsRetryable(err))
+	last := (*saved)[len(*saved)-1]
+	assert.Equal(t, db.FileStatusFailed, last.Status)
+	assert.Contains(t, last.LastError, "has quickXorHash actual, expected expected")
+}
+
+func TestSyncFile_RecordsSyncState(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockOneDriveService := new(MockOneDriveService)
+	mockDBRepo := new(MockDBRepository)
+
+	mockOneDriveService.On("EnsureFolder", "test-drive", "/Documents/Test").Return(nil)
+
+	var saved []db.File
+	mockDBRepo.On("GetFile", int64(123), "test-bucket", "test-key", "test-drive:/Documents/Test/test-file.txt").
+		Return(&db.File{ID: 7, Status: db.FileStatusFailed, Attempts: 2, LastError: "upload failed"}, nil)
+	mockDBRepo.On("SaveFile", mock.Anything).Run(func(args mock.Arguments) {
+		saved = append(saved, *args.Get(0).(*db.File))
+	}).Return(nil)
+
+	mockS3Client.On("GetObject", mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader([]byte("test file content"))),
+		ContentLength: aws.Int64(17),
+		ETag:          aws.String(`"etag"`),
+		VersionId:     aws.String("v2"),
+	}, nil)
+	mockOneDriveService.On("UploadSmallFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(&onedrive.DriveItem{ID: "onedrive-id", CTag: "ctag"}, nil)
+
+	service := NewServiceWithDependencies(nil, mockS3Client, mockOneDriveService, mockDBRepo)
+
+	_, err := service.SyncFile(context.Background(), SyncFileParams{
+		OwnerID:    123,
+		Bucket:     "test-bucket",
+		Key:        "test-key",
+		DriveID:    "test-drive",
+		FolderPath: "/Documents/Test",
+		FileName:   "test-file.txt",
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, saved, 2)
+
+	assert.Equal(t, db.FileStatusUploading, saved[0].Status)
+	assert.Equal(t, 3, saved[0].Attempts)
+	assert.Equal(t, `"etag"`, saved[0].ETag)
+	assert.Equal(t, "v2", saved[0].VersionID)
+	assert.Equal(t, int64(17), saved[0].Size)
+
+	assert.Equal(t, int64(7), saved[1].ID)
+	assert.Equal(t, db.FileStatusSynced, saved[1].Status)
+	assert.Equal(t, "onedrive-id", saved[1].OneDriveItemID)
+	assert.Equal(t, "ctag", saved[1].CTag)
+	assert.Empty(t, saved[1].LastError)
+	assert.NotNil(t, saved[1].SyncedAt)
+}
+
+func TestSyncFile_RecordsFailure(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockOneDriveService := new(MockOneDriveService)
+	mockDBRepo := new(MockDBRepository)
+	saved := expectNewFile(mockDBRepo)
+
+	mockS3Client.On("GetObject", mock.Anything, mock.Anything).Return(nil, errors.New("access denied"))
+
+	service := NewServiceWithDependencies(nil, mockS3Client, mockOneDriveService, mockDBRepo)
+
+	_, err := service.SyncFile(context.Background(), SyncFileParams{
+		OwnerID:    123,
+		Bucket:     "test-bucket",
+		Key:        "test-key",
+		DriveID:    "test-drive",
+		FolderPath: "/Documents/Test",
+		FileName:   "test-file.txt",
+	})
+
+	assert.Error(t, err)
+	assert.Len(t, *saved, 1)
+	assert.Equal(t, db.FileStatusFailed, (*saved)[0].Status)
+	assert.Equal(t, 1, (*saved)[0].Attempts)
+	assert.Equal(t, "test-drive:/Documents/Test/test-file.txt", (*saved)[0].Destination)
+	assert.Contains(t, (*saved)[0].LastError, "access denied")
+}
+
+func TestSyncFile_SkipsUnchangedFile(t *testing.T) {
+	lastModified := time.Date(2025, 5, 20, 10, 0, 0, 0, time.UTC)
+	synced := db.File{
+		Status:         db.FileStatusSynced,
+		ETag:           `"etag"`,
+		Size:           17,
+		LastModified:   &lastModified,
+		OneDriveItemID: "onedrive-id",
+		CTag:           "ctag-1",
+	}
+
+	tests := []struct {
+		name      string
+		head      *s3.HeadObjectOutput
+		item      *onedrive.DriveItem
+		unchanged bool
+	}{
+		{
+			name:      "unchanged",
+			head:      &s3.HeadObjectOutput{ETag: aws.String(`"etag"`), ContentLength: aws.Int64(17), LastModified: &lastModified},
+			item:      &onedrive.DriveItem{ID: "onedrive-id", Size: 17, CTag: "ctag-1"},
+			unchanged: true,
+		},
+		{
+			name: "S3 object changed",
+			head: &s3.HeadObjectOutput{ETag: aws.String(`"new-etag"`), ContentLength: aws.Int64(17), LastModified: &lastModified},
+		},
+		{
+			name: "OneDrive item changed",
+			head: &s3.HeadObjectOutput{ETag: aws.String(`"etag"`), ContentLength: aws.Int64(17), LastModified: &lastModified},
+			item: &onedrive.DriveItem{ID: "onedrive-id", Size: 20, CTag: "ctag-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3Client := new(MockS3Client)
+			mockOneDriveService := new(MockOneDriveService)
+			mockDBRepo := new(MockDBRepository)
+
+			mockOneDriveService.On("EnsureFolder", "test-drive", "/Documents/Test").Return(nil).Maybe()
+
+			record := synced
+			mockDBRepo.On("GetFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&record, nil)
+			mockDBRepo.On("SaveFile", mock.Anything).Return(nil)
+
+			mockS3Client.On("HeadObject", mock.Anything, mock.Anything).Return(tt.head, nil)
+			if tt.item != nil {
+				mockOneDriveService.On("GetItem", "test-drive", onedrive.ItemRef{ID: "onedrive-id"}).Return(tt.item, nil)
+			}
+			mockS3Client.On("GetObject", mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{
+				Body:          io.NopCloser(bytes.NewReader([]byte("changed content"))),
+				ContentLength: aws.Int64(15),
+			}, nil).Maybe()
+			mockOneDriveService.On("UploadSmallFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+				Return(&onedrive.DriveItem{ID: "onedrive-id", CTag: "ctag-3"}, nil).Maybe()
+
+			service := NewServiceWithDependencies(nil, mockS3Client, mockOneDriveService, mockDBRepo)
+
+			result, err := service.SyncFile(context.Background(), SyncFileParams{
+				OwnerID:    123,
+				Bucket:     "test-bucket",
+				Key:        "test-key",
+				DriveID:    "test-drive",
+				FolderPath: "/Documents/Test",
+				FileName:   "test-file.txt",
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.unchanged, result.Unchanged)
+			if tt.unchanged {
+				mockOneDriveService.AssertNotCalled(t, "UploadSmallFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				mockDBRepo.AssertNotCalled(t, "SaveFile", mock.Anything)
+			} else {
+				mockOneDriveService.AssertCalled(t, "UploadSmallFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				assert.Equal(t, "ctag-3", record.CTag)
+			}
+		})
+	}
+}
+
+func largeFileParams() SyncFileParams {
+	return SyncFileParams{
+		OwnerID:    123,
+		Bucket:     "test-bucket",
+		Key:        "test-key",
+		DriveID:    "test-drive",
+		FolderPath: "/Documents/Test",
+		FileName:   "big-file.pdf",
+	}
+}
+
+func mockLargeObject(mockS3Client *MockS3Client, etag string) int64 {
+	contentLength := FOUR_MB + 1
+	mockS3Client.On("GetObject", mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(make([]byte, contentLength))),
+		ContentLength: aws.Int64(contentLength),
+		ETag:          aws.String(etag),
+	}, nil)
+	return contentLength
+}
+
+func TestSyncFile_LargeFile_Success(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockOneDriveService := new(MockOneDriveService)
+	mockDBRepo := new(MockDBRepository)
+	expectNewFile(mockDBRepo)
+
+	mockOneDriveService.On("EnsureFolder", "test-drive", "/Documents/Test").Return(nil)
+
+	contentLength := mockLargeObject(mockS3Client, `"etag"`)
+	destination := "test-drive:/Documents/Test/big-file.pdf"
+
+	mockDBRepo.On("GetUploadSession", int64(123), "test-bucket", "test-key", destination).Return(nil, nil)
+	mockDBRepo.On("SaveUploadSession", mock.MatchedBy(func(session *db.UploadSession) bool {
+		return session.UploadURL == "https://upload.example.com/session" &&
+			session.BytesCommitted == onedrive.UploadChunkSize &&
+			session.ETag == `"etag"` &&
+			session.Destination == destination
+	})).Return(nil)
+	mockDBRepo.On("DeleteUploadSession", int64(123), "test-bucket", "test-key", destination).Return(nil)
+
+	mockOneDriveService.On(
+		"UploadLargeFile",
+		mock.MatchedBy(func(params onedrive.UploadLargeFileParams) bool {
+			return params.DriveID == "test-drive" &&
+				params.FolderPath == "/Documents/Test" &&
+				params.FileName == "big-file.pdf" &&
+				params.FileSize == contentLength &&
+				params.Session == nil
+		}),
+	).Run(func(args mock.Arguments) {
+		params := args.Get(0).(onedrive.UploadLargeFileParams)
+		params.OnProgress(onedrive.UploadSession{UploadURL: "https://upload.example.com/session"}, onedrive.UploadChunkSize)
+	}).Return(&onedrive.DriveItem{ID: "onedrive-id"}, nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockS3Client,
+		mockOneDriveService,
+		mockDBRepo,
+	)
+
+	_, err := service.SyncFile(context.Background(), largeFileParams())
+
+	assert.NoError(t, err)
 	mockS3Client.AssertExpectations(t)
 	mockOneDriveService.AssertExpectations(t)
-}
\ No newline at end of file
+	mockOneDriveService.AssertNotCalled(t, "UploadSmallFile")
+	mockDBRepo.AssertExpectations(t)
+}
+
+func TestSyncFile_LargeFile_ResumesUploadSession(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockOneDriveService := new(MockOneDriveService)
+	mockDBRepo := new(MockDBRepository)
+	expectNewFile(mockDBRepo)
+
+	mockOneDriveService.On("EnsureFolder", "test-drive", "/Documents/Test").Return(nil)
+	mockLargeObject(mockS3Client, `"etag"`)
+
+	mockDBRepo.On("GetUploadSession", int64(123), "test-bucket", "test-key", mock.Anything).Return(&db.UploadSession{
+		UploadURL:      "https://upload.example.com/session",
+		ExpiresAt:      time.Now().Add(time.Hour),
+		BytesCommitted: onedrive.UploadChunkSize,
+		ETag:           `"etag"`,
+	}, nil)
+	mockDBRepo.On("DeleteUploadSession", int64(123), "test-bucket", "test-key", mock.Anything).Return(nil)
+
+	mockOneDriveService.On(
+		"UploadLargeFile",
+		mock.MatchedBy(func(params onedrive.UploadLargeFileParams) bool {
+			return params.Session != nil && params.Session.UploadURL == "https://upload.example.com/session"
+		}),
+	).Return(&onedrive.DriveItem{ID: "onedrive-id"}, nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockS3Client,
+		mockOneDriveService,
+		mockDBRepo,
+	)
+
+	_, err := service.SyncFile(context.Background(), largeFileParams())
+
+	assert.NoError(t, err)
+	mockOneDriveService.AssertExpectations(t)
+	mockDBRepo.AssertExpectations(t)
+}
+
+func TestSyncFile_LargeFile_DiscardsStaleUploadSession(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockOneDriveService := new(MockOneDriveService)
+	mockDBRepo := new(MockDBRepository)
+	expectNewFile(mockDBRepo)
+
+	mockOneDriveService.On("EnsureFolder", "test-drive", "/Documents/Test").Return(nil)
+	mockLargeObject(mockS3Client, `"new-etag"`)
+
+	mockDBRepo.On("GetUploadSession", int64(123), "test-bucket", "test-key", mock.Anything).Return(&db.UploadSession{
+		UploadURL: "https://upload.example.com/session",
+		ExpiresAt: time.Now().Add(time.Hour),
+		ETag:      `"old-etag"`,
+	}, nil)
+	mockDBRepo.On("DeleteUploadSession", int64(123), "test-bucket", "test-key", mock.Anything).Return(nil).Twice()
+
+	mockOneDriveService.On(
+		"UploadLargeFile",
+		mock.MatchedBy(func(params onedrive.UploadLargeFileParams) bool {
+			return params.Session == nil
+		}),
+	).Return(&onedrive.DriveItem{ID: "onedrive-id"}, nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockS3Client,
+		mockOneDriveService,
+		mockDBRepo,
+	)
+
+	_, err := service.SyncFile(context.Background(), largeFileParams())
+
+	assert.NoError(t, err)
+	mockOneDriveService.AssertExpectations(t)
+	mockDBRepo.AssertExpectations(t)
+}
+
+func TestS3RangeSource_OpenRange(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+
+	initialBody := io.NopCloser(bytes.NewReader([]byte("initial")))
+	mockS3Client.On(
+		"GetObject",
+		mock.Anything,
+		mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return *input.Range == "bytes=327680-" && *input.IfMatch == `"etag"`
+		}),
+	).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte("ranged"))),
+	}, nil)
+
+	source := &s3RangeSource{
+		s3Client: mockS3Client,
+		bucket:   "test-bucket",
+		key:      "test-key",
+		etag:     aws.String(`"etag"`),
+		body:     initialBody,
+	}
+
+	body, err := source.OpenRange(context.Background(), 0)
+	assert.NoError(t, err)
+	content, _ := io.ReadAll(body)
+	assert.Equal(t, "initial", string(content))
+
+	body, err = source.OpenRange(context.Background(), 327680)
+	assert.NoError(t, err)
+	content, _ = io.ReadAll(body)
+	assert.Equal(t, "ranged", string(content))
+
+	mockS3Client.AssertExpectations(t)
+}
@@ -0,0 +1,121 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/jaibhavaya/gogo-files/pkg/db"
+	"github.com/jaibhavaya/gogo-files/pkg/onedrive"
+)
+
+// Split reports whether the sync is split into work items, which is the case
+// for syncs with a job ID and more items than the configured threshold.
+func (h *SyncHandler) Split() bool {
+	return h.JobID != "" && h.Config.SplitFileSync(len(h.Items))
+}
+
+// syncWorkItems syncs the items of a split sync. Every item is stored as a
+// work item of the job; items finished by an earlier delivery keep their
+// result, and the rest are synced and their outcome stored. Items that failed
+// in a way that may succeed later stay pending for the next delivery.
+func (h *SyncHandler) syncWorkItems(ctx context.Context, syncItem func(Item) FileResult) ([]FileResult, error) {
+	keys := make([]string, len(h.Items))
+	for i, item := range h.Items {
+		keys[i] = item.Key()
+	}
+
+	workItems, err := db.CreateSyncWorkItems(ctx, h.DbPool, h.JobID, h.OwnerID, keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(workItems) != len(h.Items) {
+		return nil, fmt.Errorf("job has %d work items, expected %d", len(workItems), len(h.Items))
+	}
+
+	results := make([]FileResult, len(h.Items))
+	var pending []int
+	var done db.SyncJobProgress
+	for i, workItem := range workItems {
+		if workItem.Status != db.SyncWorkItemDone {
+			pending = append(pending, i)
+			continue
+		}
+		if err := json.Unmarshal(workItem.Result, &results[i]); err != nil {
+			return nil, fmt.Errorf("failed to decode result of work item %d: %w", i, err)
+		}
+
+		progress := itemProgress(results[i])
+		done.Succeeded += progress.Succeeded
+		done.Failed += progress.Failed
+		done.Skipped += progress.Skipped
+	}
+	// the bytes of these items were counted by the delivery that synced them
+	if len(pending) < len(workItems) {
+		h.addJobProgress(ctx, done)
+	}
+
+	fmt.Printf("Job %s: %d of %d items left to sync\n", h.JobID, len(pending), len(h.Items))
+
+	forEach(ctx, len(pending), h.Config.FileSyncWorkerCount(), func(i int) {
+		index := pending[i]
+		results[index] = syncItem(h.Items[index])
+		h.saveWorkItem(ctx, index, results[index])
+	})
+
+	return results, nil
+}
+
+// saveWorkItem stores the outcome of a work item. The item is only done if it
+// succeeded or failed for good. Failures to save are logged: the item is then
+// synced again on the next delivery.
+func (h *SyncHandler) saveWorkItem(ctx context.Context, index int, result FileResult) {
+	// the outcome is recorded even if the message was cancelled meanwhile
+	saveCtx := context.WithoutCancel(ctx)
+
+	var err error
+	if result.err != nil && (onedrive.IsRetryable(result.err) || ctx.Err() != nil) {
+		err = db.SaveSyncWorkItemError(saveCtx, h.DbPool, h.JobID, index, result.Error)
+	} else {
+		var encoded []byte
+		encoded, err = json.Marshal(result)
+		if err == nil {
+			err = db.SaveSyncWorkItemResult(saveCtx, h.DbPool, h.JobID, index, encoded)
+		}
+	}
+	if err != nil {
+		fmt.Printf("failed to save work item %d of job %s: %v\n", index, h.JobID, err)
+	}
+}
+
+// forEach calls fn with every index below n, using at most workers goroutines
+// at a time. Once ctx is cancelled no more indexes are started.
+func forEach(ctx context.Context, n int, workers int, fn func(int)) {
+	workers = min(max(workers, 1), n)
+
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+	func() {
+		defer close(indexes)
+		for i := range n {
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+}
@@ -0,0 +1,57 @@
+package file
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jaibhavaya/gogo-files/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEach_BoundsWorkers(t *testing.T) {
+	var running, peak atomic.Int32
+	results := make([]int, 20)
+
+	forEach(context.Background(), len(results), 3, func(i int) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		results[i] = i * i
+		running.Add(-1)
+	})
+
+	assert.LessOrEqual(t, peak.Load(), int32(3))
+	for i, result := range results {
+		assert.Equal(t, i*i, result)
+	}
+}
+
+func TestForEach_StopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls atomic.Int32
+
+	forEach(ctx, 100, 1, func(i int) {
+		if calls.Add(1) == 5 {
+			cancel()
+		}
+	})
+
+	// at most one more index may have been handed out as ctx was cancelled
+	assert.LessOrEqual(t, calls.Load(), int32(6))
+}
+
+func TestSyncHandler_Split(t *testing.T) {
+	cfg := config.Config{FileSyncSplitThreshold: "2"}
+	items := []Item{testItem{}, testItem{}, testItem{}}
+
+	assert.True(t, (&SyncHandler{JobID: "job", Items: items, Config: cfg}).Split())
+	assert.False(t, (&SyncHandler{JobID: "job", Items: items[:2], Config: cfg}).Split())
+	assert.False(t, (&SyncHandler{Items: items, Config: cfg}).Split())
+}
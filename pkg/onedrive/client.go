@@ -1,9 +1,12 @@
 package onedrive
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"strings"
@@ -12,19 +15,41 @@ import (
 	"github.com/jaibhavaya/gogo-files/pkg/db"
 )
 
+const (
+	tokenURL = "https://login.microsoftonline.com/common/oauth2/v2.0/token"
+	graphURL = "https://graph.microsoft.com/v1.0"
+)
+
 type client struct {
+	ownerID              int64
 	onedriveClientID     string
 	onedriveClientSecret string
 	refreshToken         string
 	httpClient           *http.Client
+	tokens               *tokenCache
+	tokenURL             string
+	graphURL             string
+	retry                retryPolicy
+	repository           DBInteractor
 }
 
-func newClient(onedriveIntegration *db.OneDriveIntegration, clientID, clientSecret string) *client {
+func newClient(
+	onedriveIntegration *db.OneDriveIntegration,
+	clientID, clientSecret string,
+	timeout time.Duration,
+	repository DBInteractor,
+) *client {
 	return &client{
+		ownerID:              onedriveIntegration.OwnerID,
 		onedriveClientID:     clientID,
 		onedriveClientSecret: clientSecret,
 		refreshToken:         onedriveIntegration.RefreshToken,
-		httpClient:           &http.Client{Timeout: 30 * time.Second},
+		httpClient:           &http.Client{Timeout: timeout},
+		tokens:               sharedTokenCache,
+		tokenURL:             tokenURL,
+		graphURL:             graphURL,
+		retry:                defaultRetryPolicy,
+		repository:           repository,
 	}
 }
 
@@ -36,64 +61,236 @@ type tokenResponse struct {
 	Scope        string `json:"scope"`
 }
 
-func (c *client) getAccessToken() (string, error) {
+// getAccessToken returns a cached access token for the owner, exchanging the
+// refresh token for a new one only when the cached token is close to expiry.
+func (c *client) getAccessToken(ctx context.Context) (string, error) {
+	return c.tokens.get(ctx, c.ownerID, c.requestAccessToken)
+}
+
+// requestAccessToken exchanges the owner's refresh token for an access token.
+// Microsoft rotates refresh tokens, so the latest stored token is used and any
+// new one returned is written back.
+func (c *client) requestAccessToken(ctx context.Context) (*tokenResponse, error) {
+	c.loadRefreshToken(ctx)
+	refreshToken := c.refreshToken
+
 	formData := url.Values{}
 	formData.Set("grant_type", "refresh_token")
-	formData.Set("refresh_token", c.refreshToken)
+	formData.Set("refresh_token", refreshToken)
 	formData.Set("client_id", c.onedriveClientID)
 	formData.Set("client_secret", c.onedriveClientSecret)
 
-	headers := map[string]string{
-		"Content-Type": "application/x-www-form-urlencoded",
+	req, err := http.NewRequestWithContext(ctx, "POST", c.tokenURL, strings.NewReader(formData.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("error creating token request: %v", err)
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := c.DoRequest(
-		"POST",
-		"https://login.microsoftonline.com/common/oauth2/v2.0/token",
-		strings.NewReader(formData.Encode()),
-		headers,
-	)
+	resp, err := c.httpClient.Do(req)
+	if ctx.Err() != nil {
+		closeBody(resp)
+		return nil, fmt.Errorf("failed to fetch token: %w", ctx.Err())
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch token")
+		return nil, fmt.Errorf("failed to fetch token: %w", &NetworkError{Err: err})
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		c.tokens.invalidate(c.ownerID)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newTokenError(resp)
 	}
 
 	var response tokenResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed to decode token response: %w", err)
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	c.saveRefreshToken(ctx, refreshToken, response.RefreshToken)
+
+	return &response, nil
+}
+
+// loadRefreshToken picks up a refresh token rotated by another worker since
+// this client was created.
+func (c *client) loadRefreshToken(ctx context.Context) {
+	if c.repository == nil {
+		return
 	}
 
-	return response.AccessToken, nil
+	refreshToken, err := c.repository.GetOneDriveRefreshToken(ctx, c.ownerID)
+	if err != nil {
+		log.Printf("Failed to load refresh token for owner %d, using the one we have: %v", c.ownerID, err)
+		return
+	}
+
+	c.refreshToken = refreshToken
 }
 
-func (c *client) DoRequest(method, path string, body io.Reader, headers map[string]string) (*http.Response, error) {
-	accessToken, err := c.getAccessToken()
+// saveRefreshToken records the outcome of a token exchange. When no new token
+// was issued the existing one is kept and only the refresh time is updated.
+func (c *client) saveRefreshToken(ctx context.Context, previousToken, newToken string) {
+	if newToken == "" {
+		newToken = previousToken
+	}
+	c.refreshToken = newToken
+
+	if c.repository == nil {
+		return
+	}
+
+	// Microsoft has already invalidated the previous token, so the new one is
+	// saved even if ctx was cancelled in the meantime
+	rotated, err := c.repository.RotateOneDriveRefreshToken(context.WithoutCancel(ctx), c.ownerID, previousToken, newToken)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get access token: %v", err)
+		log.Printf("Failed to save rotated refresh token for owner %d: %v", c.ownerID, err)
+		return
+	}
+
+	if !rotated {
+		// someone else rotated or re-authorized first; theirs is the token to keep
+		log.Printf("Refresh token for owner %d changed during exchange, keeping the stored token", c.ownerID)
+		c.loadRefreshToken(ctx)
 	}
+}
 
-	fullURL := fmt.Sprintf("https://graph.microsoft.com/v1.0%s", path)
+func (c *client) DoRequest(ctx context.Context, method, path string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	fullURL := c.graphURL + path
 
-	req, err := http.NewRequest(method, fullURL, body)
+	req, err := http.NewRequestWithContext(ctx, method, fullURL, body)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %v", err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
 	req.Header.Set("Accept", "application/json")
 
 	for key, value := range headers {
 		req.Header.Set(key, value)
 	}
 
+	resp, err := c.send(req)
+	if err != nil {
+		logGraphError(method, path, err)
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if resp.StatusCode == http.StatusUnauthorized {
+			c.tokens.invalidate(c.ownerID)
+		}
+
+		graphErr := newGraphError(resp)
+		logGraphError(method, path, graphErr)
+		return nil, graphErr
+	}
+
+	return resp, nil
+}
+
+// logGraphError logs a failed Graph request along with the request-id and
+// date Microsoft support needs to trace it.
+func logGraphError(method, path string, err error) {
+	var graphErr *GraphError
+	if !errors.As(err, &graphErr) {
+		log.Printf("Graph %s %s failed: %v", method, path, err)
+		return
+	}
+
+	log.Printf(
+		"Graph %s %s failed with status %d, code %q, request-id %q, date %q: %s",
+		method, path, graphErr.StatusCode, graphErr.Code, graphErr.RequestID, graphErr.Date, graphErr.Message,
+	)
+}
+
+// send sends an authorized Graph request, retrying throttling, server errors
+// and network failures according to the client's retry policy. A request
+// whose body can't be replayed is only sent once. Other responses, including
+// errors, are returned as-is. Nothing is retried once the request's context is
+// done.
+func (c *client) send(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	replayable := req.Body == nil || req.GetBody != nil
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("error replaying request body: %v", err)
+			}
+			req.Body = body
+		}
+
+		accessToken, err := c.getAccessToken(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get access token: %w", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+		resp, err := c.httpClient.Do(req)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			closeBody(resp)
+			return nil, ctx.Err()
+		}
+
+		if err != nil {
+			err = &NetworkError{Err: err}
+		} else {
+			err = newGraphError(resp)
+		}
+
+		if !replayable || !c.retry.shouldRetry(attempt, err) {
+			return nil, err
+		}
+
+		delay := c.retry.delay(attempt, RetryAfter(err))
+		log.Printf("Retrying %s %s in %s after attempt %d failed: %v", req.Method, req.URL.Path, delay, attempt, err)
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// DoUploadRequest sends a request to a pre-authenticated upload session URL.
+// Graph rejects upload session requests that carry an Authorization header,
+// so no token is attached. Like DoRequest, a response outside 2xx is returned
+// as a *GraphError; otherwise the caller is responsible for closing the body.
+func (c *client) DoUploadRequest(ctx context.Context, method, uploadURL string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uploadURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
 	resp, err := c.httpClient.Do(req)
+	if ctx.Err() != nil {
+		closeBody(resp)
+		return nil, ctx.Err()
+	}
 	if err != nil {
-		return &http.Response{}, fmt.Errorf("failed to send request: %w", err)
+		return nil, &NetworkError{Err: err}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return &http.Response{}, fmt.Errorf("token request failed with status: %d", resp.StatusCode)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newGraphError(resp)
 	}
 
 	return resp, nil
 }
+
+// closeBody releases the connection of a response that won't be read, if
+// there was one.
+func closeBody(resp *http.Response) {
+	if resp != nil {
+		resp.Body.Close()
+	}
+}
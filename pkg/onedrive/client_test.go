@@ -0,0 +1,347 @@
+package onedrive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaibhavaya/gogo-files/pkg/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTokenServer(t *testing.T, expectedRefreshToken, rotatedRefreshToken string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "refresh_token", r.Form.Get("grant_type"))
+		assert.Equal(t, expectedRefreshToken, r.Form.Get("refresh_token"))
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "access", "refresh_token": %q, "expires_in": 3600}`, rotatedRefreshToken)
+	}))
+}
+
+func newTestClient(tokenURL string, repository DBInteractor) *client {
+	c := newClient(&db.OneDriveIntegration{OwnerID: 123, RefreshToken: "initial-token"}, "id", "secret", 30*time.Second, repository)
+	c.tokens = newTokenCache()
+	c.tokenURL = tokenURL
+	return c
+}
+
+func TestGetAccessToken_PersistsRotatedRefreshToken(t *testing.T) {
+	server := newTestTokenServer(t, "stored-token", "rotated-token")
+	defer server.Close()
+
+	mockRepository := new(MockDBRepository)
+	mockRepository.On("GetOneDriveRefreshToken", int64(123)).Return("stored-token", nil)
+	mockRepository.On("RotateOneDriveRefreshToken", int64(123), "stored-token", "rotated-token").Return(true, nil)
+
+	c := newTestClient(server.URL, mockRepository)
+
+	token, err := c.getAccessToken(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "access", token)
+	assert.Equal(t, "rotated-token", c.refreshToken)
+	mockRepository.AssertExpectations(t)
+}
+
+func TestGetAccessToken_KeepsConcurrentlyRotatedToken(t *testing.T) {
+	server := newTestTokenServer(t, "stored-token", "rotated-token")
+	defer server.Close()
+
+	mockRepository := new(MockDBRepository)
+	mockRepository.On("GetOneDriveRefreshToken", int64(123)).Return("stored-token", nil).Once()
+	mockRepository.On("RotateOneDriveRefreshToken", int64(123), "stored-token", "rotated-token").Return(false, nil)
+	mockRepository.On("GetOneDriveRefreshToken", int64(123)).Return("someone-elses-token", nil).Once()
+
+	c := newTestClient(server.URL, mockRepository)
+
+	_, err := c.getAccessToken(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "someone-elses-token", c.refreshToken)
+	mockRepository.AssertExpectations(t)
+}
+
+func TestGetAccessToken_NoRotationRecordsRefresh(t *testing.T) {
+	server := newTestTokenServer(t, "stored-token", "")
+	defer server.Close()
+
+	mockRepository := new(MockDBRepository)
+	mockRepository.On("GetOneDriveRefreshToken", int64(123)).Return("stored-token", nil)
+	mockRepository.On("RotateOneDriveRefreshToken", int64(123), "stored-token", "stored-token").Return(true, nil)
+
+	c := newTestClient(server.URL, mockRepository)
+
+	_, err := c.getAccessToken(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "stored-token", c.refreshToken)
+	mockRepository.AssertExpectations(t)
+}
+
+func TestGetAccessToken_RefusedRefreshToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error": "invalid_grant", "error_description": "AADSTS700082: The refresh token has expired."}`)
+	}))
+	defer server.Close()
+
+	c := newTestClient(server.URL, nil)
+
+	_, err := c.getAccessToken(context.Background())
+
+	var tokenErr *TokenError
+	if assert.ErrorAs(t, err, &tokenErr) {
+		assert.Equal(t, "invalid_grant", tokenErr.Code)
+	}
+	assert.True(t, IsAuthorizationRevoked(err))
+	assert.False(t, IsRetryable(err))
+}
+
+// newTestGraphServer answers Graph requests with the given statuses in turn,
+// counting the requests it receives.
+func newTestGraphServer(t *testing.T, requests *int, responses ...func(w http.ResponseWriter)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer access", r.Header.Get("Authorization"))
+
+		if *requests >= len(responses) {
+			t.Errorf("unexpected request %d", *requests+1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		responses[*requests](w)
+		*requests++
+	}))
+}
+
+func respond(status int, headers map[string]string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for key, value := range headers {
+			w.Header().Set(key, value)
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{}`)
+	}
+}
+
+func newRetryTestClient(t *testing.T, graphURL string) *client {
+	tokenServer := newTestTokenServer(t, "initial-token", "")
+	t.Cleanup(tokenServer.Close)
+
+	c := newTestClient(tokenServer.URL, nil)
+	c.graphURL = graphURL
+	c.retry = retryPolicy{maxAttempts: 3, maxRetryAfter: time.Second}
+	return c
+}
+
+func TestDoRequest_RetriesThrottledAndServerErrors(t *testing.T) {
+	requests := 0
+	server := newTestGraphServer(t, &requests,
+		respond(http.StatusTooManyRequests, map[string]string{"Retry-After": "0"}),
+		respond(http.StatusServiceUnavailable, nil),
+		respond(http.StatusOK, nil),
+	)
+	defer server.Close()
+
+	c := newRetryTestClient(t, server.URL)
+
+	_, err := c.DoRequest(context.Background(), "PATCH", "/drives/d/items/1", strings.NewReader(`{"name": "b.pdf"}`), nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, requests)
+}
+
+func TestDoRequest_GivesUpAfterMaxAttempts(t *testing.T) {
+	requests := 0
+	server := newTestGraphServer(t, &requests,
+		respond(http.StatusServiceUnavailable, nil),
+		respond(http.StatusBadGateway, nil),
+		respond(http.StatusServiceUnavailable, nil),
+	)
+	defer server.Close()
+
+	c := newRetryTestClient(t, server.URL)
+
+	_, err := c.DoRequest(context.Background(), "GET", "/drives/d/items/1", nil, nil)
+
+	var graphErr *GraphError
+	assert.ErrorAs(t, err, &graphErr)
+	assert.Equal(t, http.StatusServiceUnavailable, graphErr.StatusCode)
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, 3, requests)
+}
+
+func TestDoRequest_DoesNotRetryPermanentErrors(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			requests := 0
+			server := newTestGraphServer(t, &requests, respond(status, nil))
+			defer server.Close()
+
+			c := newRetryTestClient(t, server.URL)
+
+			_, err := c.DoRequest(context.Background(), "GET", "/drives/d/items/1", nil, nil)
+
+			var graphErr *GraphError
+			assert.ErrorAs(t, err, &graphErr)
+			assert.Equal(t, status, graphErr.StatusCode)
+			assert.False(t, IsRetryable(err))
+			assert.Equal(t, 1, requests)
+		})
+	}
+}
+
+func TestDoRequest_LeavesLongRetryAfterToCaller(t *testing.T) {
+	requests := 0
+	server := newTestGraphServer(t, &requests,
+		respond(http.StatusTooManyRequests, map[string]string{"Retry-After": "120"}),
+	)
+	defer server.Close()
+
+	c := newRetryTestClient(t, server.URL)
+
+	_, err := c.DoRequest(context.Background(), "GET", "/drives/d/items/1", nil, nil)
+
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, 120*time.Second, RetryAfter(err))
+	assert.Equal(t, 1, requests)
+}
+
+func TestDoRequest_DoesNotReplayStreamedBody(t *testing.T) {
+	requests := 0
+	server := newTestGraphServer(t, &requests, respond(http.StatusServiceUnavailable, nil))
+	defer server.Close()
+
+	c := newRetryTestClient(t, server.URL)
+
+	// a body that can't be rewound, like an S3 object stream
+	body := io.NopCloser(strings.NewReader("content"))
+	_, err := c.DoRequest(context.Background(), "PUT", "/drives/d/root:/a.txt:/content", body, nil)
+
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, 1, requests)
+}
+
+func TestDoRequest_ReturnsOpenBodyForAnySuccessStatus(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusCreated, http.StatusAccepted} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			requests := 0
+			server := newTestGraphServer(t, &requests, func(w http.ResponseWriter) {
+				w.WriteHeader(status)
+				fmt.Fprint(w, `{"id": "01ABC"}`)
+			})
+			defer server.Close()
+
+			c := newRetryTestClient(t, server.URL)
+
+			resp, err := c.DoRequest(context.Background(), "PUT", "/drives/d/root:/a.txt:/content", strings.NewReader("content"), nil)
+
+			assert.NoError(t, err)
+			assert.Equal(t, status, resp.StatusCode)
+			body, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"id": "01ABC"}`, string(body))
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestDoRequest_NoContent(t *testing.T) {
+	requests := 0
+	server := newTestGraphServer(t, &requests, respond(http.StatusNoContent, nil))
+	defer server.Close()
+
+	c := newRetryTestClient(t, server.URL)
+
+	resp, err := c.DoRequest(context.Background(), "DELETE", "/drives/d/items/1", nil, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestDoRequest_ParsesGraphError(t *testing.T) {
+	requests := 0
+	server := newTestGraphServer(t, &requests, func(w http.ResponseWriter) {
+		w.Header().Set("request-id", "header-request-id")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"error": {"code": "accessDenied", "message": "Access denied", "innerError": {"request-id": "abc-123", "date": "2025-05-12T10:00:00"}}}`)
+	})
+	defer server.Close()
+
+	c := newRetryTestClient(t, server.URL)
+
+	resp, err := c.DoRequest(context.Background(), "GET", "/drives/d/items/1", nil, nil)
+
+	assert.Nil(t, resp)
+	var graphErr *GraphError
+	assert.ErrorAs(t, err, &graphErr)
+	assert.Equal(t, http.StatusForbidden, graphErr.StatusCode)
+	assert.Equal(t, "accessDenied", graphErr.Code)
+	assert.Equal(t, "abc-123", graphErr.RequestID)
+	assert.Equal(t, "2025-05-12T10:00:00", graphErr.Date)
+}
+
+// closeTracker records whether a response body was closed.
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeTracker) Close() error {
+	b.closed = true
+	return nil
+}
+
+// roundTripFunc lets a test stand in for the network.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// cancelAfterResponse returns a transport that answers with status and then
+// cancels the request's context, as if the message was cancelled just as the
+// response arrived.
+func cancelAfterResponse(status int, cancel context.CancelFunc, body *closeTracker) http.RoundTripper {
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		cancel()
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: body, Request: req}, nil
+	})
+}
+
+func TestDoRequest_ClosesBodyWhenCancelled(t *testing.T) {
+	c := newRetryTestClient(t, "https://graph.test")
+	_, err := c.getAccessToken(context.Background())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	body := &closeTracker{Reader: strings.NewReader(`{}`)}
+	c.httpClient = &http.Client{Transport: cancelAfterResponse(http.StatusServiceUnavailable, cancel, body)}
+
+	_, err = c.DoRequest(ctx, "GET", "/drives/d/items/1", nil, nil)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, body.closed)
+}
+
+func TestDoUploadRequest_ClosesBodyWhenCancelled(t *testing.T) {
+	c := newRetryTestClient(t, "https://graph.test")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	body := &closeTracker{Reader: strings.NewReader(`{}`)}
+	c.httpClient = &http.Client{Transport: cancelAfterResponse(http.StatusAccepted, cancel, body)}
+
+	resp, err := c.DoUploadRequest(ctx, "PUT", "https://upload.test/session", strings.NewReader("chunk"), nil)
+
+	assert.Nil(t, resp)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, body.closed)
+}
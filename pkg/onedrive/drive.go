@@ -0,0 +1,55 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jaibhavaya/gogo-files/pkg/db"
+)
+
+// Drive is the subset of Graph's drive resource the service uses.
+type Drive struct {
+	ID string `json:"id"`
+	// DriveType is "personal", "business" or "documentLibrary".
+	DriveType string `json:"driveType"`
+	Quota     Quota  `json:"quota"`
+}
+
+// Quota is a drive's storage, in bytes.
+type Quota struct {
+	Total     int64  `json:"total"`
+	Used      int64  `json:"used"`
+	Remaining int64  `json:"remaining"`
+	State     string `json:"state"`
+}
+
+// GetMyDrive fetches the signed in user's default drive.
+func (s *Service) GetMyDrive(ctx context.Context) (*Drive, error) {
+	resp, err := s.client.DoRequest(ctx, "GET", "/me/drive", nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get drive failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var drive Drive
+	if err := json.NewDecoder(resp.Body).Decode(&drive); err != nil {
+		return nil, fmt.Errorf("failed to decode get drive response: %w", err)
+	}
+	if drive.ID == "" {
+		return nil, fmt.Errorf("get drive response did not include a drive ID")
+	}
+
+	return &drive, nil
+}
+
+// record converts the drive to what is stored with the integration.
+func (d *Drive) record() *db.OneDriveDrive {
+	return &db.OneDriveDrive{
+		ID:             d.ID,
+		Type:           d.DriveType,
+		QuotaTotal:     d.Quota.Total,
+		QuotaUsed:      d.Quota.Used,
+		QuotaRemaining: d.Quota.Remaining,
+	}
+}
@@ -0,0 +1,210 @@
+package onedrive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBodySize bounds how much of an error response is kept in a
+// GraphError.
+const maxErrorBodySize = 64 * 1024
+
+// GraphError is returned when Graph answers a request with an error status.
+// Code, RequestID and Date come from Graph's error envelope and are what
+// Microsoft support asks for when a failure needs investigating.
+type GraphError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+	// ClientRequestID echoes the client-request-id we sent, if any.
+	ClientRequestID string
+	Date            string
+	// RetryAfter is how long Graph asked us to wait before sending the
+	// request again, or zero if it didn't say.
+	RetryAfter time.Duration
+}
+
+func (e *GraphError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "graph request failed with status %d", e.StatusCode)
+	if e.Code != "" {
+		fmt.Fprintf(&b, " (%s)", e.Code)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&b, ": %s", e.Message)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " [request-id: %s, date: %s]", e.RequestID, e.Date)
+	}
+	return b.String()
+}
+
+// Retryable reports whether the same request may succeed if sent again.
+// Throttling and server errors are retryable; client errors such as 401, 403,
+// 404 and 409 are not.
+func (e *GraphError) Retryable() bool {
+	return retryableStatus(e.StatusCode)
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return false
+	}
+	return status >= 500
+}
+
+// graphErrorEnvelope is the body Graph sends with an error status.
+type graphErrorEnvelope struct {
+	Error struct {
+		Code       string `json:"code"`
+		Message    string `json:"message"`
+		InnerError struct {
+			RequestID       string `json:"request-id"`
+			ClientRequestID string `json:"client-request-id"`
+			Date            string `json:"date"`
+		} `json:"innerError"`
+	} `json:"error"`
+}
+
+// newGraphError reads and closes an error response. Bodies that aren't a
+// Graph error envelope are kept as the message.
+func newGraphError(resp *http.Response) *GraphError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	resp.Body.Close()
+
+	graphErr := &GraphError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("request-id"),
+		Date:       resp.Header.Get("Date"),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+
+	var envelope graphErrorEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Error.Code == "" {
+		graphErr.Message = strings.TrimSpace(string(body))
+		return graphErr
+	}
+
+	graphErr.Code = envelope.Error.Code
+	graphErr.Message = envelope.Error.Message
+	graphErr.ClientRequestID = envelope.Error.InnerError.ClientRequestID
+	if inner := envelope.Error.InnerError; inner.RequestID != "" {
+		graphErr.RequestID = inner.RequestID
+		graphErr.Date = inner.Date
+	}
+
+	return graphErr
+}
+
+// TokenError is returned when the token endpoint refuses to exchange the
+// owner's refresh token. Code is the OAuth error, e.g. invalid_grant when
+// the user revoked consent or the refresh token expired.
+type TokenError struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *TokenError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "token request failed with status %d", e.StatusCode)
+	if e.Code != "" {
+		fmt.Fprintf(&b, " (%s)", e.Code)
+	}
+	if e.Description != "" {
+		fmt.Fprintf(&b, ": %s", e.Description)
+	}
+	return b.String()
+}
+
+// Retryable reports whether the token request may succeed if sent again.
+func (e *TokenError) Retryable() bool {
+	return retryableStatus(e.StatusCode)
+}
+
+// newTokenError reads and closes an error response from the token endpoint.
+func newTokenError(resp *http.Response) *TokenError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	resp.Body.Close()
+
+	tokenErr := &TokenError{StatusCode: resp.StatusCode}
+
+	var envelope struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Error == "" {
+		tokenErr.Description = strings.TrimSpace(string(body))
+		return tokenErr
+	}
+
+	tokenErr.Code = envelope.Error
+	tokenErr.Description = envelope.ErrorDescription
+	return tokenErr
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as
+// an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// NetworkError is returned when a request couldn't be sent or no response
+// was received, e.g. after a connection reset or timeout.
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("failed to send request: %v", e.Err)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// hasStatus reports whether err is a GraphError with the given status.
+func hasStatus(err error, status int) bool {
+	var graphErr *GraphError
+	return errors.As(err, &graphErr) && graphErr.StatusCode == status
+}
+
+// IntegrityError is returned when the content Graph stored for an upload
+// doesn't hash to the content that was sent. By the time it is returned the
+// uploaded item has been rolled back to its previous version or deleted.
+type IntegrityError struct {
+	ItemID string
+	// Expected is the QuickXorHash of the bytes sent and Actual the one Graph
+	// reported for the item.
+	Expected string
+	Actual   string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("uploaded item %s has quickXorHash %s, expected %s", e.ItemID, e.Actual, e.Expected)
+}
@@ -0,0 +1,103 @@
+package onedrive
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewGraphError_ParsesEnvelope(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Header:     http.Header{"Request-Id": []string{"header-request-id"}},
+		Body: io.NopCloser(strings.NewReader(`{
+			"error": {
+				"code": "itemNotFound",
+				"message": "The resource could not be found.",
+				"innerError": {
+					"request-id": "b6a4c0e2-3f5e-4a57-9a31-5d2c1f0e8a11",
+					"client-request-id": "client-id",
+					"date": "2025-05-12T10:00:00"
+				}
+			}
+		}`)),
+	}
+
+	graphErr := newGraphError(resp)
+
+	assert.Equal(t, http.StatusNotFound, graphErr.StatusCode)
+	assert.Equal(t, "itemNotFound", graphErr.Code)
+	assert.Equal(t, "The resource could not be found.", graphErr.Message)
+	assert.Equal(t, "b6a4c0e2-3f5e-4a57-9a31-5d2c1f0e8a11", graphErr.RequestID)
+	assert.Equal(t, "client-id", graphErr.ClientRequestID)
+	assert.Equal(t, "2025-05-12T10:00:00", graphErr.Date)
+	assert.Equal(t,
+		"graph request failed with status 404 (itemNotFound): The resource could not be found. "+
+			"[request-id: b6a4c0e2-3f5e-4a57-9a31-5d2c1f0e8a11, date: 2025-05-12T10:00:00]",
+		graphErr.Error(),
+	)
+}
+
+func TestNewGraphError_NonGraphBody(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusBadGateway,
+		Header: http.Header{
+			"Request-Id":  []string{"header-request-id"},
+			"Retry-After": []string{"5"},
+		},
+		Body: io.NopCloser(strings.NewReader("<html>Bad Gateway</html>\n")),
+	}
+
+	graphErr := newGraphError(resp)
+
+	assert.Equal(t, "", graphErr.Code)
+	assert.Equal(t, "<html>Bad Gateway</html>", graphErr.Message)
+	assert.Equal(t, "header-request-id", graphErr.RequestID)
+	assert.Equal(t, 5*time.Second, graphErr.RetryAfter)
+}
+
+func TestNewTokenError_ParsesOAuthError(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Body: io.NopCloser(strings.NewReader(`{
+			"error": "invalid_grant",
+			"error_description": "AADSTS70000: The user has revoked consent.",
+			"error_codes": [70000]
+		}`)),
+	}
+
+	tokenErr := newTokenError(resp)
+
+	assert.Equal(t, http.StatusBadRequest, tokenErr.StatusCode)
+	assert.Equal(t, "invalid_grant", tokenErr.Code)
+	assert.Equal(t, "AADSTS70000: The user has revoked consent.", tokenErr.Description)
+	assert.Equal(t, "token request failed with status 400 (invalid_grant): AADSTS70000: The user has revoked consent.", tokenErr.Error())
+	assert.False(t, tokenErr.Retryable())
+}
+
+func TestNewTokenError_NonOAuthBody(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Body:       io.NopCloser(strings.NewReader("<html>Service Unavailable</html>\n")),
+	}
+
+	tokenErr := newTokenError(resp)
+
+	assert.Equal(t, "", tokenErr.Code)
+	assert.Equal(t, "<html>Service Unavailable</html>", tokenErr.Description)
+	assert.True(t, tokenErr.Retryable())
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 5, 12, 10, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
@@ -0,0 +1,114 @@
+package onedrive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// sharedFolderCache is used by every Service, so the folders ensured for one
+// message aren't looked up again for the next.
+var sharedFolderCache = newFolderCache()
+
+// folderCache remembers the IDs of folders known to exist, per drive. Paths
+// are compared case-insensitively, as OneDrive compares them.
+type folderCache struct {
+	mu      sync.Mutex
+	folders map[string]map[string]string
+}
+
+func newFolderCache() *folderCache {
+	return &folderCache{folders: make(map[string]map[string]string)}
+}
+
+func (c *folderCache) get(driveID, folderPath string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, ok := c.folders[driveID][strings.ToLower(folderPath)]
+	return id, ok
+}
+
+func (c *folderCache) put(driveID, folderPath, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.folders[driveID] == nil {
+		c.folders[driveID] = make(map[string]string)
+	}
+	c.folders[driveID][strings.ToLower(folderPath)] = id
+}
+
+// forget drops a folder and everything below it, e.g. after it turned out to
+// have been deleted.
+func (c *folderCache) forget(driveID, folderPath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	folderPath = strings.ToLower(folderPath)
+	for cached := range c.folders[driveID] {
+		if cached == folderPath || strings.HasPrefix(cached, folderPath+"/") {
+			delete(c.folders[driveID], cached)
+		}
+	}
+}
+
+// EnsureFolder makes sure every folder along folderPath exists, creating the
+// ones that don't. Segments are used as given, so they should already have
+// been through SanitizeName. Folders that are found or created are cached,
+// so syncing many files into the same folder only looks it up once.
+func (s *Service) EnsureFolder(ctx context.Context, driveID, folderPath string) error {
+	_, err := s.ensureFolder(ctx, driveID, pathSegments(folderPath))
+	return err
+}
+
+// ensureFolder returns a reference to the folder made up of segments,
+// creating it and any missing parents.
+func (s *Service) ensureFolder(ctx context.Context, driveID string, segments []string) (ItemRef, error) {
+	if len(segments) == 0 {
+		return ItemRef{Path: "/"}, nil
+	}
+
+	folderPath := "/" + strings.Join(segments, "/")
+	if id, ok := s.folders.get(driveID, folderPath); ok {
+		return ItemRef{ID: id}, nil
+	}
+
+	item, err := s.GetItem(ctx, driveID, ItemRef{Path: folderPath})
+	if hasStatus(err, http.StatusNotFound) {
+		item, err = s.createChildFolder(ctx, driveID, segments)
+	}
+	if err != nil {
+		return ItemRef{}, fmt.Errorf("failed to ensure folder %s: %w", folderPath, err)
+	}
+	if item.Folder == nil {
+		return ItemRef{}, fmt.Errorf("failed to ensure folder %s: a file already exists there", folderPath)
+	}
+
+	s.folders.put(driveID, folderPath, item.ID)
+	return ItemRef{ID: item.ID}, nil
+}
+
+// createChildFolder creates the last of segments inside its parent, ensuring
+// the parent first. If a cached parent has since been deleted, it is
+// forgotten and ensured again.
+func (s *Service) createChildFolder(ctx context.Context, driveID string, segments []string) (*DriveItem, error) {
+	parentSegments := segments[:len(segments)-1]
+	folderPath := "/" + strings.Join(segments, "/")
+
+	for attempt := 1; ; attempt++ {
+		parent, err := s.ensureFolder(ctx, driveID, parentSegments)
+		if err != nil {
+			return nil, err
+		}
+
+		item, err := s.createFolderIn(ctx, driveID, parent, folderPath)
+		if hasStatus(err, http.StatusNotFound) && parent.ID != "" && attempt == 1 {
+			s.folders.forget(driveID, "/"+strings.Join(parentSegments, "/"))
+			continue
+		}
+		return item, err
+	}
+}
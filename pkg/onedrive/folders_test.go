@@ -0,0 +1,92 @@
+package onedrive
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var notFoundError = &GraphError{StatusCode: 404, Code: "itemNotFound"}
+
+func TestEnsureFolder_CreatesMissingFolders(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	mockClient.On("DoRequest", "GET", "/drives/test-drive/root:/Client%20Files/2025:", mock.Anything).
+		Return(nil, notFoundError).Once()
+	mockClient.On("DoRequest", "GET", "/drives/test-drive/root:/Client%20Files:", mock.Anything).
+		Return(jsonResponse(200, `{"id": "clients-id", "folder": {"childCount": 1}}`), nil).Once()
+	mockClient.On("DoRequest", "POST", "/drives/test-drive/items/clients-id/children", mock.Anything).
+		Return(jsonResponse(201, `{"id": "2025-id", "name": "2025", "folder": {"childCount": 0}}`), nil).Once()
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	err := service.EnsureFolder(context.Background(), "test-drive", "/Client Files/2025")
+	assert.NoError(t, err)
+
+	// cached, so no more requests are made
+	err = service.EnsureFolder(context.Background(), "test-drive", "client files/2025/")
+	assert.NoError(t, err)
+
+	assert.JSONEq(t,
+		`{"name": "2025", "folder": {}, "@microsoft.graph.conflictBehavior": "fail"}`,
+		mockClient.bodies["/drives/test-drive/items/clients-id/children"],
+	)
+	mockClient.AssertExpectations(t)
+}
+
+func TestEnsureFolder_Root(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+
+	service := NewServiceWithDependencies(nil, mockClient, new(MockDBRepository))
+
+	assert.NoError(t, service.EnsureFolder(context.Background(), "test-drive", "/"))
+	mockClient.AssertNotCalled(t, "DoRequest", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestEnsureFolder_FileInTheWay(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+
+	mockClient.On("DoRequest", "GET", "/drives/test-drive/root:/Reports:", mock.Anything).
+		Return(jsonResponse(200, `{"id": "file-id", "name": "Reports"}`), nil)
+
+	service := NewServiceWithDependencies(nil, mockClient, new(MockDBRepository))
+
+	err := service.EnsureFolder(context.Background(), "test-drive", "/Reports")
+
+	assert.ErrorContains(t, err, "a file already exists there")
+}
+
+func TestEnsureFolder_ForgetsDeletedParent(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+
+	service := NewServiceWithDependencies(nil, mockClient, new(MockDBRepository))
+	service.folders.put("test-drive", "/Clients", "deleted-id")
+	service.folders.put("test-drive", "/Clients/Old", "deleted-child-id")
+
+	mockClient.On("DoRequest", "GET", "/drives/test-drive/root:/Clients/2025:", mock.Anything).
+		Return(nil, notFoundError).Once()
+	mockClient.On("DoRequest", "POST", "/drives/test-drive/items/deleted-id/children", mock.Anything).
+		Return(nil, notFoundError).Once()
+	mockClient.On("DoRequest", "GET", "/drives/test-drive/root:/Clients:", mock.Anything).
+		Return(nil, notFoundError).Once()
+	mockClient.On("DoRequest", "POST", "/drives/test-drive/root/children", mock.Anything).
+		Return(jsonResponse(201, `{"id": "clients-id", "folder": {}}`), nil).Once()
+	mockClient.On("DoRequest", "POST", "/drives/test-drive/items/clients-id/children", mock.Anything).
+		Return(jsonResponse(201, `{"id": "2025-id", "folder": {}}`), nil).Once()
+
+	err := service.EnsureFolder(context.Background(), "test-drive", "/Clients/2025")
+
+	assert.NoError(t, err)
+	_, ok := service.folders.get("test-drive", "/Clients/Old")
+	assert.False(t, ok)
+	id, _ := service.folders.get("test-drive", "/Clients/2025")
+	assert.Equal(t, "2025-id", id)
+	mockClient.AssertExpectations(t)
+}
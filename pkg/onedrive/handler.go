@@ -1,8 +1,10 @@
 package onedrive
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/jaibhavaya/gogo-files/pkg/config"
 	"github.com/jaibhavaya/gogo-files/pkg/db"
 )
 
@@ -11,17 +13,114 @@ type OneDriveAuthHandler struct {
 	OwnerID      int64
 	UserID       string
 	DbPool       *db.Pool
+	Config       config.Config
 }
 
-func (h *OneDriveAuthHandler) Handle() error {
+func (h *OneDriveAuthHandler) Handle(ctx context.Context) error {
 	fmt.Printf("Handling OneDrive authorization for owner: %d, user: %s\n", h.OwnerID, h.UserID)
 
-	err := db.SaveOneDriveRefreshToken(h.DbPool, h.OwnerID, h.UserID, h.RefreshToken)
+	err := db.SaveOneDriveRefreshToken(ctx, h.DbPool, h.OwnerID, h.UserID, h.RefreshToken)
 	if err != nil {
 		return fmt.Errorf("failed to save OneDrive refresh token: %w", err)
 	}
 
 	fmt.Printf("OneDrive refresh token saved for owner: %d\n", h.OwnerID)
 
+	// tokens minted from the previous authorization may belong to another account
+	sharedTokenCache.invalidate(h.OwnerID)
+
+	// the drive may have changed along with the account, so it is
+	// discovered again on every authorization
+	service := NewService(&db.OneDriveIntegration{
+		OwnerID:      h.OwnerID,
+		UserID:       h.UserID,
+		RefreshToken: h.RefreshToken,
+	}, h.DbPool, h.Config)
+
+	drive, err := service.GetMyDrive(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to discover OneDrive drive: %w", err)
+	}
+
+	if err := db.SaveOneDriveDrive(ctx, h.DbPool, h.OwnerID, drive.record()); err != nil {
+		return fmt.Errorf("failed to save OneDrive drive: %w", err)
+	}
+
+	fmt.Printf("OneDrive %s drive %s saved for owner: %d\n", drive.DriveType, drive.ID, h.OwnerID)
+
 	return nil
 }
+
+// OpsHandler performs a single file or folder operation in a user's OneDrive.
+// Failures of the operation itself are recorded in Err rather than returned,
+// so they can be reported back; Handle only errors when the operation could
+// not be attempted at all, or failed in a way that is worth retrying.
+type OpsHandler struct {
+	Op              string
+	OwnerID         int64
+	UserID          string
+	DriveID         string
+	Item            ItemRef
+	DestinationPath string
+	Name            string
+
+	DbPool *db.Pool
+	Config config.Config
+
+	// Result is the item the operation produced, if any, and Err the reason
+	// the operation failed.
+	Result *DriveItem
+	Err    error
+}
+
+func (h *OpsHandler) Handle(ctx context.Context) error {
+	fmt.Printf("Handling OneDrive %s for owner: %d\n", h.Op, h.OwnerID)
+
+	onedriveIntegration, err := db.GetOneDriveIntegration(ctx, h.DbPool, h.OwnerID)
+	if err != nil {
+		return fmt.Errorf("failed to get onedrive integration: %v", err)
+	}
+	if onedriveIntegration == nil {
+		return fmt.Errorf("%w for owner: %d", db.ErrNoOneDriveIntegration, h.OwnerID)
+	}
+
+	if h.DriveID == "" {
+		h.DriveID = onedriveIntegration.DriveID
+	}
+
+	service := NewService(onedriveIntegration, h.DbPool, h.Config)
+	h.Result, h.Err = h.run(ctx, service)
+	if h.Err != nil {
+		fmt.Printf("OneDrive %s failed for owner: %d: %v\n", h.Op, h.OwnerID, h.Err)
+	}
+
+	if IsRetryable(h.Err) {
+		return fmt.Errorf("OneDrive %s can be retried: %w", h.Op, h.Err)
+	}
+	if IsAuthorizationRevoked(h.Err) {
+		return fmt.Errorf("OneDrive authorization revoked for owner %d: %w", h.OwnerID, h.Err)
+	}
+
+	return nil
+}
+
+func (h *OpsHandler) run(ctx context.Context, service *Service) (*DriveItem, error) {
+	if h.DriveID == "" {
+		return nil, fmt.Errorf("drive_id is required until the owner's drive has been discovered")
+	}
+
+	switch h.Op {
+	case OpCreateFolder:
+		return service.CreateFolder(ctx, h.DriveID, h.Item.Path)
+	case OpMove:
+		return service.MoveItem(ctx, h.DriveID, h.Item, h.DestinationPath, h.Name)
+	case OpRename:
+		return service.RenameItem(ctx, h.DriveID, h.Item, h.Name)
+	case OpCopy:
+		return service.CopyItem(ctx, h.DriveID, h.Item, h.DestinationPath, h.Name)
+	case OpDelete:
+		return nil, service.DeleteItem(ctx, h.DriveID, h.Item)
+	}
+
+	return nil, fmt.Errorf("unknown operation: %s", h.Op)
+}
@@ -0,0 +1,100 @@
+package onedrive
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// forbiddenCharacters maps the characters OneDrive doesn't allow in names to
+// the full width forms Windows and OneDrive users see in their place, so the
+// names still read the same:
+//
+//	"  ->  ＂ (U+FF02)      <  ->  ＜ (U+FF1C)      /  ->  ／ (U+FF0F)
+//	*  ->  ＊ (U+FF0A)      >  ->  ＞ (U+FF1E)      \  ->  ＼ (U+FF3C)
+//	:  ->  ： (U+FF1A)      ?  ->  ？ (U+FF1F)      |  ->  ｜ (U+FF5C)
+var forbiddenCharacters = strings.NewReplacer(
+	`"`, "＂",
+	`*`, "＊",
+	`:`, "：",
+	`<`, "＜",
+	`>`, "＞",
+	`?`, "？",
+	`/`, "／",
+	`\`, "＼",
+	`|`, "｜",
+)
+
+// reservedNames can't be used as a name, with or without an extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM0": true, "COM1": true, "COM2": true, "COM3": true, "COM4": true,
+	"COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT0": true, "LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true,
+	"LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeName makes a file or folder name acceptable to OneDrive:
+//
+//   - forbidden characters are replaced as in forbiddenCharacters
+//   - a trailing dot becomes ． (U+FF0E) and a trailing space ␠ (U+2420),
+//     since OneDrive would otherwise strip or reject them
+//   - reserved device names such as CON or LPT1, with or without an
+//     extension, get an underscore after the base name: CON.txt -> CON_.txt
+//
+// Names that are already acceptable are returned unchanged.
+func SanitizeName(name string) string {
+	name = forbiddenCharacters.Replace(name)
+
+	if trimmed := strings.TrimRight(name, ". "); trimmed != name {
+		var suffix strings.Builder
+		for _, c := range name[len(trimmed):] {
+			if c == '.' {
+				suffix.WriteString("．")
+			} else {
+				suffix.WriteString("␠")
+			}
+		}
+		name = trimmed + suffix.String()
+	}
+
+	base, ext, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(base)] {
+		name = base + "_"
+		if ext != "" {
+			name += "." + ext
+		}
+	}
+
+	return name
+}
+
+// SanitizePath applies SanitizeName to each segment of a path from the drive
+// root, returning it cleaned and with a leading slash.
+func SanitizePath(p string) string {
+	segments := pathSegments(p)
+	for i, segment := range segments {
+		segments[i] = SanitizeName(segment)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// pathSegments splits a path from the drive root into its folder and file
+// names.
+func pathSegments(p string) []string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// escapePath escapes each segment of a path for use in a Graph URL, keeping
+// the slashes between them.
+func escapePath(segments []string) string {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = url.PathEscape(segment)
+	}
+	return strings.Join(escaped, "/")
+}
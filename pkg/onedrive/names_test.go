@@ -0,0 +1,42 @@
+package onedrive
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"Contract.docx", "Contract.docx"},
+		{`What? "Now" <maybe>.txt`, "What？ ＂Now＂ ＜maybe＞.txt"},
+		{`a*b:c/d\e|f`, "a＊b：c／d＼e｜f"},
+		{"Notes.", "Notes．"},
+		{"Draft . ", "Draft␠．␠"},
+		{"CON", "CON_"},
+		{"con.txt", "con_.txt"},
+		{"LPT1.tar.gz", "LPT1_.tar.gz"},
+		{"CONTRACT.pdf", "CONTRACT.pdf"},
+		{"Résumé 100% #1.pdf", "Résumé 100% #1.pdf"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, SanitizeName(tt.name), "name %q", tt.name)
+	}
+}
+
+func TestSanitizePath(t *testing.T) {
+	assert.Equal(t, "/", SanitizePath(""))
+	assert.Equal(t, "/Clients/AUX_/Q1：Q2", SanitizePath("Clients//AUX/Q1:Q2/"))
+}
+
+func TestItemPath_EscapesEverySegment(t *testing.T) {
+	assert.Equal(t,
+		"/drives/d/root:/Client%20Files/%231/100%25/R%C3%A9sum%C3%A9.pdf:",
+		itemPath("d", "/Client Files/#1/100%/", "Résumé.pdf"),
+	)
+	assert.Equal(t, "/drives/d/root:/a.pdf:", itemPath("d", "/", "a.pdf"))
+}
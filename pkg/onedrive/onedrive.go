@@ -1,34 +1,88 @@
 package onedrive
 
 import (
+	"context"
 	"io"
 	"net/http"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/jaibhavaya/gogo-files/pkg/config"
 	"github.com/jaibhavaya/gogo-files/pkg/db"
 )
 
 type HTTPInteractor interface {
-	DoRequest(method, path string, body io.Reader, headers map[string]string) (*http.Response, error)
+	// DoRequest sends an authorized request to a Graph API path. Any 2xx
+	// response is returned with its body open for the caller to read and
+	// close; other statuses are returned as a *GraphError.
+	DoRequest(ctx context.Context, method, path string, body io.Reader, headers map[string]string) (*http.Response, error)
+	DoUploadRequest(ctx context.Context, method, uploadURL string, body io.Reader, headers map[string]string) (*http.Response, error)
 }
 
 type DBInteractor interface {
-	GetOneDriveIntegration(ownerID int64) (*db.OneDriveIntegration, error)
-	GetOneDriveRefreshToken(ownerID int64) (string, error)
-	SaveOneDriveRefreshToken(ownerID int64, userID, refreshToken string) error
+	GetOneDriveIntegration(ctx context.Context, ownerID int64) (*db.OneDriveIntegration, error)
+	GetOneDriveRefreshToken(ctx context.Context, ownerID int64) (string, error)
+	SaveOneDriveRefreshToken(ctx context.Context, ownerID int64, userID, refreshToken string) error
+	RotateOneDriveRefreshToken(ctx context.Context, ownerID int64, previousToken, newToken string) (bool, error)
+}
+
+// DriveItem is the subset of Graph's driveItem resource the service uses.
+type DriveItem struct {
+	ID                   string        `json:"id"`
+	Name                 string        `json:"name"`
+	Size                 int64         `json:"size"`
+	CTag                 string        `json:"cTag"`
+	LastModifiedDateTime time.Time     `json:"lastModifiedDateTime"`
+	ParentReference      ItemReference `json:"parentReference"`
+	Folder               *FolderFacet  `json:"folder,omitempty"`
+	File                 *FileFacet    `json:"file,omitempty"`
+}
+
+type FolderFacet struct {
+	ChildCount int `json:"childCount"`
+}
+
+type FileFacet struct {
+	Hashes Hashes `json:"hashes"`
+}
+
+// Hashes are the content hashes Graph reports for a file. Which ones are
+// present depends on the drive type, but quickXorHash is available on both
+// OneDrive for Business and personal drives.
+type Hashes struct {
+	QuickXorHash string `json:"quickXorHash"`
+}
+
+type ItemReference struct {
+	DriveID string `json:"driveId"`
+	ID      string `json:"id"`
+	Path    string `json:"path"`
+}
+
+// Path returns the item's path relative to the drive root. Graph reports the
+// parent as e.g. "/drive/root:/Documents", so everything up to "root:" is
+// dropped.
+func (d *DriveItem) Path() string {
+	_, parent, _ := strings.Cut(d.ParentReference.Path, "root:")
+	return path.Join("/", parent, d.Name)
 }
 
 type Service struct {
 	dbPool     *db.Pool
 	client     HTTPInteractor
 	repository DBInteractor
+	folders    *folderCache
 }
 
 func NewService(onedriveIntegration *db.OneDriveIntegration, dbPool *db.Pool, cfg config.Config) *Service {
+	repository := db.NewPostgresRepository(dbPool)
+
 	return &Service{
 		dbPool:     dbPool,
-		client:     newClient(onedriveIntegration, cfg.OnedriveClientID, cfg.OnedriveClientSecret),
-		repository: db.NewPostgresRepository(dbPool),
+		client:     newClient(onedriveIntegration, cfg.OnedriveClientID, cfg.OnedriveClientSecret, cfg.GraphTimeoutDuration(), repository),
+		repository: repository,
+		folders:    sharedFolderCache,
 	}
 }
 
@@ -41,6 +95,7 @@ func NewServiceWithDependencies(
 		dbPool:     dbPool,
 		client:     client,
 		repository: repository,
+		folders:    newFolderCache(),
 	}
 }
 
@@ -0,0 +1,251 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	OpCreateFolder = "create_folder"
+	OpMove         = "move"
+	OpRename       = "rename"
+	OpCopy         = "copy"
+	OpDelete       = "delete"
+)
+
+const copyPollInterval = time.Second
+
+var copyPollTimeout = 2 * time.Minute
+
+// ItemRef identifies a drive item either by its ID or by its path from the
+// drive root. The ID wins when both are set.
+type ItemRef struct {
+	ID   string
+	Path string
+}
+
+func (r ItemRef) apiPath(driveID string) string {
+	if r.ID != "" {
+		return fmt.Sprintf("/drives/%s/items/%s", driveID, url.PathEscape(r.ID))
+	}
+
+	cleanPath := path.Clean("/" + r.Path)
+	if cleanPath == "/" {
+		return fmt.Sprintf("/drives/%s/root", driveID)
+	}
+	return itemPath(driveID, path.Dir(cleanPath), path.Base(cleanPath))
+}
+
+// parentReference builds the parentReference used to move or copy an item
+// into a folder, addressed by path.
+func parentReference(driveID, folderPath string) map[string]string {
+	folderPath = strings.TrimSuffix(path.Clean("/"+folderPath), "/")
+	return map[string]string{
+		"driveId": driveID,
+		"path":    fmt.Sprintf("/drives/%s/root:%s", driveID, folderPath),
+	}
+}
+
+// GetItem fetches an item's metadata.
+func (s *Service) GetItem(ctx context.Context, driveID string, item ItemRef) (*DriveItem, error) {
+	resp, err := s.client.DoRequest(ctx, "GET", item.apiPath(driveID), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get item failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return decodeItem(resp, "get item")
+}
+
+// CreateFolder creates the folder at folderPath. If the folder already exists
+// it is returned as is, so creating a folder is idempotent.
+func (s *Service) CreateFolder(ctx context.Context, driveID, folderPath string) (*DriveItem, error) {
+	folderPath = path.Clean("/" + folderPath)
+	if folderPath == "/" {
+		return nil, fmt.Errorf("cannot create the drive root")
+	}
+
+	return s.createFolderIn(ctx, driveID, ItemRef{Path: path.Dir(folderPath)}, folderPath)
+}
+
+// createFolderIn creates the folder at folderPath inside parent, which may be
+// addressed by ID. An existing folder is returned as is.
+func (s *Service) createFolderIn(ctx context.Context, driveID string, parent ItemRef, folderPath string) (*DriveItem, error) {
+	body, err := json.Marshal(map[string]any{
+		"name":                              path.Base(folderPath),
+		"folder":                            map[string]any{},
+		"@microsoft.graph.conflictBehavior": "fail",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal folder: %w", err)
+	}
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+
+	resp, err := s.client.DoRequest(ctx, "POST", parent.apiPath(driveID)+"/children", bytes.NewReader(body), headers)
+	if hasStatus(err, http.StatusConflict) {
+		existing, err := s.GetItem(ctx, driveID, ItemRef{Path: folderPath})
+		if err != nil {
+			return nil, fmt.Errorf("folder exists but could not be fetched: %w", err)
+		}
+		if existing.Folder == nil {
+			return nil, fmt.Errorf("a file already exists at %s", folderPath)
+		}
+		return existing, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create folder failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return decodeItem(resp, "create folder")
+}
+
+// MoveItem moves an item into destinationPath, optionally renaming it.
+func (s *Service) MoveItem(ctx context.Context, driveID string, item ItemRef, destinationPath, newName string) (*DriveItem, error) {
+	update := map[string]any{
+		"parentReference": parentReference(driveID, destinationPath),
+	}
+	if newName != "" {
+		update["name"] = newName
+	}
+
+	return s.updateItem(ctx, driveID, item, update, "move")
+}
+
+// RenameItem renames an item in place.
+func (s *Service) RenameItem(ctx context.Context, driveID string, item ItemRef, newName string) (*DriveItem, error) {
+	if newName == "" {
+		return nil, fmt.Errorf("a new name is required to rename an item")
+	}
+
+	return s.updateItem(ctx, driveID, item, map[string]any{"name": newName}, "rename")
+}
+
+func (s *Service) updateItem(ctx context.Context, driveID string, item ItemRef, update map[string]any, op string) (*DriveItem, error) {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s request: %w", op, err)
+	}
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+
+	resp, err := s.client.DoRequest(ctx, "PATCH", item.apiPath(driveID), bytes.NewReader(body), headers)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	return decodeItem(resp, op)
+}
+
+type copyStatus struct {
+	Status     string `json:"status"`
+	ResourceID string `json:"resourceId"`
+}
+
+// CopyItem copies an item into destinationPath, optionally under a new name.
+// Graph copies asynchronously, so the copy's monitor URL is polled until the
+// new item exists.
+func (s *Service) CopyItem(ctx context.Context, driveID string, item ItemRef, destinationPath, newName string) (*DriveItem, error) {
+	request := map[string]any{
+		"parentReference": parentReference(driveID, destinationPath),
+	}
+	if newName != "" {
+		request["name"] = newName
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal copy request: %w", err)
+	}
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+
+	resp, err := s.client.DoRequest(ctx, "POST", item.apiPath(driveID)+"/copy", bytes.NewReader(body), headers)
+	if err != nil {
+		return nil, fmt.Errorf("copy failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, fmt.Errorf("copy returned status %d instead of starting an asynchronous copy", resp.StatusCode)
+	}
+
+	monitorURL := resp.Header.Get("Location")
+	if monitorURL == "" {
+		return nil, fmt.Errorf("copy response did not include a monitor URL")
+	}
+
+	resourceID, err := s.waitForCopy(ctx, monitorURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetItem(ctx, driveID, ItemRef{ID: resourceID})
+}
+
+func (s *Service) waitForCopy(ctx context.Context, monitorURL string) (string, error) {
+	deadline := time.Now().Add(copyPollTimeout)
+	for {
+		// the monitor URL is pre-authenticated, like an upload session
+		resp, err := s.client.DoUploadRequest(ctx, "GET", monitorURL, nil, nil)
+		if err != nil {
+			return "", fmt.Errorf("error checking copy status: %w", err)
+		}
+
+		var status copyStatus
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to decode copy status: %w", err)
+		}
+
+		switch status.Status {
+		case "completed":
+			return status.ResourceID, nil
+		case "failed", "cancelled":
+			return "", fmt.Errorf("copy %s", status.Status)
+		}
+
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("copy still %s after %v", status.Status, copyPollTimeout)
+		}
+		if err := sleep(ctx, copyPollInterval); err != nil {
+			return "", err
+		}
+	}
+}
+
+// DeleteItem moves an item to the recycle bin.
+func (s *Service) DeleteItem(ctx context.Context, driveID string, item ItemRef) error {
+	resp, err := s.client.DoRequest(ctx, "DELETE", item.apiPath(driveID), nil, nil)
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func decodeItem(resp *http.Response, op string) (*DriveItem, error) {
+	var item DriveItem
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", op, err)
+	}
+
+	return &item, nil
+}
@@ -0,0 +1,72 @@
+package onedrive
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"hash"
+)
+
+// QuickXorHash is the content hash OneDrive reports for every file, in
+// file.hashes.quickXorHash. Each byte is XORed into a 160 bit register at a
+// position that advances 11 bits per byte, and the content length is XORed
+// into the last 64 bits of the result.
+const (
+	quickXorWidth = 160
+	quickXorShift = 11
+	quickXorSize  = quickXorWidth / 8
+)
+
+type quickXorHash struct {
+	register [quickXorSize]byte
+	// position is the bit the next byte is XORed in at.
+	position int
+	length   uint64
+}
+
+// newQuickXorHash returns a hash.Hash computing OneDrive's QuickXorHash.
+func newQuickXorHash() hash.Hash {
+	return &quickXorHash{}
+}
+
+func (h *quickXorHash) Write(p []byte) (int, error) {
+	for _, b := range p {
+		index, shift := h.position/8, h.position%8
+		shifted := uint16(b) << shift
+		h.register[index] ^= byte(shifted)
+		h.register[(index+1)%quickXorSize] ^= byte(shifted >> 8)
+
+		h.position = (h.position + quickXorShift) % quickXorWidth
+	}
+	h.length += uint64(len(p))
+
+	return len(p), nil
+}
+
+func (h *quickXorHash) Sum(b []byte) []byte {
+	sum := h.register
+
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], h.length)
+	for i, l := range length {
+		sum[quickXorSize-len(length)+i] ^= l
+	}
+
+	return append(b, sum[:]...)
+}
+
+func (h *quickXorHash) Reset() {
+	*h = quickXorHash{}
+}
+
+func (h *quickXorHash) Size() int {
+	return quickXorSize
+}
+
+func (h *quickXorHash) BlockSize() int {
+	return 64
+}
+
+// encodeQuickXorHash formats a hash the way Graph reports it.
+func encodeQuickXorHash(h hash.Hash) string {
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
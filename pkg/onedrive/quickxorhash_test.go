@@ -0,0 +1,43 @@
+package onedrive
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuickXorHash(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  []byte
+		expected string
+	}{
+		{"empty", nil, "AAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+		{"single byte", []byte("a"), "YQAAAAAAAAAAAAAAAQAAAAAAAAA="},
+		{"text", []byte("Hello, World!"), "SCgDG9jwBhaA4ApvnQMbyBACAAA="},
+		{"wraps the register", bytes.Repeat([]byte("x"), 1000003), "eMADHgAAAAAAAAAAQ0IPAAAAAAA="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newQuickXorHash()
+			h.Write(tt.content)
+			assert.Equal(t, tt.expected, encodeQuickXorHash(h))
+		})
+	}
+}
+
+func TestQuickXorHash_Streaming(t *testing.T) {
+	content := bytes.Repeat([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, 997)
+
+	whole := newQuickXorHash()
+	whole.Write(content)
+
+	streamed := newQuickXorHash()
+	for i := 0; i < len(content); i += 333 {
+		streamed.Write(content[i:min(i+333, len(content))])
+	}
+
+	assert.Equal(t, encodeQuickXorHash(whole), encodeQuickXorHash(streamed))
+}
@@ -0,0 +1,106 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"syscall"
+	"time"
+)
+
+// IsRetryable reports whether err is a Graph or network failure that may
+// succeed if the operation is tried again.
+func IsRetryable(err error) bool {
+	var graphErr *GraphError
+	if errors.As(err, &graphErr) {
+		return graphErr.Retryable()
+	}
+
+	var tokenErr *TokenError
+	if errors.As(err, &tokenErr) {
+		return tokenErr.Retryable()
+	}
+
+	var networkErr *NetworkError
+	return errors.As(err, &networkErr) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// IsPermanent reports whether err is a Graph error that will fail the same
+// way however often the request is sent.
+func IsPermanent(err error) bool {
+	var graphErr *GraphError
+	return errors.As(err, &graphErr) && !graphErr.Retryable()
+}
+
+// IsAuthorizationRevoked reports whether err is the token endpoint refusing
+// the owner's refresh token for good. The owner has to authorize OneDrive
+// again before any request can succeed.
+func IsAuthorizationRevoked(err error) bool {
+	var tokenErr *TokenError
+	return errors.As(err, &tokenErr) && !tokenErr.Retryable()
+}
+
+// RetryAfter returns the wait Graph asked for in err, or zero.
+func RetryAfter(err error) time.Duration {
+	var graphErr *GraphError
+	if errors.As(err, &graphErr) {
+		return graphErr.RetryAfter
+	}
+	return 0
+}
+
+// retryPolicy controls how requests that fail with a retryable error are
+// retried.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	// maxRetryAfter is the longest Retry-After honoured in place. Longer waits
+	// are returned to the caller, which is better placed to wait them out.
+	maxRetryAfter time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{
+	maxAttempts:   4,
+	baseDelay:     500 * time.Millisecond,
+	maxDelay:      30 * time.Second,
+	maxRetryAfter: time.Minute,
+}
+
+// delay returns how long to wait before the given retry, counting from 1.
+// Graph's Retry-After wins when it was given; otherwise the delay backs off
+// exponentially, with jitter so throttled workers don't retry in lockstep.
+func (p retryPolicy) delay(retry int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+
+	backoff := p.baseDelay << (retry - 1)
+	if backoff > p.maxDelay || backoff <= 0 {
+		backoff = p.maxDelay
+	}
+
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// sleep waits for d, returning ctx's error instead if it is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shouldRetry reports whether a request that failed with err on the given
+// attempt, counting from 1, should be sent again.
+func (p retryPolicy) shouldRetry(attempt int, err error) bool {
+	if attempt >= p.maxAttempts || !IsRetryable(err) {
+		return false
+	}
+	return RetryAfter(err) <= p.maxRetryAfter
+}
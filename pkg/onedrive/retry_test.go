@@ -0,0 +1,66 @@
+package onedrive
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"throttled", &GraphError{StatusCode: http.StatusTooManyRequests}, true},
+		{"unavailable", &GraphError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"server error", fmt.Errorf("upload failed: %w", &GraphError{StatusCode: http.StatusInternalServerError}), true},
+		{"network", &NetworkError{Err: errors.New("connection reset by peer")}, true},
+		{"token endpoint unavailable", fmt.Errorf("failed to get access token: %w", &TokenError{StatusCode: http.StatusServiceUnavailable}), true},
+		{"token refused", &TokenError{StatusCode: http.StatusBadRequest, Code: "invalid_grant"}, false},
+		{"unauthorized", &GraphError{StatusCode: http.StatusUnauthorized}, false},
+		{"forbidden", &GraphError{StatusCode: http.StatusForbidden}, false},
+		{"not found", &GraphError{StatusCode: http.StatusNotFound}, false},
+		{"conflict", &GraphError{StatusCode: http.StatusConflict}, false},
+		{"not implemented", &GraphError{StatusCode: http.StatusNotImplemented}, false},
+		{"other", errors.New("failed to decode uploaded item"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsRetryable(tt.err))
+			if tt.want {
+				assert.False(t, IsPermanent(tt.err))
+			}
+		})
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	assert.True(t, IsPermanent(fmt.Errorf("rename failed: %w", &GraphError{StatusCode: http.StatusNotFound})))
+	assert.False(t, IsPermanent(&GraphError{StatusCode: http.StatusTooManyRequests}))
+	// errors that didn't come from Graph may still be transient
+	assert.False(t, IsPermanent(errors.New("connection refused")))
+}
+
+func TestIsAuthorizationRevoked(t *testing.T) {
+	assert.True(t, IsAuthorizationRevoked(fmt.Errorf("failed to get access token: %w", &TokenError{StatusCode: http.StatusBadRequest, Code: "invalid_grant"})))
+	assert.False(t, IsAuthorizationRevoked(&TokenError{StatusCode: http.StatusTooManyRequests}))
+	assert.False(t, IsAuthorizationRevoked(&GraphError{StatusCode: http.StatusUnauthorized}))
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := retryPolicy{baseDelay: time.Second, maxDelay: 8 * time.Second}
+
+	assert.Equal(t, 20*time.Second, policy.delay(1, 20*time.Second))
+
+	for retry, max := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 10: 8 * time.Second} {
+		delay := policy.delay(retry, 0)
+		assert.GreaterOrEqual(t, delay, max/2)
+		assert.LessOrEqual(t, delay, max)
+	}
+}
@@ -1,14 +1,16 @@
 package onedrive
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/url"
-	"strings"
 )
 
-func (s *Service) GetRefreshToken(ownerID int64) (string, error) {
-	refreshToken, err := s.repository.GetOneDriveRefreshToken(ownerID)
+func (s *Service) GetRefreshToken(ctx context.Context, ownerID int64) (string, error) {
+	refreshToken, err := s.repository.GetOneDriveRefreshToken(ctx, ownerID)
 	if err != nil {
 		return "", fmt.Errorf("failed to get Refresh Token: %w", err)
 	}
@@ -16,8 +18,9 @@ func (s *Service) GetRefreshToken(ownerID int64) (string, error) {
 	return refreshToken, nil
 }
 
-func (s *Service) SaveRefreshToken(ownerID int64, userID, refreshToken string) error {
+func (s *Service) SaveRefreshToken(ctx context.Context, ownerID int64, userID, refreshToken string) error {
 	err := s.repository.SaveOneDriveRefreshToken(
+		ctx,
 		ownerID,
 		userID,
 		refreshToken,
@@ -29,31 +32,62 @@ func (s *Service) SaveRefreshToken(ownerID int64, userID, refreshToken string) e
 	return nil
 }
 
-func (s *Service) UploadSmallFile(driveID, folderPath, fileName string, fileContent io.Reader, fileSize int64) error {
-	folderPath = strings.TrimPrefix(folderPath, "/")
-	folderPath = strings.TrimSuffix(folderPath, "/")
+// Values of Graph's @microsoft.graph.conflictBehavior, which decides what
+// happens when an item is created at a path that is already taken.
+const (
+	ConflictReplace = "replace"
+	ConflictRename  = "rename"
+	ConflictFail    = "fail"
+)
 
-	apiPath := fmt.Sprintf(
-		"/drives/%s/root:/%s/%s:/content",
-		driveID, folderPath, url.PathEscape(fileName),
-	)
+// itemPath addresses a file by its path relative to the drive root. Each
+// segment of the path is escaped, so names may contain spaces, # or %.
+func itemPath(driveID, folderPath, fileName string) string {
+	segments := append(pathSegments(folderPath), fileName)
+	return fmt.Sprintf("/drives/%s/root:/%s:", driveID, escapePath(segments))
+}
+
+// UploadSmallFile uploads content in a single request. conflictBehavior is
+// what Graph does if an item already exists at the path; see
+// ConflictReplace, ConflictRename and ConflictFail.
+func (s *Service) UploadSmallFile(ctx context.Context, driveID, folderPath, fileName string, fileContent io.Reader, fileSize int64, conflictBehavior string) (*DriveItem, error) {
+	apiPath := itemPath(driveID, folderPath, fileName) + "/content"
+	if conflictBehavior != "" {
+		apiPath += "?@microsoft.graph.conflictBehavior=" + url.QueryEscape(conflictBehavior)
+	}
 
 	headers := map[string]string{
 		"Content-Type":   "application/octet-stream",
 		"Content-Length": fmt.Sprintf("%d", fileSize),
 	}
 
-	resp, err := s.client.DoRequest("PUT", apiPath, fileContent, headers)
+	// buffered, so the request can be replayed when Graph throttles it, and
+	// hashed to check against what Graph stored
+	content, err := io.ReadAll(fileContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file content: %w", &NetworkError{Err: err})
+	}
+	contentHash := newQuickXorHash()
+	contentHash.Write(content)
+
+	resp, err := s.client.DoRequest(ctx, "PUT", apiPath, bytes.NewReader(content), headers)
 	if err != nil {
-		return fmt.Errorf("error sending request: %v", err)
+		return nil, fmt.Errorf("error sending request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(body))
+	var item DriveItem
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		return nil, fmt.Errorf("failed to decode uploaded item: %w", err)
 	}
 
-	return nil
+	err = s.verifyUpload(ctx, driveID, &item, func() (string, error) {
+		return encodeQuickXorHash(contentHash), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
 }
 
@@ -2,9 +2,12 @@ package onedrive
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -15,9 +18,19 @@ import (
 
 type MockHTTPClient struct {
 	mock.Mock
+	// bodies holds the body sent with each DoRequest, by path
+	bodies map[string]string
 }
 
-func (m *MockHTTPClient) DoRequest(method, path string, body io.Reader, headers map[string]string) (*http.Response, error) {
+func (m *MockHTTPClient) DoRequest(ctx context.Context, method, path string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	// read the body like a real transport would, so it is hashed
+	if body != nil {
+		content, _ := io.ReadAll(body)
+		if m.bodies == nil {
+			m.bodies = map[string]string{}
+		}
+		m.bodies[path] = string(content)
+	}
 	args := m.Called(method, path, headers)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -25,11 +38,23 @@ func (m *MockHTTPClient) DoRequest(method, path string, body io.Reader, headers
 	return args.Get(0).(*http.Response), args.Error(1)
 }
 
+func (m *MockHTTPClient) DoUploadRequest(ctx context.Context, method, uploadURL string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	// read the body like a real transport would, so it is hashed
+	if body != nil {
+		io.Copy(io.Discard, body)
+	}
+	args := m.Called(method, uploadURL, headers)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*http.Response), args.Error(1)
+}
+
 type MockDBRepository struct {
 	mock.Mock
 }
 
-func (m *MockDBRepository) GetOneDriveIntegration(ownerID int64) (*db.OneDriveIntegration, error) {
+func (m *MockDBRepository) GetOneDriveIntegration(ctx context.Context, ownerID int64) (*db.OneDriveIntegration, error) {
 	args := m.Called(ownerID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -37,16 +62,21 @@ func (m *MockDBRepository) GetOneDriveIntegration(ownerID int64) (*db.OneDriveIn
 	return args.Get(0).(*db.OneDriveIntegration), args.Error(1)
 }
 
-func (m *MockDBRepository) SaveOneDriveRefreshToken(ownerID int64, userID, refreshToken string) error {
+func (m *MockDBRepository) SaveOneDriveRefreshToken(ctx context.Context, ownerID int64, userID, refreshToken string) error {
 	args := m.Called(ownerID, userID, refreshToken)
 	return args.Error(0)
 }
 
-func (m *MockDBRepository) GetOneDriveRefreshToken(ownerID int64) (string, error) {
+func (m *MockDBRepository) GetOneDriveRefreshToken(ctx context.Context, ownerID int64) (string, error) {
 	args := m.Called(ownerID)
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockDBRepository) RotateOneDriveRefreshToken(ctx context.Context, ownerID int64, previousToken, newToken string) (bool, error) {
+	args := m.Called(ownerID, previousToken, newToken)
+	return args.Bool(0), args.Error(1)
+}
+
 func TestGetRefreshToken_Success(t *testing.T) {
 	mockClient := new(MockHTTPClient)
 	mockRepository := new(MockDBRepository)
@@ -60,7 +90,7 @@ func TestGetRefreshToken_Success(t *testing.T) {
 		mockRepository,
 	)
 
-	token, err := service.GetRefreshToken(123)
+	token, err := service.GetRefreshToken(context.Background(), 123)
 
 	assert.NoError(t, err)
 	assert.Equal(t, expectedToken, token)
@@ -80,7 +110,7 @@ func TestGetRefreshToken_Error(t *testing.T) {
 		mockRepository,
 	)
 
-	token, err := service.GetRefreshToken(123)
+	token, err := service.GetRefreshToken(context.Background(), 123)
 
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to get Refresh Token")
@@ -112,9 +142,32 @@ func TestUploadSmallFile_Success(t *testing.T) {
 		mockRepository,
 	)
 
-	err := service.UploadSmallFile("test-drive", "/Documents/Reports", "test-file.txt", reader, fileSize)
+	item, err := service.UploadSmallFile(context.Background(), "test-drive", "/Documents/Reports", "test-file.txt", reader, fileSize, "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "123", item.ID)
+	mockClient.AssertExpectations(t)
+}
+
+func TestUploadSmallFile_ConflictBehavior(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	fileContent := []byte("test file content")
+
+	mockClient.On("DoRequest", "PUT", "/drives/test-drive/root:/Documents/test-file.txt:/content?@microsoft.graph.conflictBehavior=rename", mock.Anything).
+		Return(jsonResponse(201, `{"id": "123", "name": "test-file 1.txt"}`), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	item, err := service.UploadSmallFile(context.Background(), "test-drive", "/Documents", "test-file.txt", bytes.NewReader(fileContent), int64(len(fileContent)), ConflictRename)
 
 	assert.NoError(t, err)
+	assert.Equal(t, "test-file 1.txt", item.Name)
 	mockClient.AssertExpectations(t)
 }
 
@@ -135,7 +188,7 @@ func TestUploadSmallFile_RequestError(t *testing.T) {
 		mockRepository,
 	)
 
-	err := service.UploadSmallFile("test-drive", "/Documents/Reports", "test-file.txt", reader, fileSize)
+	_, err := service.UploadSmallFile(context.Background(), "test-drive", "/Documents/Reports", "test-file.txt", reader, fileSize, "")
 
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "error sending request")
@@ -150,13 +203,100 @@ func TestUploadSmallFile_BadResponse(t *testing.T) {
 	fileSize := int64(len(fileContent))
 	reader := bytes.NewReader(fileContent)
 
-	responseBody := io.NopCloser(strings.NewReader(`{"error": "Bad request"}`))
-	response := &http.Response{
-		StatusCode: 400,
-		Body:       responseBody,
+	mockClient.On("DoRequest", "PUT", mock.Anything, mock.Anything).
+		Return(nil, &GraphError{StatusCode: 400, Code: "invalidRequest"})
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	_, err := service.UploadSmallFile(context.Background(), "test-drive", "/Documents/Reports", "test-file.txt", reader, fileSize, "")
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "graph request failed with status 400")
+	assert.False(t, IsRetryable(err))
+	mockClient.AssertExpectations(t)
+}
+
+func TestUploadSmallFile_RetriesThrottledUpload(t *testing.T) {
+	fileContent := []byte("test file content")
+	contentHash := newQuickXorHash()
+	contentHash.Write(fileContent)
+
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id": "123", "file": {"hashes": {"quickXorHash": %q}}}`, encodeQuickXorHash(contentHash))
+	}))
+	defer server.Close()
+
+	service := NewServiceWithDependencies(nil, newRetryTestClient(t, server.URL), new(MockDBRepository))
+
+	item, err := service.UploadSmallFile(context.Background(), "test-drive", "/Documents", "test-file.txt", bytes.NewReader(fileContent), int64(len(fileContent)), "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "123", item.ID)
+	assert.Equal(t, []string{"test file content", "test file content"}, bodies)
+}
+
+type bytesSource struct {
+	content []byte
+	opened  []int64
+}
+
+func (b *bytesSource) OpenRange(ctx context.Context, offset int64) (io.ReadCloser, error) {
+	b.opened = append(b.opened, offset)
+	return io.NopCloser(bytes.NewReader(b.content[offset:])), nil
+}
+
+func jsonResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(body)),
 	}
+}
 
-	mockClient.On("DoRequest", "PUT", mock.Anything, mock.Anything).Return(response, nil)
+func contentRange(expected string) interface{} {
+	return mock.MatchedBy(func(headers map[string]string) bool {
+		return headers["Content-Range"] == expected
+	})
+}
+
+func TestDriveItemPath(t *testing.T) {
+	item := DriveItem{
+		Name:            "Contract.docx",
+		ParentReference: ItemReference{Path: "/drive/root:/Documents/Contracts"},
+	}
+	assert.Equal(t, "/Documents/Contracts/Contract.docx", item.Path())
+
+	item.ParentReference.Path = "/drives/b!abc/root:"
+	assert.Equal(t, "/Contract.docx", item.Path())
+}
+
+const testUploadURL = "https://upload.example.com/session"
+
+func TestUploadLargeFile_Success(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	fileSize := UploadChunkSize + 100
+	source := &bytesSource{content: make([]byte, fileSize)}
+
+	mockClient.On("DoRequest", "POST", "/drives/test-drive/root:/Documents/Reports/big.pdf:/createUploadSession", mock.Anything).
+		Return(jsonResponse(200, `{"uploadUrl": "`+testUploadURL+`"}`), nil)
+	mockClient.On("DoUploadRequest", "PUT", testUploadURL, contentRange("bytes 0-3276799/3276900")).
+		Return(jsonResponse(202, `{"nextExpectedRanges": ["3276800-"]}`), nil)
+	mockClient.On("DoUploadRequest", "PUT", testUploadURL, contentRange("bytes 3276800-3276899/3276900")).
+		Return(jsonResponse(201, `{"id": "123"}`), nil)
 
 	service := NewServiceWithDependencies(
 		nil,
@@ -164,10 +304,522 @@ func TestUploadSmallFile_BadResponse(t *testing.T) {
 		mockRepository,
 	)
 
-	err := service.UploadSmallFile("test-drive", "/Documents/Reports", "test-file.txt", reader, fileSize)
+	item, err := service.UploadLargeFile(context.Background(), UploadLargeFileParams{
+		DriveID:    "test-drive",
+		FolderPath: "/Documents/Reports",
+		FileName:   "big.pdf",
+		Source:     source,
+		FileSize:   fileSize,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "123", item.ID)
+	assert.Equal(t, []int64{0}, source.opened)
+	mockClient.AssertExpectations(t)
+}
+
+func TestUploadLargeFile_CancelledBetweenRanges(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	fileSize := UploadChunkSize + 100
+	source := &bytesSource{content: make([]byte, fileSize)}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mockClient.On("DoRequest", "POST", "/drives/test-drive/root:/Documents/Reports/big.pdf:/createUploadSession", mock.Anything).
+		Return(jsonResponse(200, `{"uploadUrl": "`+testUploadURL+`"}`), nil)
+	mockClient.On("DoUploadRequest", "PUT", testUploadURL, contentRange("bytes 0-3276799/3276900")).
+		Run(func(mock.Arguments) { cancel() }).
+		Return(jsonResponse(202, `{"nextExpectedRanges": ["3276800-"]}`), nil)
+	mockClient.On("DoUploadRequest", "DELETE", testUploadURL, mock.Anything).
+		Return(jsonResponse(204, ``), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	_, err := service.UploadLargeFile(ctx, UploadLargeFileParams{
+		DriveID:    "test-drive",
+		FolderPath: "/Documents/Reports",
+		FileName:   "big.pdf",
+		Source:     source,
+		FileSize:   fileSize,
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	mockClient.AssertNotCalled(t, "DoUploadRequest", "PUT", testUploadURL, contentRange("bytes 3276800-3276899/3276900"))
+	mockClient.AssertExpectations(t)
+}
+
+func TestUploadLargeFile_ConflictBehavior(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	source := &bytesSource{content: make([]byte, 100)}
+	createPath := "/drives/test-drive/root:/Documents/Reports/big.pdf:/createUploadSession"
+
+	mockClient.On("DoRequest", "POST", createPath, mock.Anything).
+		Return(jsonResponse(200, `{"uploadUrl": "`+testUploadURL+`"}`), nil)
+	mockClient.On("DoUploadRequest", "PUT", testUploadURL, contentRange("bytes 0-99/100")).
+		Return(jsonResponse(201, `{"id": "123"}`), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	_, err := service.UploadLargeFile(context.Background(), UploadLargeFileParams{
+		DriveID:          "test-drive",
+		FolderPath:       "/Documents/Reports",
+		FileName:         "big.pdf",
+		Source:           source,
+		FileSize:         100,
+		ConflictBehavior: ConflictFail,
+	})
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"item": {"@microsoft.graph.conflictBehavior": "fail"}}`, mockClient.bodies[createPath])
+	mockClient.AssertExpectations(t)
+}
+
+// noRangeRetryDelay retries failed ranges immediately for the rest of the
+// test.
+func noRangeRetryDelay(t *testing.T) {
+	policy := rangeRetryPolicy
+	rangeRetryPolicy.baseDelay = 0
+	rangeRetryPolicy.maxDelay = 0
+	t.Cleanup(func() { rangeRetryPolicy = policy })
+}
+
+func TestUploadLargeFile_RetriesFailedRange(t *testing.T) {
+	noRangeRetryDelay(t)
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	fileSize := UploadChunkSize + 100
+	source := &bytesSource{content: make([]byte, fileSize)}
+
+	mockClient.On("DoRequest", "POST", mock.Anything, mock.Anything).
+		Return(jsonResponse(200, `{"uploadUrl": "`+testUploadURL+`"}`), nil)
+	mockClient.On("DoUploadRequest", "PUT", testUploadURL, contentRange("bytes 0-3276799/3276900")).
+		Return(nil, &GraphError{StatusCode: 503, Code: "serviceNotAvailable"}).Once()
+	mockClient.On("DoUploadRequest", "PUT", testUploadURL, contentRange("bytes 0-3276799/3276900")).
+		Return(jsonResponse(202, `{"nextExpectedRanges": ["3276800-"]}`), nil).Once()
+	mockClient.On("DoUploadRequest", "PUT", testUploadURL, contentRange("bytes 3276800-3276899/3276900")).
+		Return(jsonResponse(201, `{"id": "123"}`), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	_, err := service.UploadLargeFile(context.Background(), UploadLargeFileParams{
+		DriveID:    "test-drive",
+		FolderPath: "/Documents/Reports",
+		FileName:   "big.pdf",
+		Source:     source,
+		FileSize:   fileSize,
+	})
+
+	assert.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
+
+func TestUploadLargeFile_ResumesFromNextExpectedRanges(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	fileSize := UploadChunkSize + 100
+	source := &bytesSource{content: make([]byte, fileSize)}
+
+	mockClient.On("DoRequest", "POST", mock.Anything, mock.Anything).
+		Return(jsonResponse(200, `{"uploadUrl": "`+testUploadURL+`"}`), nil)
+	mockClient.On("DoUploadRequest", "PUT", testUploadURL, contentRange("bytes 0-3276799/3276900")).
+		Return(nil, &GraphError{StatusCode: 416, Code: "invalidRange"}).Once()
+	mockClient.On("DoUploadRequest", "GET", testUploadURL, mock.Anything).
+		Return(jsonResponse(200, `{"nextExpectedRanges": ["3276800-3276899"]}`), nil).Once()
+	mockClient.On("DoUploadRequest", "PUT", testUploadURL, contentRange("bytes 3276800-3276899/3276900")).
+		Return(jsonResponse(201, `{"id": "123"}`), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	_, err := service.UploadLargeFile(context.Background(), UploadLargeFileParams{
+		DriveID:    "test-drive",
+		FolderPath: "/Documents/Reports",
+		FileName:   "big.pdf",
+		Source:     source,
+		FileSize:   fileSize,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{0, UploadChunkSize}, source.opened)
+	mockClient.AssertExpectations(t)
+}
+
+func TestUploadLargeFile_ResumesPreviousSession(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	fileSize := UploadChunkSize + 100
+	source := &bytesSource{content: make([]byte, fileSize)}
+
+	mockClient.On("DoUploadRequest", "GET", testUploadURL, mock.Anything).
+		Return(jsonResponse(200, `{"nextExpectedRanges": ["3276800-"]}`), nil).Once()
+	mockClient.On("DoUploadRequest", "PUT", testUploadURL, contentRange("bytes 3276800-3276899/3276900")).
+		Return(jsonResponse(201, `{"id": "123"}`), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	var committed []int64
+	_, err := service.UploadLargeFile(context.Background(), UploadLargeFileParams{
+		DriveID:    "test-drive",
+		FolderPath: "/Documents/Reports",
+		FileName:   "big.pdf",
+		Source:     source,
+		FileSize:   fileSize,
+		Session:    &UploadSession{UploadURL: testUploadURL},
+		OnProgress: func(session UploadSession, bytes int64) {
+			assert.Equal(t, testUploadURL, session.UploadURL)
+			committed = append(committed, bytes)
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{UploadChunkSize}, source.opened)
+	assert.Equal(t, []int64{UploadChunkSize}, committed)
+	mockClient.AssertNotCalled(t, "DoRequest", "POST", mock.Anything, mock.Anything)
+	mockClient.AssertExpectations(t)
+}
+
+func TestUploadLargeFile_ExpiredPreviousSession(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	fileSize := UploadChunkSize + 100
+	source := &bytesSource{content: make([]byte, fileSize)}
+	newUploadURL := testUploadURL + "-new"
+
+	mockClient.On("DoUploadRequest", "GET", testUploadURL, mock.Anything).
+		Return(nil, &GraphError{StatusCode: 404, Code: "itemNotFound"}).Once()
+	mockClient.On("DoRequest", "POST", mock.Anything, mock.Anything).
+		Return(jsonResponse(200, `{"uploadUrl": "`+newUploadURL+`"}`), nil)
+	mockClient.On("DoUploadRequest", "PUT", newUploadURL, contentRange("bytes 0-3276799/3276900")).
+		Return(jsonResponse(202, `{"nextExpectedRanges": ["3276800-"]}`), nil)
+	mockClient.On("DoUploadRequest", "PUT", newUploadURL, contentRange("bytes 3276800-3276899/3276900")).
+		Return(jsonResponse(201, `{"id": "123"}`), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	_, err := service.UploadLargeFile(context.Background(), UploadLargeFileParams{
+		DriveID:    "test-drive",
+		FolderPath: "/Documents/Reports",
+		FileName:   "big.pdf",
+		Source:     source,
+		FileSize:   fileSize,
+		Session:    &UploadSession{UploadURL: testUploadURL},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{0}, source.opened)
+	mockClient.AssertExpectations(t)
+}
+
+func TestCreateFolder_Success(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	mockClient.On("DoRequest", "POST", "/drives/test-drive/root:/Documents:/children", mock.Anything).
+		Return(jsonResponse(201, `{"id": "folder-id", "name": "Clients", "folder": {"childCount": 0}}`), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	item, err := service.CreateFolder(context.Background(), "test-drive", "/Documents/Clients/")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "folder-id", item.ID)
+	assert.NotNil(t, item.Folder)
+	mockClient.AssertExpectations(t)
+}
+
+func TestCreateFolder_AlreadyExists(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	mockClient.On("DoRequest", "POST", "/drives/test-drive/root/children", mock.Anything).
+		Return(nil, &GraphError{StatusCode: 409, Code: "nameAlreadyExists"})
+	mockClient.On("DoRequest", "GET", "/drives/test-drive/root:/Clients:", mock.Anything).
+		Return(jsonResponse(200, `{"id": "folder-id", "name": "Clients", "folder": {"childCount": 3}}`), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	item, err := service.CreateFolder(context.Background(), "test-drive", "Clients")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "folder-id", item.ID)
+	mockClient.AssertExpectations(t)
+}
+
+func TestMoveItem_ByID(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	mockClient.On("DoRequest", "PATCH", "/drives/test-drive/items/item-id", mock.Anything).
+		Return(jsonResponse(200, `{"id": "item-id", "name": "a.pdf", "parentReference": {"path": "/drive/root:/Archive"}}`), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	item, err := service.MoveItem(context.Background(), "test-drive", ItemRef{ID: "item-id", Path: "/ignored.pdf"}, "/Archive", "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/Archive/a.pdf", item.Path())
+	mockClient.AssertExpectations(t)
+}
+
+func TestRenameItem_NotFound(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	mockClient.On("DoRequest", "PATCH", "/drives/test-drive/root:/Documents/a.pdf:", mock.Anything).
+		Return(nil, &GraphError{StatusCode: 404, Code: "itemNotFound"})
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	_, err := service.RenameItem(context.Background(), "test-drive", ItemRef{Path: "/Documents/a.pdf"}, "b.pdf")
 
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "upload failed with status 400")
+	assert.Contains(t, err.Error(), "rename failed: graph request failed with status 404 (itemNotFound)")
+	assert.False(t, IsRetryable(err))
+	mockClient.AssertExpectations(t)
+}
+
+func TestCopyItem_WaitsForCompletion(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	accepted := jsonResponse(202, ``)
+	accepted.Header = http.Header{"Location": []string{"https://monitor.example.com/copy"}}
+
+	mockClient.On("DoRequest", "POST", "/drives/test-drive/items/item-id/copy", mock.Anything).
+		Return(accepted, nil)
+	mockClient.On("DoUploadRequest", "GET", "https://monitor.example.com/copy", mock.Anything).
+		Return(jsonResponse(200, `{"status": "completed", "resourceId": "copy-id"}`), nil)
+	mockClient.On("DoRequest", "GET", "/drives/test-drive/items/copy-id", mock.Anything).
+		Return(jsonResponse(200, `{"id": "copy-id", "name": "a copy.pdf"}`), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	item, err := service.CopyItem(context.Background(), "test-drive", ItemRef{ID: "item-id"}, "/Archive", "a copy.pdf")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "copy-id", item.ID)
+	mockClient.AssertExpectations(t)
+}
+
+func TestDeleteItem_Success(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	mockClient.On("DoRequest", "DELETE", "/drives/test-drive/items/item-id", mock.Anything).
+		Return(jsonResponse(204, ``), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	err := service.DeleteItem(context.Background(), "test-drive", ItemRef{ID: "item-id"})
+
+	assert.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
+
+func quickXorHashOf(content []byte) string {
+	h := newQuickXorHash()
+	h.Write(content)
+	return encodeQuickXorHash(h)
+}
+
+func TestUploadSmallFile_VerifiesHash(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	fileContent := []byte("test file content")
+
+	mockClient.On("DoRequest", "PUT", mock.Anything, mock.Anything).
+		Return(jsonResponse(201, `{"id": "123", "file": {"hashes": {"quickXorHash": "`+quickXorHashOf(fileContent)+`"}}}`), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	item, err := service.UploadSmallFile(context.Background(), "test-drive", "/Documents", "test-file.txt", bytes.NewReader(fileContent), int64(len(fileContent)), "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "123", item.ID)
+	mockClient.AssertExpectations(t)
+}
+
+func TestUploadSmallFile_HashMismatchRestoresPreviousVersion(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	fileContent := []byte("test file content")
+	corrupted := quickXorHashOf([]byte("test file c0ntent"))
+
+	mockClient.On("DoRequest", "PUT", mock.Anything, mock.Anything).
+		Return(jsonResponse(200, `{"id": "123", "file": {"hashes": {"quickXorHash": "`+corrupted+`"}}}`), nil)
+	mockClient.On("DoRequest", "GET", "/drives/test-drive/items/123/versions", mock.Anything).
+		Return(jsonResponse(200, `{"value": [{"id": "2.0"}, {"id": "1.0"}]}`), nil)
+	mockClient.On("DoRequest", "POST", "/drives/test-drive/items/123/versions/1.0/restoreVersion", mock.Anything).
+		Return(jsonResponse(204, ``), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	_, err := service.UploadSmallFile(context.Background(), "test-drive", "/Documents", "test-file.txt", bytes.NewReader(fileContent), int64(len(fileContent)), "")
+
+	var integrityErr *IntegrityError
+	assert.ErrorAs(t, err, &integrityErr)
+	assert.Equal(t, quickXorHashOf(fileContent), integrityErr.Expected)
+	assert.Equal(t, corrupted, integrityErr.Actual)
+	assert.False(t, IsRetryable(err))
+	mockClient.AssertNotCalled(t, "DoRequest", "DELETE", mock.Anything, mock.Anything)
+	mockClient.AssertExpectations(t)
+}
+
+func TestUploadLargeFile_HashMismatchDeletesNewItem(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	fileSize := UploadChunkSize + 100
+	source := &bytesSource{content: make([]byte, fileSize)}
+
+	mockClient.On("DoRequest", "POST", mock.Anything, mock.Anything).
+		Return(jsonResponse(200, `{"uploadUrl": "`+testUploadURL+`"}`), nil)
+	mockClient.On("DoUploadRequest", "PUT", testUploadURL, contentRange("bytes 0-3276799/3276900")).
+		Return(jsonResponse(202, `{"nextExpectedRanges": ["3276800-"]}`), nil)
+	mockClient.On("DoUploadRequest", "PUT", testUploadURL, contentRange("bytes 3276800-3276899/3276900")).
+		Return(jsonResponse(201, `{"id": "123", "file": {"hashes": {"quickXorHash": "AAAAAAAAAAAAAAAAAAAAAAAAAAA="}}}`), nil)
+	mockClient.On("DoRequest", "GET", "/drives/test-drive/items/123/versions", mock.Anything).
+		Return(jsonResponse(200, `{"value": [{"id": "1.0"}]}`), nil)
+	mockClient.On("DoRequest", "DELETE", "/drives/test-drive/items/123", mock.Anything).
+		Return(jsonResponse(204, ``), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	_, err := service.UploadLargeFile(context.Background(), UploadLargeFileParams{
+		DriveID:    "test-drive",
+		FolderPath: "/Documents/Reports",
+		FileName:   "big.pdf",
+		Source:     source,
+		FileSize:   fileSize,
+	})
+
+	var integrityErr *IntegrityError
+	assert.ErrorAs(t, err, &integrityErr)
+	assert.Equal(t, quickXorHashOf(source.content), integrityErr.Expected)
+	assert.Equal(t, []int64{0}, source.opened)
 	mockClient.AssertExpectations(t)
 }
 
+func TestUploadLargeFile_HashesRangesFromPreviousSession(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	fileSize := UploadChunkSize + 100
+	content := bytes.Repeat([]byte("gogo"), int(fileSize/4))
+	source := &bytesSource{content: content}
+
+	mockClient.On("DoUploadRequest", "GET", testUploadURL, mock.Anything).
+		Return(jsonResponse(200, `{"nextExpectedRanges": ["3276800-"]}`), nil).Once()
+	mockClient.On("DoUploadRequest", "PUT", testUploadURL, contentRange("bytes 3276800-3276899/3276900")).
+		Return(jsonResponse(201, `{"id": "123", "file": {"hashes": {"quickXorHash": "`+quickXorHashOf(content)+`"}}}`), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	_, err := service.UploadLargeFile(context.Background(), UploadLargeFileParams{
+		DriveID:    "test-drive",
+		FolderPath: "/Documents/Reports",
+		FileName:   "big.pdf",
+		Source:     source,
+		FileSize:   fileSize,
+		Session:    &UploadSession{UploadURL: testUploadURL},
+	})
+
+	assert.NoError(t, err)
+	// the ranges the previous session uploaded are read back to hash them
+	assert.Equal(t, []int64{UploadChunkSize, 0}, source.opened)
+	mockClient.AssertExpectations(t)
+}
+
+func TestGetMyDrive(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	mockRepository := new(MockDBRepository)
+
+	mockClient.On("DoRequest", "GET", "/me/drive", mock.Anything).
+		Return(jsonResponse(200, `{"id": "b!drive", "driveType": "business", "quota": {"total": 1024, "used": 256, "remaining": 768, "state": "normal"}}`), nil)
+
+	service := NewServiceWithDependencies(
+		nil,
+		mockClient,
+		mockRepository,
+	)
+
+	drive, err := service.GetMyDrive(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "b!drive", drive.ID)
+	assert.Equal(t, "business", drive.DriveType)
+	assert.Equal(t, Quota{Total: 1024, Used: 256, Remaining: 768, State: "normal"}, drive.Quota)
+	mockClient.AssertExpectations(t)
+}
@@ -0,0 +1,116 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// accessTokenExpiryMargin is how long before its reported expiry an access
+// token stops being handed out, so a request doesn't start with a token that
+// expires while it is in flight.
+const accessTokenExpiryMargin = 5 * time.Minute
+
+// sharedTokenCache is used by every client, so the Services created for each
+// message reuse the access tokens minted for earlier ones.
+var sharedTokenCache = newTokenCache()
+
+type cachedToken struct {
+	accessToken string
+	expiresAt   time.Time
+}
+
+// tokenFetch is a refresh in progress that other callers can wait on.
+type tokenFetch struct {
+	done  chan struct{}
+	token cachedToken
+	err   error
+}
+
+// tokenCache holds access tokens per owner. Concurrent requests for an owner
+// whose token is missing or expired share a single refresh.
+type tokenCache struct {
+	mu       sync.Mutex
+	tokens   map[int64]cachedToken
+	inFlight map[int64]*tokenFetch
+	now      func() time.Time
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{
+		tokens:   make(map[int64]cachedToken),
+		inFlight: make(map[int64]*tokenFetch),
+		now:      time.Now,
+	}
+}
+
+// get returns the cached access token for an owner, calling fetch to mint a
+// new one if there is no usable token and no refresh already in progress.
+// Callers waiting on another's refresh stop waiting when their ctx is done.
+// The refresh runs with the ctx of the caller that started it; if that ctx
+// ends the refresh, callers whose own ctx is still live try again.
+func (c *tokenCache) get(ctx context.Context, ownerID int64, fetch func(context.Context) (*tokenResponse, error)) (string, error) {
+	for {
+		c.mu.Lock()
+		if token, ok := c.tokens[ownerID]; ok && c.now().Before(token.expiresAt) {
+			c.mu.Unlock()
+			return token.accessToken, nil
+		}
+
+		call, ok := c.inFlight[ownerID]
+		if !ok {
+			// start a refresh, still holding c.mu
+			break
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+
+		if isContextError(call.err) && ctx.Err() == nil {
+			continue
+		}
+		return call.token.accessToken, call.err
+	}
+
+	call := &tokenFetch{done: make(chan struct{})}
+	c.inFlight[ownerID] = call
+	c.mu.Unlock()
+
+	response, err := fetch(ctx)
+	if err == nil {
+		lifetime := time.Duration(response.ExpiresIn) * time.Second
+		call.token = cachedToken{
+			accessToken: response.AccessToken,
+			expiresAt:   c.now().Add(lifetime - min(accessTokenExpiryMargin, lifetime/2)),
+		}
+	}
+	call.err = err
+
+	c.mu.Lock()
+	delete(c.inFlight, ownerID)
+	if err == nil {
+		c.tokens[ownerID] = call.token
+	}
+	c.mu.Unlock()
+	close(call.done)
+
+	return call.token.accessToken, call.err
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// invalidate drops an owner's cached token, e.g. after Graph rejected it or
+// the owner re-authorized.
+func (c *tokenCache) invalidate(ownerID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.tokens, ownerID)
+}
@@ -0,0 +1,149 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenCache_ReusesTokenUntilExpiry(t *testing.T) {
+	cache := newTokenCache()
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	fetches := 0
+	fetch := func(context.Context) (*tokenResponse, error) {
+		fetches++
+		return &tokenResponse{AccessToken: "token", ExpiresIn: 3600}, nil
+	}
+
+	token, err := cache.get(context.Background(), 123, fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	now = now.Add(50 * time.Minute)
+	_, err = cache.get(context.Background(), 123, fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fetches)
+
+	// within the safety margin of the hour-long token
+	now = now.Add(6 * time.Minute)
+	_, err = cache.get(context.Background(), 123, fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fetches)
+}
+
+func TestTokenCache_KeyedByOwner(t *testing.T) {
+	cache := newTokenCache()
+
+	_, _ = cache.get(context.Background(), 1, func(context.Context) (*tokenResponse, error) {
+		return &tokenResponse{AccessToken: "one", ExpiresIn: 3600}, nil
+	})
+	token, err := cache.get(context.Background(), 2, func(context.Context) (*tokenResponse, error) {
+		return &tokenResponse{AccessToken: "two", ExpiresIn: 3600}, nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "two", token)
+}
+
+func TestTokenCache_CoalescesConcurrentRefreshes(t *testing.T) {
+	cache := newTokenCache()
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	fetch := func(context.Context) (*tokenResponse, error) {
+		fetches.Add(1)
+		<-release
+		return &tokenResponse{AccessToken: "token", ExpiresIn: 3600}, nil
+	}
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tokens[i], _ = cache.get(context.Background(), 123, fetch)
+		}()
+	}
+
+	// give every goroutine a chance to join the in-flight refresh
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), fetches.Load())
+	for _, token := range tokens {
+		assert.Equal(t, "token", token)
+	}
+}
+
+func TestTokenCache_CancelledLeaderDoesNotFailWaiters(t *testing.T) {
+	cache := newTokenCache()
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := cache.get(leaderCtx, 123, func(ctx context.Context) (*tokenResponse, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		leaderErr <- err
+	}()
+	<-started
+
+	waiterToken := make(chan string, 1)
+	go func() {
+		token, err := cache.get(context.Background(), 123, func(ctx context.Context) (*tokenResponse, error) {
+			return &tokenResponse{AccessToken: "token", ExpiresIn: 3600}, nil
+		})
+		assert.NoError(t, err)
+		waiterToken <- token
+	}()
+
+	// let the waiter join the leader's refresh before cancelling it
+	time.Sleep(20 * time.Millisecond)
+	cancelLeader()
+
+	assert.ErrorIs(t, <-leaderErr, context.Canceled)
+	assert.Equal(t, "token", <-waiterToken)
+}
+
+func TestTokenCache_ErrorsAreNotCached(t *testing.T) {
+	cache := newTokenCache()
+
+	_, err := cache.get(context.Background(), 123, func(context.Context) (*tokenResponse, error) {
+		return nil, errors.New("invalid_grant")
+	})
+	assert.Error(t, err)
+
+	token, err := cache.get(context.Background(), 123, func(context.Context) (*tokenResponse, error) {
+		return &tokenResponse{AccessToken: "token", ExpiresIn: 3600}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+}
+
+func TestTokenCache_Invalidate(t *testing.T) {
+	cache := newTokenCache()
+
+	fetches := 0
+	fetch := func(context.Context) (*tokenResponse, error) {
+		fetches++
+		return &tokenResponse{AccessToken: "token", ExpiresIn: 3600}, nil
+	}
+
+	_, _ = cache.get(context.Background(), 123, fetch)
+	cache.invalidate(123)
+	_, _ = cache.get(context.Background(), 123, fetch)
+
+	assert.Equal(t, 2, fetches)
+}
@@ -0,0 +1,327 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Graph requires every range of an upload session, except the last one, to be
+// a multiple of 320 KiB.
+const uploadChunkAlignment int64 = 320 * 1024
+
+// UploadChunkSize is the size of each range sent to an upload session.
+const UploadChunkSize int64 = 10 * uploadChunkAlignment
+
+const maxSessionResumes = 5
+
+// rangeRetryPolicy retries individual ranges before falling back to resuming
+// the session.
+var rangeRetryPolicy = retryPolicy{
+	maxAttempts:   3,
+	baseDelay:     time.Second,
+	maxDelay:      30 * time.Second,
+	maxRetryAfter: time.Minute,
+}
+
+// RangeSource opens the content being uploaded at a given byte offset, so an
+// upload session can pick up from wherever Graph says it left off.
+type RangeSource interface {
+	OpenRange(ctx context.Context, offset int64) (io.ReadCloser, error)
+}
+
+type UploadSession struct {
+	UploadURL          string    `json:"uploadUrl"`
+	ExpirationDateTime time.Time `json:"expirationDateTime"`
+	NextExpectedRanges []string  `json:"nextExpectedRanges"`
+}
+
+// NextOffset returns the first byte Graph still expects for this session.
+func (u *UploadSession) NextOffset() (int64, error) {
+	if len(u.NextExpectedRanges) == 0 {
+		return 0, fmt.Errorf("upload session has no expected ranges")
+	}
+
+	start, _, _ := strings.Cut(u.NextExpectedRanges[0], "-")
+	offset, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid expected range %q: %w", u.NextExpectedRanges[0], err)
+	}
+
+	return offset, nil
+}
+
+type UploadLargeFileParams struct {
+	DriveID    string
+	FolderPath string
+	FileName   string
+	Source     RangeSource
+	FileSize   int64
+
+	// ConflictBehavior is what Graph does if an item already exists at the
+	// path. It defaults to ConflictReplace.
+	ConflictBehavior string
+
+	// Session is an upload session started by an earlier attempt. If Graph
+	// still knows about it the upload continues from its next expected range,
+	// otherwise a new session is created.
+	Session *UploadSession
+
+	// OnProgress is called once the session is established and after every
+	// range Graph accepts, with the number of bytes committed so far.
+	OnProgress func(session UploadSession, committed int64)
+}
+
+// UploadLargeFile uploads content through a Graph upload session, sending it
+// in UploadChunkSize ranges. Failed ranges are retried individually and, if a
+// range still can't be delivered, the upload resumes from the session's
+// nextExpectedRanges by reopening the source at that offset. If ctx is done
+// the upload stops and the session is cancelled, as nothing will resume it.
+func (s *Service) UploadLargeFile(ctx context.Context, params UploadLargeFileParams) (*DriveItem, error) {
+	session, offset := s.resumeUploadSession(ctx, params.Session)
+	if session == nil {
+		var err error
+		session, err = s.createUploadSession(ctx, params.DriveID, params.FolderPath, params.FileName, params.ConflictBehavior)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	progress := func(status UploadSession, committed int64) {
+		if !status.ExpirationDateTime.IsZero() {
+			session.ExpirationDateTime = status.ExpirationDateTime
+		}
+		if params.OnProgress != nil {
+			params.OnProgress(*session, committed)
+		}
+	}
+	progress(*session, offset)
+
+	hasher := newContentHasher()
+	for resumes := 0; ; resumes++ {
+		item, err := s.uploadRanges(ctx, session.UploadURL, params.Source, offset, params.FileSize, hasher, progress)
+		if ctx.Err() != nil {
+			s.cancelUploadSession(ctx, session.UploadURL)
+			return nil, fmt.Errorf("upload of %s cancelled: %w", params.FileName, ctx.Err())
+		}
+		if err == nil {
+			err = s.verifyUpload(ctx, params.DriveID, item, func() (string, error) {
+				return hasher.sum(ctx, params.Source, params.FileSize)
+			})
+			if err != nil {
+				return nil, err
+			}
+			return item, nil
+		}
+
+		if resumes >= maxSessionResumes {
+			s.cancelUploadSession(ctx, session.UploadURL)
+			return nil, fmt.Errorf("upload session failed after %d resumes: %w", resumes, err)
+		}
+
+		status, statusErr := s.getUploadSession(ctx, session.UploadURL)
+		if statusErr != nil {
+			s.cancelUploadSession(ctx, session.UploadURL)
+			return nil, fmt.Errorf("upload failed (%v) and session could not be resumed: %w", err, statusErr)
+		}
+
+		offset, statusErr = status.NextOffset()
+		if statusErr != nil {
+			s.cancelUploadSession(ctx, session.UploadURL)
+			return nil, fmt.Errorf("upload failed (%v) and session could not be resumed: %w", err, statusErr)
+		}
+
+		log.Printf("Resuming upload of %s from byte %d after error: %v", params.FileName, offset, err)
+	}
+}
+
+// resumeUploadSession asks Graph where a previously started session left off.
+// It returns a nil session when there is nothing to resume.
+func (s *Service) resumeUploadSession(ctx context.Context, previous *UploadSession) (*UploadSession, int64) {
+	if previous == nil || previous.UploadURL == "" {
+		return nil, 0
+	}
+
+	status, err := s.getUploadSession(ctx, previous.UploadURL)
+	if err != nil {
+		log.Printf("Discarding previous upload session: %v", err)
+		return nil, 0
+	}
+
+	offset, err := status.NextOffset()
+	if err != nil {
+		log.Printf("Discarding previous upload session: %v", err)
+		return nil, 0
+	}
+
+	return status, offset
+}
+
+func (s *Service) createUploadSession(ctx context.Context, driveID, folderPath, fileName, conflictBehavior string) (*UploadSession, error) {
+	if conflictBehavior == "" {
+		conflictBehavior = ConflictReplace
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"item": map[string]string{"@microsoft.graph.conflictBehavior": conflictBehavior},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal upload session request: %w", err)
+	}
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+
+	resp, err := s.client.DoRequest(ctx, "POST", itemPath(driveID, folderPath, fileName)+"/createUploadSession", bytes.NewReader(body), headers)
+	if err != nil {
+		return nil, fmt.Errorf("create upload session failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var session UploadSession
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, fmt.Errorf("failed to decode upload session: %w", err)
+	}
+
+	if session.UploadURL == "" {
+		return nil, fmt.Errorf("upload session response did not include an upload URL")
+	}
+
+	return &session, nil
+}
+
+func (s *Service) getUploadSession(ctx context.Context, uploadURL string) (*UploadSession, error) {
+	resp, err := s.client.DoUploadRequest(ctx, "GET", uploadURL, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error querying upload session: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var session UploadSession
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, fmt.Errorf("failed to decode upload session status: %w", err)
+	}
+	session.UploadURL = uploadURL
+
+	return &session, nil
+}
+
+// cancelUploadSession discards an upload session so Graph can release the
+// bytes already uploaded. It is best effort: an abandoned session expires on
+// its own. It is sent even if ctx is done, since that is usually why the
+// session is being cancelled.
+func (s *Service) cancelUploadSession(ctx context.Context, uploadURL string) {
+	resp, err := s.client.DoUploadRequest(context.WithoutCancel(ctx), "DELETE", uploadURL, nil, nil)
+	if err != nil {
+		log.Printf("Failed to cancel upload session: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// uploadRanges streams the source from offset to the end of the file, adding
+// each range to hasher as it is read. It returns the uploaded item once Graph
+// reports the upload as complete, or stops early once ctx is done.
+func (s *Service) uploadRanges(
+	ctx context.Context,
+	uploadURL string,
+	source RangeSource,
+	offset, fileSize int64,
+	hasher *contentHasher,
+	progress func(status UploadSession, committed int64),
+) (*DriveItem, error) {
+	body, err := source.OpenRange(ctx, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source at byte %d: %w", offset, err)
+	}
+	defer body.Close()
+
+	buf := make([]byte, UploadChunkSize)
+	for offset < fileSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		chunk := buf[:min(UploadChunkSize, fileSize-offset)]
+		if _, err := io.ReadFull(body, chunk); err != nil {
+			return nil, fmt.Errorf("failed to read bytes %d-%d: %w", offset, offset+int64(len(chunk))-1, err)
+		}
+		hasher.add(chunk, offset)
+
+		status, item, err := s.uploadRange(ctx, uploadURL, chunk, offset, fileSize)
+		if err != nil {
+			return nil, err
+		}
+		if item != nil {
+			return item, nil
+		}
+
+		next, err := status.NextOffset()
+		if err != nil {
+			return nil, err
+		}
+
+		end := offset + int64(len(chunk))
+		if next != end {
+			return nil, fmt.Errorf("upload session expects byte %d after range ending at %d", next, end-1)
+		}
+		offset = next
+		progress(*status, offset)
+	}
+
+	return nil, fmt.Errorf("upload session did not complete after all %d bytes were sent", fileSize)
+}
+
+// uploadRange sends a single range, retrying transient failures. It returns
+// the session status Graph reports after accepting the range, or the uploaded
+// item once the final range has been accepted and the upload is complete.
+func (s *Service) uploadRange(ctx context.Context, uploadURL string, chunk []byte, offset, fileSize int64) (*UploadSession, *DriveItem, error) {
+	end := offset + int64(len(chunk)) - 1
+	headers := map[string]string{
+		"Content-Length": fmt.Sprintf("%d", len(chunk)),
+		"Content-Range":  fmt.Sprintf("bytes %d-%d/%d", offset, end, fileSize),
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := s.client.DoUploadRequest(ctx, "PUT", uploadURL, bytes.NewReader(chunk), headers)
+		if err == nil {
+			return rangeResult(resp)
+		}
+
+		if !rangeRetryPolicy.shouldRetry(attempt, err) {
+			return nil, nil, fmt.Errorf("range %d-%d failed after %d attempts: %w", offset, end, attempt, err)
+		}
+
+		if err := sleep(ctx, rangeRetryPolicy.delay(attempt, RetryAfter(err))); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// rangeResult decodes a successful range response: the session status while
+// Graph expects more ranges, or the uploaded item once the upload is complete.
+func rangeResult(resp *http.Response) (*UploadSession, *DriveItem, error) {
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted {
+		var status UploadSession
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode range response: %w", err)
+		}
+		return &status, nil, nil
+	}
+
+	var item DriveItem
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode uploaded item: %w", err)
+	}
+	return nil, &item, nil
+}
@@ -0,0 +1,144 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/jaibhavaya/gogo-files/pkg/db"
+	"github.com/jaibhavaya/gogo-files/pkg/onedrive"
+)
+
+// Classes of failure a message can be dead-lettered for.
+const (
+	ERROR_CLASS_PARSE               = "parse_failure"
+	ERROR_CLASS_UNKNOWN_TYPE        = "unknown_type"
+	ERROR_CLASS_MISSING_INTEGRATION = "missing_integration"
+	ERROR_CLASS_PERMANENT_GRAPH     = "permanent_graph_error"
+	ERROR_CLASS_TRANSIENT           = "transient"
+	// ERROR_CLASS_INTERRUPTED messages were cut short by shutdown. They are
+	// neither retried nor dead-lettered, just redelivered.
+	ERROR_CLASS_INTERRUPTED = "interrupted"
+)
+
+// Metadata describing why a message was dead-lettered.
+const (
+	DLQ_ORIGINAL_TOPIC_METADATA_KEY = "dlq_original_topic"
+	DLQ_ERROR_CLASS_METADATA_KEY    = "dlq_error_class"
+	DLQ_ERROR_METADATA_KEY          = "dlq_error"
+	DLQ_ATTEMPTS_METADATA_KEY       = "dlq_attempts"
+	DLQ_FIRST_SEEN_METADATA_KEY     = "dlq_first_seen_at"
+)
+
+// Metadata the SQS unmarshaler records about a message's deliveries.
+const (
+	RECEIVE_COUNT_METADATA_KEY  = "sqs_receive_count"
+	FIRST_SEEN_METADATA_KEY     = "sqs_first_received_at"
+	RECEIPT_HANDLE_METADATA_KEY = "sqs_receipt_handle"
+)
+
+var (
+	errParseMessage       = errors.New("error Parsing Message")
+	errUnknownMessageType = errors.New("unknown message type")
+)
+
+// errorClass sorts a handler error into one of the ERROR_CLASS values. Only
+// transient errors are worth retrying; the rest fail the same way every time.
+func errorClass(err error) string {
+	switch {
+	case errors.Is(err, errUnknownMessageType):
+		return ERROR_CLASS_UNKNOWN_TYPE
+	case errors.Is(err, errParseMessage):
+		return ERROR_CLASS_PARSE
+	case errors.Is(err, db.ErrNoOneDriveIntegration), onedrive.IsAuthorizationRevoked(err):
+		return ERROR_CLASS_MISSING_INTEGRATION
+	case onedrive.IsPermanent(err):
+		return ERROR_CLASS_PERMANENT_GRAPH
+	case errors.Is(err, errProcessingCeiling):
+		return ERROR_CLASS_TRANSIENT
+	case errors.Is(err, context.Canceled):
+		return ERROR_CLASS_INTERRUPTED
+	}
+	return ERROR_CLASS_TRANSIENT
+}
+
+// deadLetter publishes messages that can't be processed to topic, with
+// metadata describing the failure, and acknowledges them so they stop being
+// redelivered. Transient failures are left for the queue to redeliver until
+// the message has been received maxReceives times.
+type deadLetter struct {
+	publisher   message.Publisher
+	topic       string
+	maxReceives int
+	logger      watermill.LoggerAdapter
+	// deadLettered, if set, is called with every message sent to topic and
+	// the error it failed with.
+	deadLettered func(msg *message.Message, err error)
+}
+
+func (d deadLetter) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		msgs, err := h(msg)
+		if err == nil {
+			return msgs, nil
+		}
+
+		class := errorClass(err)
+		attempts := receiveCount(msg)
+		if class == ERROR_CLASS_INTERRUPTED || (class == ERROR_CLASS_TRANSIENT && attempts < d.maxReceives) {
+			return msgs, err
+		}
+
+		if pubErr := d.publisher.Publish(d.topic, d.deadLetterMessage(msg, class, err, attempts)); pubErr != nil {
+			return nil, errors.Join(err, fmt.Errorf("failed to publish to dead letter queue: %w", pubErr))
+		}
+
+		d.logger.Error("Message sent to dead letter queue", err, watermill.LogFields{
+			"message_uuid": msg.UUID,
+			"error_class":  class,
+			"attempts":     attempts,
+		})
+
+		if d.deadLettered != nil {
+			d.deadLettered(msg, err)
+		}
+
+		return nil, nil
+	}
+}
+
+func (d deadLetter) deadLetterMessage(msg *message.Message, class string, err error, attempts int) *message.Message {
+	dead := msg.Copy()
+
+	firstSeen := dead.Metadata.Get(FIRST_SEEN_METADATA_KEY)
+	if firstSeen == "" {
+		firstSeen = time.Now().UTC().Format(time.RFC3339)
+	}
+	// carried over below, and SQS limits how many attributes a message has
+	delete(dead.Metadata, RECEIVE_COUNT_METADATA_KEY)
+	delete(dead.Metadata, FIRST_SEEN_METADATA_KEY)
+	// only valid for this delivery
+	delete(dead.Metadata, RECEIPT_HANDLE_METADATA_KEY)
+
+	dead.Metadata.Set(DLQ_ORIGINAL_TOPIC_METADATA_KEY, message.SubscribeTopicFromCtx(msg.Context()))
+	dead.Metadata.Set(DLQ_ERROR_CLASS_METADATA_KEY, class)
+	dead.Metadata.Set(DLQ_ERROR_METADATA_KEY, err.Error())
+	dead.Metadata.Set(DLQ_ATTEMPTS_METADATA_KEY, strconv.Itoa(attempts))
+	dead.Metadata.Set(DLQ_FIRST_SEEN_METADATA_KEY, firstSeen)
+
+	return dead
+}
+
+// receiveCount returns how many times the queue has delivered msg, counting
+// this delivery.
+func receiveCount(msg *message.Message) int {
+	count, err := strconv.Atoi(msg.Metadata.Get(RECEIVE_COUNT_METADATA_KEY))
+	if err != nil || count < 1 {
+		return 1
+	}
+	return count
+}
@@ -0,0 +1,140 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/jaibhavaya/gogo-files/pkg/db"
+	"github.com/jaibhavaya/gogo-files/pkg/onedrive"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingPublisher struct {
+	topic    string
+	messages []*message.Message
+	err      error
+}
+
+func (p *recordingPublisher) Publish(topic string, messages ...*message.Message) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.topic = topic
+	p.messages = append(p.messages, messages...)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error {
+	return nil
+}
+
+func TestErrorClass(t *testing.T) {
+	_, parseErr := parseMessage(message.NewMessage("1", []byte(`not json`)))
+	_, unknownErr := parseMessage(message.NewMessage("1", []byte(`{"event_type": "unknown"}`)))
+
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"parse failure", fmt.Errorf("%w: %w", errParseMessage, parseErr), ERROR_CLASS_PARSE},
+		{"unknown type", fmt.Errorf("%w: %w", errParseMessage, unknownErr), ERROR_CLASS_UNKNOWN_TYPE},
+		{"missing integration", fmt.Errorf("failed to handle message: %w", db.ErrNoOneDriveIntegration), ERROR_CLASS_MISSING_INTEGRATION},
+		{"revoked authorization", fmt.Errorf("failed to get access token: %w", &onedrive.TokenError{StatusCode: http.StatusBadRequest, Code: "invalid_grant"}), ERROR_CLASS_MISSING_INTEGRATION},
+		{"token endpoint unavailable", &onedrive.TokenError{StatusCode: http.StatusServiceUnavailable}, ERROR_CLASS_TRANSIENT},
+		{"permanent graph error", &onedrive.GraphError{StatusCode: http.StatusForbidden}, ERROR_CLASS_PERMANENT_GRAPH},
+		{"transient graph error", &onedrive.GraphError{StatusCode: http.StatusServiceUnavailable}, ERROR_CLASS_TRANSIENT},
+		{"other error", errors.New("database is unavailable"), ERROR_CLASS_TRANSIENT},
+		{"interrupted", fmt.Errorf("file sync interrupted: %w", context.Canceled), ERROR_CLASS_INTERRUPTED},
+		{"processing ceiling", fmt.Errorf("%w: file sync interrupted: %w", errProcessingCeiling, context.Canceled), ERROR_CLASS_TRANSIENT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, errorClass(tt.err))
+		})
+	}
+}
+
+func TestDeadLetterMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		receiveCount string
+		deadLettered bool
+	}{
+		{"success", nil, "1", false},
+		{"permanent failure", fmt.Errorf("%w: bad json", errParseMessage), "1", true},
+		{"transient failure", errors.New("database is unavailable"), "1", false},
+		{"transient failure on last receive", errors.New("database is unavailable"), "3", true},
+		{"interrupted on last receive", errShuttingDown, "3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &recordingPublisher{}
+			var deadLettered []error
+			handler := deadLetter{
+				publisher:   publisher,
+				topic:       "dlq",
+				maxReceives: 3,
+				logger:      watermill.NopLogger{},
+				deadLettered: func(msg *message.Message, err error) {
+					deadLettered = append(deadLettered, err)
+				},
+			}.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+				return nil, tt.err
+			})
+
+			msg := message.NewMessage("1", []byte(`{}`))
+			msg.Metadata.Set(RECEIVE_COUNT_METADATA_KEY, tt.receiveCount)
+			msg.Metadata.Set(FIRST_SEEN_METADATA_KEY, "2025-05-12T09:30:27Z")
+			msg.Metadata.Set(RECEIPT_HANDLE_METADATA_KEY, "receipt")
+
+			_, err := handler(msg)
+
+			if !tt.deadLettered {
+				assert.Equal(t, tt.err, err)
+				assert.Empty(t, publisher.messages)
+				assert.Empty(t, deadLettered)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "dlq", publisher.topic)
+			assert.Len(t, publisher.messages, 1)
+
+			dead := publisher.messages[0]
+			assert.Equal(t, "1", dead.UUID)
+			assert.Equal(t, errorClass(tt.err), dead.Metadata.Get(DLQ_ERROR_CLASS_METADATA_KEY))
+			assert.Equal(t, tt.err.Error(), dead.Metadata.Get(DLQ_ERROR_METADATA_KEY))
+			assert.Equal(t, tt.receiveCount, dead.Metadata.Get(DLQ_ATTEMPTS_METADATA_KEY))
+			assert.Equal(t, "2025-05-12T09:30:27Z", dead.Metadata.Get(DLQ_FIRST_SEEN_METADATA_KEY))
+			assert.Empty(t, dead.Metadata.Get(RECEIVE_COUNT_METADATA_KEY))
+			assert.Empty(t, dead.Metadata.Get(RECEIPT_HANDLE_METADATA_KEY))
+			assert.Equal(t, []error{tt.err}, deadLettered)
+		})
+	}
+}
+
+func TestDeadLetterMiddleware_PublishFailure(t *testing.T) {
+	handlerErr := fmt.Errorf("%w: bad json", errParseMessage)
+	handler := deadLetter{
+		publisher:   &recordingPublisher{err: errors.New("queue does not exist")},
+		topic:       "dlq",
+		maxReceives: 3,
+		logger:      watermill.NopLogger{},
+	}.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, handlerErr
+	})
+
+	_, err := handler(message.NewMessage("1", []byte(`{}`)))
+
+	assert.ErrorIs(t, err, handlerErr)
+	assert.ErrorContains(t, err, "queue does not exist")
+}
@@ -0,0 +1,162 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// errProcessingCeiling is returned for messages the heartbeat gave up on. It
+// is transient: the message is redelivered once its visibility runs out, and
+// dead-lettered if it keeps running over.
+var errProcessingCeiling = errors.New("message exceeded the maximum processing time")
+
+// visibilityQueue is the part of the SQS client the heartbeat needs.
+type visibilityQueue interface {
+	GetQueueUrl(ctx context.Context, params *awssqs.GetQueueUrlInput, optFns ...func(*awssqs.Options)) (*awssqs.GetQueueUrlOutput, error)
+	GetQueueAttributes(ctx context.Context, params *awssqs.GetQueueAttributesInput, optFns ...func(*awssqs.Options)) (*awssqs.GetQueueAttributesOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *awssqs.ChangeMessageVisibilityInput, optFns ...func(*awssqs.Options)) (*awssqs.ChangeMessageVisibilityOutput, error)
+}
+
+// heartbeat keeps messages invisible on their queue while they are being
+// handled, so SQS doesn't hand a long file sync to another worker halfway
+// through. When a message arrives, and every interval after that, its
+// visibility timeout is extended to visibilityTimeout from now, or to the
+// queue's own visibility timeout if that is longer, so a heartbeat never
+// shortens it. A message still being handled after ceiling is no longer
+// extended and its context is cancelled, aborting its uploads.
+type heartbeat struct {
+	queue             visibilityQueue
+	interval          time.Duration
+	visibilityTimeout time.Duration
+	ceiling           time.Duration
+	logger            watermill.LoggerAdapter
+
+	// queues caches the URL and visibility timeout of each topic's queue.
+	queues sync.Map
+}
+
+// consumedQueue is a queue messages are consumed from.
+type consumedQueue struct {
+	url               string
+	visibilityTimeout time.Duration
+}
+
+func (b *heartbeat) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		receiptHandle := msg.Metadata.Get(RECEIPT_HANDLE_METADATA_KEY)
+		if receiptHandle == "" {
+			return h(msg)
+		}
+
+		ctx, abandon := context.WithCancelCause(msg.Context())
+		defer abandon(nil)
+		msg.SetContext(ctx)
+
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			b.beat(ctx, msg, receiptHandle, abandon, done)
+		}()
+
+		msgs, err := h(msg)
+		close(done)
+		<-stopped
+
+		if err != nil && errors.Is(context.Cause(ctx), errProcessingCeiling) {
+			return msgs, fmt.Errorf("%w of %s: %w", errProcessingCeiling, b.ceiling, err)
+		}
+		return msgs, err
+	}
+}
+
+// beat extends the message's visibility until done is closed, or abandons
+// the message once it reaches the ceiling.
+func (b *heartbeat) beat(ctx context.Context, msg *message.Message, receiptHandle string, abandon context.CancelCauseFunc, done <-chan struct{}) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	ceiling := time.NewTimer(b.ceiling)
+	defer ceiling.Stop()
+
+	for {
+		b.extend(ctx, msg, receiptHandle)
+
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			// shutting down; the message is left for the queue to redeliver
+			return
+		case <-ceiling.C:
+			b.logger.Error("Message exceeded the maximum processing time, abandoning it", errProcessingCeiling, watermill.LogFields{
+				"message_uuid": msg.UUID,
+				"ceiling":      b.ceiling,
+			})
+			abandon(errProcessingCeiling)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// extend makes the message invisible for another visibilityTimeout, or the
+// queue's visibility timeout if that is longer. Failures
+// are logged: at worst the message is redelivered while it is still being
+// handled.
+func (b *heartbeat) extend(ctx context.Context, msg *message.Message, receiptHandle string) {
+	queue, err := b.lookupQueue(ctx, message.SubscribeTopicFromCtx(msg.Context()))
+	if err == nil {
+		_, err = b.queue.ChangeMessageVisibility(ctx, &awssqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(queue.url),
+			ReceiptHandle:     aws.String(receiptHandle),
+			VisibilityTimeout: int32(max(b.visibilityTimeout, queue.visibilityTimeout) / time.Second),
+		})
+	}
+	if err != nil && ctx.Err() == nil {
+		b.logger.Error("Failed to extend message visibility", err, watermill.LogFields{
+			"message_uuid": msg.UUID,
+		})
+	}
+}
+
+// lookupQueue returns the URL and visibility timeout of the queue consumed as
+// topic.
+func (b *heartbeat) lookupQueue(ctx context.Context, topic string) (consumedQueue, error) {
+	if queue, ok := b.queues.Load(topic); ok {
+		return queue.(consumedQueue), nil
+	}
+
+	urlOut, err := b.queue.GetQueueUrl(ctx, &awssqs.GetQueueUrlInput{
+		QueueName: aws.String(topic),
+	})
+	if err != nil {
+		return consumedQueue{}, fmt.Errorf("failed to get URL of queue %s: %w", topic, err)
+	}
+
+	attributesOut, err := b.queue.GetQueueAttributes(ctx, &awssqs.GetQueueAttributesInput{
+		QueueUrl:       urlOut.QueueUrl,
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameVisibilityTimeout},
+	})
+	if err != nil {
+		return consumedQueue{}, fmt.Errorf("failed to get attributes of queue %s: %w", topic, err)
+	}
+
+	seconds, err := strconv.Atoi(attributesOut.Attributes[string(types.QueueAttributeNameVisibilityTimeout)])
+	if err != nil {
+		return consumedQueue{}, fmt.Errorf("failed to read visibility timeout of queue %s: %w", topic, err)
+	}
+
+	queue := consumedQueue{url: *urlOut.QueueUrl, visibilityTimeout: time.Duration(seconds) * time.Second}
+	b.queues.Store(topic, queue)
+	return queue, nil
+}
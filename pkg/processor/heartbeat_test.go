@@ -0,0 +1,135 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeVisibilityQueue records the visibility changes made to its messages.
+// Its own visibility timeout is 30 seconds unless set.
+type fakeVisibilityQueue struct {
+	mu                sync.Mutex
+	visibilityTimeout string
+	lookups           int
+	extended          []*awssqs.ChangeMessageVisibilityInput
+}
+
+func (q *fakeVisibilityQueue) GetQueueUrl(ctx context.Context, params *awssqs.GetQueueUrlInput, optFns ...func(*awssqs.Options)) (*awssqs.GetQueueUrlOutput, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.lookups++
+	return &awssqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.test/one-drive-sync")}, nil
+}
+
+func (q *fakeVisibilityQueue) GetQueueAttributes(ctx context.Context, params *awssqs.GetQueueAttributesInput, optFns ...func(*awssqs.Options)) (*awssqs.GetQueueAttributesOutput, error) {
+	visibilityTimeout := q.visibilityTimeout
+	if visibilityTimeout == "" {
+		visibilityTimeout = "30"
+	}
+	return &awssqs.GetQueueAttributesOutput{Attributes: map[string]string{"VisibilityTimeout": visibilityTimeout}}, nil
+}
+
+func (q *fakeVisibilityQueue) ChangeMessageVisibility(ctx context.Context, params *awssqs.ChangeMessageVisibilityInput, optFns ...func(*awssqs.Options)) (*awssqs.ChangeMessageVisibilityOutput, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.extended = append(q.extended, params)
+	return &awssqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (q *fakeVisibilityQueue) changes() []*awssqs.ChangeMessageVisibilityInput {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]*awssqs.ChangeMessageVisibilityInput(nil), q.extended...)
+}
+
+func newHeartbeat(queue visibilityQueue, ceiling time.Duration) *heartbeat {
+	return &heartbeat{
+		queue:             queue,
+		interval:          10 * time.Millisecond,
+		visibilityTimeout: 2 * time.Minute,
+		ceiling:           ceiling,
+		logger:            watermill.NopLogger{},
+	}
+}
+
+func TestHeartbeat_ExtendsVisibilityUntilHandled(t *testing.T) {
+	queue := &fakeVisibilityQueue{}
+	handler := newHeartbeat(queue, time.Hour).Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		time.Sleep(55 * time.Millisecond)
+		return nil, nil
+	})
+
+	msg := message.NewMessage("1", []byte(`{}`))
+	msg.Metadata.Set(RECEIPT_HANDLE_METADATA_KEY, "receipt")
+
+	_, err := handler(msg)
+	assert.NoError(t, err)
+
+	extended := queue.changes()
+	assert.GreaterOrEqual(t, len(extended), 3)
+	assert.Equal(t, 1, queue.lookups)
+	for _, change := range extended {
+		assert.Equal(t, "https://sqs.test/one-drive-sync", *change.QueueUrl)
+		assert.Equal(t, "receipt", *change.ReceiptHandle)
+		assert.Equal(t, int32(120), change.VisibilityTimeout)
+	}
+
+	// nothing is extended once the message has been handled
+	time.Sleep(30 * time.Millisecond)
+	assert.Len(t, queue.changes(), len(extended))
+}
+
+func TestHeartbeat_KeepsLongerQueueVisibilityTimeout(t *testing.T) {
+	queue := &fakeVisibilityQueue{visibilityTimeout: "43200"}
+	handler := newHeartbeat(queue, time.Hour).Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, nil
+	})
+
+	msg := message.NewMessage("1", []byte(`{}`))
+	msg.Metadata.Set(RECEIPT_HANDLE_METADATA_KEY, "receipt")
+
+	_, err := handler(msg)
+	assert.NoError(t, err)
+
+	extended := queue.changes()
+	if assert.NotEmpty(t, extended) {
+		assert.Equal(t, int32(43200), extended[0].VisibilityTimeout)
+	}
+}
+
+func TestHeartbeat_AbandonsAtCeiling(t *testing.T) {
+	queue := &fakeVisibilityQueue{}
+	handler := newHeartbeat(queue, 30*time.Millisecond).Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		<-msg.Context().Done()
+		return nil, fmt.Errorf("file sync interrupted: %w", msg.Context().Err())
+	})
+
+	msg := message.NewMessage("1", []byte(`{}`))
+	msg.Metadata.Set(RECEIPT_HANDLE_METADATA_KEY, "receipt")
+
+	_, err := handler(msg)
+
+	assert.ErrorIs(t, err, errProcessingCeiling)
+	assert.Equal(t, ERROR_CLASS_TRANSIENT, errorClass(err))
+}
+
+func TestHeartbeat_NoReceiptHandle(t *testing.T) {
+	queue := &fakeVisibilityQueue{}
+	handler := newHeartbeat(queue, time.Hour).Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, nil
+	})
+
+	_, err := handler(message.NewMessage("1", []byte(`{}`)))
+
+	assert.NoError(t, err)
+	assert.Empty(t, queue.changes())
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/jaibhavaya/gogo-files/pkg/db"
+)
+
+// storedMessage is how a status message is kept in the processed message
+// ledger, so it can be published again for a duplicate delivery.
+type storedMessage struct {
+	UUID     string            `json:"uuid"`
+	Metadata map[string]string `json:"metadata"`
+	Payload  json.RawMessage   `json:"payload"`
+}
+
+// idempotencyKey identifies a message across redeliveries: the message's own
+// idempotency_key if it has one, otherwise its UUID.
+func idempotencyKey(msg *message.Message) string {
+	var wrapper MessageWrapper
+	if err := json.Unmarshal(msg.Payload, &wrapper); err == nil && wrapper.IdempotencyKey != "" {
+		return wrapper.IdempotencyKey
+	}
+	return msg.UUID
+}
+
+// previousResult returns the status messages published when a message with
+// the same idempotency key was processed within the retention period, and
+// whether there was one.
+func (p *SQSProcessor) previousResult(ctx context.Context, key string) ([]*message.Message, bool, error) {
+	since := time.Now().Add(-p.cfg.IdempotencyRetentionPeriod())
+	processed, err := db.GetProcessedMessage(ctx, p.dbPool, key, since)
+	if err != nil {
+		return nil, false, err
+	}
+	if processed == nil {
+		return nil, false, nil
+	}
+
+	msgs, err := decodeResult(processed.Result)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode result of message %s: %w", key, err)
+	}
+
+	return msgs, true, nil
+}
+
+// recordResult remembers the status messages published for a message. A
+// failure only costs the protection against reprocessing a redelivery, so it
+// is logged rather than failing a message that was handled successfully. The
+// result is recorded even if ctx has been cancelled since.
+func (p *SQSProcessor) recordResult(ctx context.Context, key, eventType string, msgs []*message.Message) {
+	result, err := encodeResult(msgs)
+	if err == nil {
+		err = db.SaveProcessedMessage(context.WithoutCancel(ctx), p.dbPool, &db.ProcessedMessage{
+			IdempotencyKey: key,
+			EventType:      eventType,
+			Result:         result,
+		})
+	}
+	if err != nil {
+		log.Printf("failed to record result of message %s: %v", key, err)
+	}
+}
+
+func encodeResult(msgs []*message.Message) (json.RawMessage, error) {
+	stored := make([]storedMessage, len(msgs))
+	for i, msg := range msgs {
+		stored[i] = storedMessage{
+			UUID:     msg.UUID,
+			Metadata: msg.Metadata,
+			Payload:  json.RawMessage(msg.Payload),
+		}
+	}
+	return json.Marshal(stored)
+}
+
+func decodeResult(result json.RawMessage) ([]*message.Message, error) {
+	var stored []storedMessage
+	if err := json.Unmarshal(result, &stored); err != nil {
+		return nil, err
+	}
+
+	msgs := make([]*message.Message, len(stored))
+	for i, s := range stored {
+		msgs[i] = message.NewMessage(s.UUID, message.Payload(s.Payload))
+		for key, value := range s.Metadata {
+			msgs[i].Metadata.Set(key, value)
+		}
+	}
+	return msgs, nil
+}
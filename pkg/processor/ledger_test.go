@@ -0,0 +1,45 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	msg := message.NewMessage("msg-uuid", []byte(`{"event_type": "file_sync", "payload": {}}`))
+	assert.Equal(t, "msg-uuid", idempotencyKey(msg))
+
+	msg = message.NewMessage("msg-uuid", []byte(`{"event_type": "file_sync", "idempotency_key": "sync-42", "payload": {}}`))
+	assert.Equal(t, "sync-42", idempotencyKey(msg))
+}
+
+func TestResultRoundTrip(t *testing.T) {
+	inbound := message.NewMessage("inbound-uuid", []byte(`{}`))
+	statusMsg, err := newStatusMessage(inbound, map[string]string{"event_type": "files_synced"})
+	assert.NoError(t, err)
+
+	result, err := encodeResult([]*message.Message{statusMsg})
+	assert.NoError(t, err)
+
+	msgs, err := decodeResult(result)
+
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, statusMsg.UUID, msgs[0].UUID)
+	assert.JSONEq(t, string(statusMsg.Payload), string(msgs[0].Payload))
+	assert.Equal(t, "inbound-uuid", middleware.MessageCorrelationID(msgs[0]))
+	assert.Equal(t, "inbound-uuid", msgs[0].Metadata.Get(CAUSATION_ID_METADATA_KEY))
+}
+
+func TestResultRoundTrip_NoMessages(t *testing.T) {
+	result, err := encodeResult(nil)
+	assert.NoError(t, err)
+
+	msgs, err := decodeResult(result)
+
+	assert.NoError(t, err)
+	assert.Empty(t, msgs)
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 
 	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/jaibhavaya/gogo-files/pkg/file"
+	"github.com/jaibhavaya/gogo-files/pkg/onedrive"
 )
 
 type Message interface {
@@ -14,6 +16,9 @@ type Message interface {
 type MessageWrapper struct {
 	EventType string          `json:"event_type"`
 	Payload   json.RawMessage `json:"payload"`
+	// IdempotencyKey identifies a message that may be sent more than once. It
+	// defaults to the message UUID.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 type OneDriveAuthorizationMessage struct {
@@ -39,7 +44,11 @@ type FileSyncMessage struct {
 type FileSyncPayload struct {
 	OwnerID int64          `json:"owner_id"`
 	UserID  string         `json:"user_id"`
+	DriveID string         `json:"drive_id"`
 	Items   []FileSyncItem `json:"items"`
+	// ConflictBehavior is one of replace, rename, fail or keep-newer. It
+	// overrides the owner's conflict behaviour for this message.
+	ConflictBehavior string `json:"conflict_behavior,omitempty"`
 }
 
 type FileSyncItem struct {
@@ -55,9 +64,67 @@ func (m *FileSyncMessage) Type() string {
 	return m.EventType
 }
 
+// syncItem adapts a FileSyncItem to file.Item. The adapter is needed because
+// FileSyncItem's exported fields share their names with file.Item's methods.
+type syncItem struct {
+	item FileSyncItem
+}
+
+func (s syncItem) Bucket() string { return s.item.Bucket }
+func (s syncItem) Key() string    { return s.item.Key }
+func (s syncItem) ID() string     { return s.item.ID }
+func (s syncItem) Name() string   { return s.item.Name }
+func (s syncItem) Path() string   { return s.item.Path }
+func (s syncItem) Size() int      { return s.item.Size }
+
+func (p FileSyncPayload) fileItems() []file.Item {
+	items := make([]file.Item, len(p.Items))
+	for i, item := range p.Items {
+		items[i] = syncItem{item}
+	}
+	return items
+}
+
+// OneDriveOpMessage asks for a single file or folder operation. The same
+// payload is used by every operation; which fields matter depends on the
+// event type:
+//
+//	create_folder: path of the folder to create
+//	move:          item_id or path, destination_path, optional name
+//	rename:        item_id or path, name
+//	copy:          item_id or path, destination_path, optional name
+//	delete:        item_id or path
+type OneDriveOpMessage struct {
+	EventType string            `json:"event_type"`
+	Payload   OneDriveOpPayload `json:"payload"`
+}
+
+type OneDriveOpPayload struct {
+	OwnerID int64  `json:"owner_id"`
+	UserID  string `json:"user_id"`
+	DriveID string `json:"drive_id"`
+	OpRequest
+}
+
+type OpRequest struct {
+	ItemID          string `json:"item_id,omitempty"`
+	Path            string `json:"path,omitempty"`
+	DestinationPath string `json:"destination_path,omitempty"`
+	Name            string `json:"name,omitempty"`
+}
+
+func (m *OneDriveOpMessage) Type() string {
+	return m.EventType
+}
+
 const (
 	ONEDRIVE_AUTH_MESSAGE_TYPE = "onedrive_authorization"
 	FILE_SYNC_MESSAGE_TYPE     = "file_sync"
+	CREATE_FOLDER_MESSAGE_TYPE = onedrive.OpCreateFolder
+	MOVE_MESSAGE_TYPE          = onedrive.OpMove
+	RENAME_MESSAGE_TYPE        = onedrive.OpRename
+	COPY_MESSAGE_TYPE          = onedrive.OpCopy
+	DELETE_MESSAGE_TYPE        = onedrive.OpDelete
 )
 
 func parseMessage(msg *message.Message) (Message, error) {
@@ -79,11 +146,22 @@ func parseMessage(msg *message.Message) (Message, error) {
 		var message FileSyncMessage
 		message.EventType = wrapper.EventType
 		if err := json.Unmarshal(wrapper.Payload, &message.Payload); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal onedrive authorization payload: %w", err)
+			return nil, fmt.Errorf("failed to unmarshal file sync payload: %w", err)
+		}
+		if !file.ValidConflictBehavior(message.Payload.ConflictBehavior) {
+			return nil, fmt.Errorf("invalid conflict_behavior: %q", message.Payload.ConflictBehavior)
+		}
+		return &message, nil
+
+	case CREATE_FOLDER_MESSAGE_TYPE, MOVE_MESSAGE_TYPE, RENAME_MESSAGE_TYPE, COPY_MESSAGE_TYPE, DELETE_MESSAGE_TYPE:
+		var message OneDriveOpMessage
+		message.EventType = wrapper.EventType
+		if err := json.Unmarshal(wrapper.Payload, &message.Payload); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s payload: %w", wrapper.EventType, err)
 		}
 		return &message, nil
 
 	default:
-		return nil, fmt.Errorf("unknown message type: %s", wrapper.EventType)
+		return nil, fmt.Errorf("%w: %s", errUnknownMessageType, wrapper.EventType)
 	}
 }
@@ -0,0 +1,83 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMessage_FileSync(t *testing.T) {
+	msg := message.NewMessage("uuid", []byte(`{
+		"event_type": "file_sync",
+		"payload": {
+			"owner_id": 123,
+			"user_id": "456",
+			"drive_id": "drive",
+			"items": [{"id": "1", "name": "a.pdf", "path": "/Documents/a.pdf", "bucket": "bucket", "key": "key"}]
+		}
+	}`))
+
+	parsed, err := parseMessage(msg)
+
+	assert.NoError(t, err)
+	syncMsg, ok := parsed.(*FileSyncMessage)
+	assert.True(t, ok)
+	assert.Equal(t, "drive", syncMsg.Payload.DriveID)
+
+	items := syncMsg.Payload.fileItems()
+	assert.Len(t, items, 1)
+	assert.Equal(t, "bucket", items[0].Bucket())
+	assert.Equal(t, "/Documents/a.pdf", items[0].Path())
+}
+
+func TestParseMessage_FileSyncConflictBehavior(t *testing.T) {
+	msg := message.NewMessage("uuid", []byte(`{
+		"event_type": "file_sync",
+		"payload": {"owner_id": 123, "conflict_behavior": "keep-newer", "items": []}
+	}`))
+
+	parsed, err := parseMessage(msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "keep-newer", parsed.(*FileSyncMessage).Payload.ConflictBehavior)
+
+	msg = message.NewMessage("uuid", []byte(`{
+		"event_type": "file_sync",
+		"payload": {"owner_id": 123, "conflict_behavior": "overwrite", "items": []}
+	}`))
+
+	_, err = parseMessage(msg)
+
+	assert.ErrorContains(t, err, `invalid conflict_behavior: "overwrite"`)
+}
+
+func TestParseMessage_Op(t *testing.T) {
+	msg := message.NewMessage("uuid", []byte(`{
+		"event_type": "move",
+		"payload": {
+			"owner_id": 123,
+			"drive_id": "drive",
+			"item_id": "item",
+			"destination_path": "/Archive"
+		}
+	}`))
+
+	parsed, err := parseMessage(msg)
+
+	assert.NoError(t, err)
+	opMsg, ok := parsed.(*OneDriveOpMessage)
+	assert.True(t, ok)
+	assert.Equal(t, MOVE_MESSAGE_TYPE, opMsg.Type())
+	assert.Equal(t, "item", opMsg.Payload.ItemID)
+	assert.Equal(t, "/Archive", opMsg.Payload.DestinationPath)
+}
+
+func TestParseMessage_UnknownType(t *testing.T) {
+	msg := message.NewMessage("uuid", []byte(`{"event_type": "nope", "payload": {}}`))
+
+	_, err := parseMessage(msg)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown message type")
+}
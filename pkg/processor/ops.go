@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jaibhavaya/gogo-files/pkg/onedrive"
+)
+
+const ONEDRIVE_OP_COMPLETED_EVENT_TYPE = "onedrive_op_completed"
+
+const (
+	OP_STATUS_SUCCEEDED = "succeeded"
+	OP_STATUS_FAILED    = "failed"
+)
+
+const OP_ERROR_CODE = "op_failed"
+
+// OpCompletedEvent is published to the status topic after a file or folder
+// operation, echoing the request and describing the resulting item:
+//
+//	{
+//	  "event_type": "onedrive_op_completed",
+//	  "payload": {
+//	    "owner_id": 123,
+//	    "user_id": "456",
+//	    "timestamp": "2025-03-24T13:05:23Z",
+//	    "op": "move",
+//	    "status": "succeeded",
+//	    "request": {
+//	      "item_id": "01ABCDEF1234567890",
+//	      "destination_path": "/Documents/Archive"
+//	    },
+//	    "item": {
+//	      "onedrive_id": "01ABCDEF1234567890",
+//	      "name": "Contract.docx",
+//	      "path": "/Documents/Archive/Contract.docx",
+//	      "parent_id": "01PARENT0000000000",
+//	      "folder": false
+//	    }
+//	  }
+//	}
+type OpCompletedEvent struct {
+	EventType string             `json:"event_type"`
+	Payload   OpCompletedPayload `json:"payload"`
+}
+
+type OpCompletedPayload struct {
+	OwnerID        int64     `json:"owner_id"`
+	UserID         string    `json:"user_id"`
+	Timestamp      time.Time `json:"timestamp"`
+	Op             string    `json:"op"`
+	Status         string    `json:"status"`
+	Request        OpRequest `json:"request"`
+	Item           *OpItem   `json:"item,omitempty"`
+	ErrorCode      string    `json:"error_code,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	GraphErrorCode string    `json:"graph_error_code,omitempty"`
+	RequestID      string    `json:"request_id,omitempty"`
+}
+
+type OpItem struct {
+	OneDriveID string `json:"onedrive_id"`
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	ParentID   string `json:"parent_id,omitempty"`
+	Folder     bool   `json:"folder"`
+}
+
+func newOpCompletedEvent(handler *onedrive.OpsHandler) OpCompletedEvent {
+	payload := OpCompletedPayload{
+		OwnerID:   handler.OwnerID,
+		UserID:    handler.UserID,
+		Timestamp: time.Now().UTC(),
+		Op:        handler.Op,
+		Status:    OP_STATUS_SUCCEEDED,
+		Request: OpRequest{
+			ItemID:          handler.Item.ID,
+			Path:            handler.Item.Path,
+			DestinationPath: handler.DestinationPath,
+			Name:            handler.Name,
+		},
+	}
+
+	if handler.Err != nil {
+		payload.Status = OP_STATUS_FAILED
+		payload.ErrorCode = OP_ERROR_CODE
+		payload.Error = handler.Err.Error()
+
+		var graphErr *onedrive.GraphError
+		if errors.As(handler.Err, &graphErr) {
+			payload.GraphErrorCode = graphErr.Code
+			payload.RequestID = graphErr.RequestID
+		}
+	}
+
+	if handler.Result != nil {
+		payload.Item = &OpItem{
+			OneDriveID: handler.Result.ID,
+			Name:       handler.Result.Name,
+			Path:       handler.Result.Path(),
+			ParentID:   handler.Result.ParentReference.ID,
+			Folder:     handler.Result.Folder != nil,
+		}
+	}
+
+	return OpCompletedEvent{
+		EventType: ONEDRIVE_OP_COMPLETED_EVENT_TYPE,
+		Payload:   payload,
+	}
+}
@@ -2,8 +2,10 @@ package processor
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/url"
+	"strconv"
 	"sync"
 	"time"
 
@@ -12,6 +14,7 @@ import (
 	"github.com/jaibhavaya/gogo-files/pkg/db"
 
 	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	transport "github.com/aws/smithy-go/endpoints"
 	"github.com/samber/lo"
 
@@ -28,11 +31,17 @@ type SQSProcessor struct {
 	routerConfig     message.RouterConfig
 	subscriberConfig sqs.SubscriberConfig
 	publisherConfig  sqs.PublisherConfig
-	ctx              context.Context
-	cancel           context.CancelFunc
-	wg               sync.WaitGroup
-	cfg              config.Config
-	dbPool           *db.Pool
+	// ctx is cancelled when Shutdown abandons the messages still being
+	// handled, which wg counts. Once draining is set no new ones are started.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	drainMu  sync.Mutex
+	draining bool
+	// stopped receives the router's result when it stops running.
+	stopped chan error
+	cfg     config.Config
+	dbPool  *db.Pool
 }
 
 func NewSQSProcessor(
@@ -42,33 +51,16 @@ func NewSQSProcessor(
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	sqsOpts := []func(*awssqs.Options){
-		awssqs.WithEndpointResolverV2(sqs.OverrideEndpointResolver{
-			Endpoint: transport.Endpoint{
-				URI: *lo.Must(url.Parse(cfg.QueueURL)),
-			},
-		}),
-	}
-
-	awsCfg, err := awsconfig.LoadDefaultConfig(ctx,
-		awsconfig.WithRegion("us-east-1"),
-	)
+	awsCfg, sqsOpts, err := loadSQSConfig(ctx, cfg)
 	if err != nil {
 		log.Fatalf("Failed to load AWS config: %v", err)
 	}
 
 	subscriberConfig := sqs.SubscriberConfig{
-		AWSConfig: awsCfg,
-		GenerateReceiveMessageInput: func(
-			ctx context.Context, queueURL sqs.QueueURL,
-		) (*awssqs.ReceiveMessageInput, error) {
-			return &awssqs.ReceiveMessageInput{
-				QueueUrl:            aws.String(string(queueURL)),
-				MaxNumberOfMessages: int32(10),
-				WaitTimeSeconds:     int32(20),
-			}, nil
-		},
-		OptFns: sqsOpts,
+		AWSConfig:                   awsCfg,
+		GenerateReceiveMessageInput: receiveMessageInput,
+		Unmarshaler:                 sqsUnmarshaler{},
+		OptFns:                      sqsOpts,
 	}
 
 	publisherConfig := sqs.PublisherConfig{
@@ -88,21 +80,108 @@ func NewSQSProcessor(
 		messageChan:      make(chan *message.Message, 100),
 		ctx:              ctx,
 		cancel:           cancel,
+		stopped:          make(chan error, 1),
 		cfg:              cfg,
 		dbPool:           dbPool,
 	}
 }
 
-func (p *SQSProcessor) Start() error {
-	err := p.setup()
+// receiveMessageInput receives one message at a time. The subscriber hands a
+// batch to the router one message after another, and only the message being
+// handled has its visibility extended, so the rest of a batch would sit
+// invisible behind a long file sync until SQS redelivered them.
+func receiveMessageInput(ctx context.Context, queueURL sqs.QueueURL) (*awssqs.ReceiveMessageInput, error) {
+	return &awssqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(string(queueURL)),
+		MaxNumberOfMessages:   int32(1),
+		WaitTimeSeconds:       int32(20),
+		MessageAttributeNames: []string{"All"},
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+			types.MessageSystemAttributeNameApproximateReceiveCount,
+			types.MessageSystemAttributeNameApproximateFirstReceiveTimestamp,
+		},
+	}, nil
+}
+
+// loadSQSConfig returns the AWS config and client options for talking to the
+// queues at cfg.QueueURL.
+func loadSQSConfig(ctx context.Context, cfg config.Config) (aws.Config, []func(*awssqs.Options), error) {
+	sqsOpts := []func(*awssqs.Options){
+		awssqs.WithEndpointResolverV2(sqs.OverrideEndpointResolver{
+			Endpoint: transport.Endpoint{
+				URI: *lo.Must(url.Parse(cfg.QueueURL)),
+			},
+		}),
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx,
+		awsconfig.WithRegion("us-east-1"),
+	)
 	if err != nil {
-		log.Fatalf("Failed to start Queue Processor: %v", err)
+		return aws.Config{}, nil, err
+	}
+
+	return awsCfg, sqsOpts, nil
+}
+
+// Start sets up the router and runs it in the background, returning once it
+// is consuming messages. Call Shutdown to stop it.
+func (p *SQSProcessor) Start() error {
+	if err := p.setup(); err != nil {
+		return err
 	}
 
 	log.Println("Starting SQS message router...")
-	if err := p.router.Run(p.ctx); err != nil {
-		log.Fatalf("Router error: %v", err)
+	go func() {
+		// not p.ctx: the router is closed by Shutdown, after draining
+		p.stopped <- p.router.Run(context.Background())
+	}()
+
+	select {
+	case <-p.router.Running():
+		return nil
+	case err := <-p.stopped:
+		return fmt.Errorf("router error: %w", err)
+	}
+}
+
+// Stopped receives the router's result once it stops running. Other than
+// through Shutdown, that only happens when every handler has stopped, e.g.
+// because its subscriber failed.
+func (p *SQSProcessor) Stopped() <-chan error {
+	return p.stopped
+}
+
+// sqsUnmarshaler falls back to the SQS message ID as the message UUID when a
+// message wasn't published through watermill, so every message can be
+// identified and correlated with the events it produces. It also records how
+// often and since when the queue has been delivering the message, and the
+// receipt handle of this delivery.
+type sqsUnmarshaler struct {
+	sqs.DefaultMarshalerUnmarshaler
+}
+
+func (u sqsUnmarshaler) Unmarshal(sqsMsg *types.Message) (*message.Message, error) {
+	msg, err := u.DefaultMarshalerUnmarshaler.Unmarshal(sqsMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.UUID == "" && sqsMsg.MessageId != nil {
+		msg.UUID = *sqsMsg.MessageId
+	}
+
+	if sqsMsg.ReceiptHandle != nil {
+		msg.Metadata.Set(RECEIPT_HANDLE_METADATA_KEY, *sqsMsg.ReceiptHandle)
+	}
+
+	attributes := sqsMsg.Attributes
+	if count, ok := attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)]; ok {
+		msg.Metadata.Set(RECEIVE_COUNT_METADATA_KEY, count)
+	}
+	if millis, err := strconv.ParseInt(attributes[string(types.MessageSystemAttributeNameApproximateFirstReceiveTimestamp)], 10, 64); err == nil {
+		msg.Metadata.Set(FIRST_SEEN_METADATA_KEY, time.UnixMilli(millis).UTC().Format(time.RFC3339))
 	}
 
-	return nil
+	return msg, nil
 }
@@ -0,0 +1,140 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-aws/sqs"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQSUnmarshaler_DeliveryMetadata(t *testing.T) {
+	msg, err := sqsUnmarshaler{}.Unmarshal(&types.Message{
+		MessageId:     aws.String("sqs-id"),
+		ReceiptHandle: aws.String("receipt"),
+		Body:          aws.String(`{}`),
+		Attributes: map[string]string{
+			"ApproximateReceiveCount":          "2",
+			"ApproximateFirstReceiveTimestamp": "1747042227000",
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "sqs-id", msg.UUID)
+	assert.Equal(t, "2", msg.Metadata.Get(RECEIVE_COUNT_METADATA_KEY))
+	assert.Equal(t, "2025-05-12T09:30:27Z", msg.Metadata.Get(FIRST_SEEN_METADATA_KEY))
+	assert.Equal(t, "receipt", msg.Metadata.Get(RECEIPT_HANDLE_METADATA_KEY))
+}
+
+// fakeSQSServer speaks enough of the SQS JSON protocol for a subscriber to
+// receive and delete messages. Received messages stay in flight until they
+// are deleted.
+type fakeSQSServer struct {
+	mu       sync.Mutex
+	queued   []string
+	inFlight int
+}
+
+func newFakeSQSServer(t *testing.T, bodies ...string) (*fakeSQSServer, *httptest.Server) {
+	queue := &fakeSQSServer{queued: bodies}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response any
+		switch r.Header.Get("X-Amz-Target") {
+		case "AmazonSQS.GetQueueUrl":
+			response = map[string]string{"QueueUrl": "http://" + r.Host + "/queue"}
+		case "AmazonSQS.ReceiveMessage":
+			var input struct{ MaxNumberOfMessages int }
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+			response = map[string]any{"Messages": queue.receive(input.MaxNumberOfMessages)}
+		case "AmazonSQS.DeleteMessage":
+			response = map[string]any{}
+		default:
+			t.Errorf("unexpected SQS action %q", r.Header.Get("X-Amz-Target"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		assert.NoError(t, json.NewEncoder(w).Encode(response))
+	}))
+	t.Cleanup(server.Close)
+
+	return queue, server
+}
+
+func (q *fakeSQSServer) receive(maxMessages int) []map[string]string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var messages []map[string]string
+	for len(q.queued) > 0 && len(messages) < maxMessages {
+		q.inFlight++
+		id := fmt.Sprintf("message-%d", q.inFlight)
+		messages = append(messages, map[string]string{"MessageId": id, "ReceiptHandle": id, "Body": q.queued[0]})
+		q.queued = q.queued[1:]
+	}
+	if len(messages) == 0 {
+		// stands in for long polling
+		time.Sleep(10 * time.Millisecond)
+	}
+	return messages
+}
+
+// visible returns how many messages other workers could still receive.
+func (q *fakeSQSServer) visible() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queued)
+}
+
+func nextMessage(t *testing.T, messages <-chan *message.Message) *message.Message {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return nil
+	}
+}
+
+func TestSubscriber_LeavesMessagesBehindSlowOneOnQueue(t *testing.T) {
+	queue, server := newFakeSQSServer(t, `{"slow":true}`, `{"slow":false}`)
+
+	subscriber, err := sqs.NewSubscriber(sqs.SubscriberConfig{
+		AWSConfig: aws.Config{Region: "us-east-1", Credentials: aws.AnonymousCredentials{}},
+		OptFns: []func(*awssqs.Options){func(o *awssqs.Options) {
+			o.BaseEndpoint = aws.String(server.URL)
+		}},
+		GenerateReceiveMessageInput: receiveMessageInput,
+		Unmarshaler:                 sqsUnmarshaler{},
+	}, nil)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	messages, err := subscriber.Subscribe(context.Background(), "file-sync")
+	require.NoError(t, err)
+
+	slow := nextMessage(t, messages)
+	assert.JSONEq(t, `{"slow":true}`, string(slow.Payload))
+
+	// only the slow message has its visibility extended while it is handled,
+	// so the one behind it must still be there for another worker
+	assert.Equal(t, 1, queue.visible())
+
+	slow.Ack()
+	next := nextMessage(t, messages)
+	assert.JSONEq(t, `{"slow":false}`, string(next.Payload))
+	next.Ack()
+}
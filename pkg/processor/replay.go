@@ -0,0 +1,282 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-aws/sqs"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jaibhavaya/gogo-files/pkg/config"
+)
+
+// REPLAYED_AT_METADATA_KEY marks a message that was replayed from the dead
+// letter queue, and when.
+const REPLAYED_AT_METADATA_KEY = "replayed_at"
+
+// ReplayFilter selects the dead-lettered messages to replay. Zero fields match
+// every message.
+type ReplayFilter struct {
+	OwnerID    int64
+	EventType  string
+	ErrorClass string
+	// Since and Until bound when the message was first received.
+	Since time.Time
+	Until time.Time
+}
+
+type ReplayOptions struct {
+	Filter ReplayFilter
+	// Set overwrites fields of the message payload before it is replayed.
+	Set    map[string]json.RawMessage
+	DryRun bool
+}
+
+// ReplayResult counts the messages a replay looked at and the ones it moved
+// back to their original topic, or would have in a dry run.
+type ReplayResult struct {
+	Scanned  int
+	Replayed int
+}
+
+// deadLetterQueue is the part of the SQS client a replay needs.
+type deadLetterQueue interface {
+	ReceiveMessage(ctx context.Context, params *awssqs.ReceiveMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *awssqs.DeleteMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *awssqs.ChangeMessageVisibilityInput, optFns ...func(*awssqs.Options)) (*awssqs.ChangeMessageVisibilityOutput, error)
+}
+
+// Replay moves the dead-lettered messages matching opts.Filter back to the
+// topic they were consumed from.
+func Replay(ctx context.Context, cfg config.Config, opts ReplayOptions) (ReplayResult, error) {
+	awsCfg, sqsOpts, err := loadSQSConfig(ctx, cfg)
+	if err != nil {
+		return ReplayResult{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	client := awssqs.NewFromConfig(awsCfg, sqsOpts...)
+	queueURL, err := client.GetQueueUrl(ctx, &awssqs.GetQueueUrlInput{
+		QueueName: aws.String(cfg.DeadLetterQueue),
+	})
+	if err != nil {
+		return ReplayResult{}, fmt.Errorf("failed to get dead letter queue URL: %w", err)
+	}
+
+	publisher, err := sqs.NewPublisher(
+		sqs.PublisherConfig{AWSConfig: awsCfg, OptFns: sqsOpts},
+		watermill.NewStdLogger(false, false),
+	)
+	if err != nil {
+		return ReplayResult{}, fmt.Errorf("failed to create publisher: %w", err)
+	}
+	defer publisher.Close()
+
+	r := replayer{
+		queue:     client,
+		queueURL:  *queueURL.QueueUrl,
+		publisher: publisher,
+	}
+	return r.replay(ctx, opts)
+}
+
+type replayer struct {
+	queue     deadLetterQueue
+	queueURL  string
+	publisher message.Publisher
+	// unmarshaler reads dead letters; sqsUnmarshaler when nil.
+	unmarshaler sqs.Unmarshaler
+}
+
+// replay receives every message on the queue once. Matching messages are
+// republished and deleted; the rest are made visible again when it's done.
+// On a queue that takes longer to scan than the visibility timeout, skipped
+// messages are received again; the scan stops at the first message it has
+// already seen.
+func (r replayer) replay(ctx context.Context, opts ReplayOptions) (ReplayResult, error) {
+	var result ReplayResult
+	var skipped []*string
+	seen := make(map[string]bool)
+
+	defer func() {
+		for _, receiptHandle := range skipped {
+			_, err := r.queue.ChangeMessageVisibility(ctx, &awssqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws.String(r.queueURL),
+				ReceiptHandle:     receiptHandle,
+				VisibilityTimeout: 0,
+			})
+			if err != nil {
+				log.Printf("failed to release skipped dead letter: %v", err)
+			}
+		}
+	}()
+
+	for {
+		out, err := r.queue.ReceiveMessage(ctx, &awssqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(r.queueURL),
+			MaxNumberOfMessages:   10,
+			WaitTimeSeconds:       1,
+			VisibilityTimeout:     300,
+			MessageAttributeNames: []string{"All"},
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to receive dead letters: %w", err)
+		}
+		if len(out.Messages) == 0 {
+			return result, nil
+		}
+
+		wrapped := false
+		for _, sqsMsg := range out.Messages {
+			if id := aws.ToString(sqsMsg.MessageId); id != "" {
+				if seen[id] {
+					wrapped = true
+					skipped = append(skipped, sqsMsg.ReceiptHandle)
+					continue
+				}
+				seen[id] = true
+			}
+			result.Scanned++
+
+			msg, err := r.unmarshal(&sqsMsg)
+			if err != nil {
+				log.Printf("failed to unmarshal dead letter %s, skipping: %v", aws.ToString(sqsMsg.MessageId), err)
+				skipped = append(skipped, sqsMsg.ReceiptHandle)
+				continue
+			}
+
+			if !opts.Filter.matches(msg) {
+				skipped = append(skipped, sqsMsg.ReceiptHandle)
+				continue
+			}
+			if opts.DryRun {
+				result.Replayed++
+				skipped = append(skipped, sqsMsg.ReceiptHandle)
+				continue
+			}
+
+			topic := msg.Metadata.Get(DLQ_ORIGINAL_TOPIC_METADATA_KEY)
+			if topic == "" {
+				log.Printf("dead letter %s has no original topic, skipping", msg.UUID)
+				skipped = append(skipped, sqsMsg.ReceiptHandle)
+				continue
+			}
+
+			replayed, err := replayMessage(msg, opts.Set)
+			if err != nil {
+				log.Printf("failed to rewrite dead letter %s, skipping: %v", msg.UUID, err)
+				skipped = append(skipped, sqsMsg.ReceiptHandle)
+				continue
+			}
+			if err := r.publisher.Publish(topic, replayed); err != nil {
+				return result, fmt.Errorf("failed to replay dead letter %s to %s: %w", msg.UUID, topic, err)
+			}
+
+			_, err = r.queue.DeleteMessage(ctx, &awssqs.DeleteMessageInput{
+				QueueUrl:      aws.String(r.queueURL),
+				ReceiptHandle: sqsMsg.ReceiptHandle,
+			})
+			if err != nil {
+				return result, fmt.Errorf("failed to delete replayed dead letter %s: %w", msg.UUID, err)
+			}
+
+			result.Replayed++
+		}
+
+		if wrapped {
+			return result, nil
+		}
+	}
+}
+
+func (r replayer) unmarshal(sqsMsg *types.Message) (*message.Message, error) {
+	if r.unmarshaler == nil {
+		return sqsUnmarshaler{}.Unmarshal(sqsMsg)
+	}
+	return r.unmarshaler.Unmarshal(sqsMsg)
+}
+
+func (f ReplayFilter) matches(msg *message.Message) bool {
+	if f.ErrorClass != "" && msg.Metadata.Get(DLQ_ERROR_CLASS_METADATA_KEY) != f.ErrorClass {
+		return false
+	}
+
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		firstSeen, err := time.Parse(time.RFC3339, msg.Metadata.Get(DLQ_FIRST_SEEN_METADATA_KEY))
+		if err != nil {
+			return false
+		}
+		if !f.Since.IsZero() && firstSeen.Before(f.Since) {
+			return false
+		}
+		if !f.Until.IsZero() && firstSeen.After(f.Until) {
+			return false
+		}
+	}
+
+	if f.OwnerID == 0 && f.EventType == "" {
+		return true
+	}
+
+	var body struct {
+		EventType string `json:"event_type"`
+		Payload   struct {
+			OwnerID int64 `json:"owner_id"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(msg.Payload, &body); err != nil {
+		return false
+	}
+
+	return (f.OwnerID == 0 || body.Payload.OwnerID == f.OwnerID) &&
+		(f.EventType == "" || body.EventType == f.EventType)
+}
+
+// replayMessage copies a dead letter for its original topic, dropping the
+// dead letter and delivery metadata and overwriting the payload fields in set.
+func replayMessage(msg *message.Message, set map[string]json.RawMessage) (*message.Message, error) {
+	replayed := msg.Copy()
+	for _, key := range []string{
+		DLQ_ORIGINAL_TOPIC_METADATA_KEY,
+		DLQ_ERROR_CLASS_METADATA_KEY,
+		DLQ_ERROR_METADATA_KEY,
+		DLQ_ATTEMPTS_METADATA_KEY,
+		DLQ_FIRST_SEEN_METADATA_KEY,
+		RECEIPT_HANDLE_METADATA_KEY,
+	} {
+		delete(replayed.Metadata, key)
+	}
+	replayed.Metadata.Set(REPLAYED_AT_METADATA_KEY, time.Now().UTC().Format(time.RFC3339))
+
+	if len(set) == 0 {
+		return replayed, nil
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Payload, &body); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body["payload"], &payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	for field, value := range set {
+		payload[field] = value
+	}
+
+	var err error
+	if body["payload"], err = json.Marshal(payload); err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	if replayed.Payload, err = json.Marshal(body); err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	return replayed, nil
+}
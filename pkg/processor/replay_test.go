@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDeadLetterQueue hands out its messages once, like SQS does while they
+// are invisible.
+type fakeDeadLetterQueue struct {
+	messages []types.Message
+	deleted  []string
+	released []string
+	receives int
+}
+
+func (q *fakeDeadLetterQueue) ReceiveMessage(ctx context.Context, params *awssqs.ReceiveMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.ReceiveMessageOutput, error) {
+	q.receives++
+	n := min(int(params.MaxNumberOfMessages), len(q.messages))
+	out := &awssqs.ReceiveMessageOutput{Messages: q.messages[:n]}
+	q.messages = q.messages[n:]
+	return out, nil
+}
+
+func (q *fakeDeadLetterQueue) DeleteMessage(ctx context.Context, params *awssqs.DeleteMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.DeleteMessageOutput, error) {
+	q.deleted = append(q.deleted, *params.ReceiptHandle)
+	return &awssqs.DeleteMessageOutput{}, nil
+}
+
+func (q *fakeDeadLetterQueue) ChangeMessageVisibility(ctx context.Context, params *awssqs.ChangeMessageVisibilityInput, optFns ...func(*awssqs.Options)) (*awssqs.ChangeMessageVisibilityOutput, error) {
+	q.released = append(q.released, *params.ReceiptHandle)
+	return &awssqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func deadLetterSQSMessage(t *testing.T, receiptHandle, body, class, firstSeen string) types.Message {
+	msg := message.NewMessage(receiptHandle, []byte(body))
+	msg.Metadata.Set(DLQ_ORIGINAL_TOPIC_METADATA_KEY, "one-drive-sync")
+	msg.Metadata.Set(DLQ_ERROR_CLASS_METADATA_KEY, class)
+	msg.Metadata.Set(DLQ_FIRST_SEEN_METADATA_KEY, firstSeen)
+
+	sqsMsg, err := sqsUnmarshaler{}.Marshal(msg)
+	assert.NoError(t, err)
+	sqsMsg.MessageId = aws.String(receiptHandle)
+	sqsMsg.ReceiptHandle = aws.String(receiptHandle)
+	return *sqsMsg
+}
+
+func TestReplay(t *testing.T) {
+	queue := &fakeDeadLetterQueue{
+		messages: []types.Message{
+			deadLetterSQSMessage(t, "a", `{"event_type": "file_sync", "payload": {"owner_id": 123}}`, ERROR_CLASS_MISSING_INTEGRATION, "2025-05-12T09:00:00Z"),
+			deadLetterSQSMessage(t, "b", `{"event_type": "file_sync", "payload": {"owner_id": 456}}`, ERROR_CLASS_MISSING_INTEGRATION, "2025-05-12T09:00:00Z"),
+			deadLetterSQSMessage(t, "c", `{"event_type": "move", "payload": {"owner_id": 123}}`, ERROR_CLASS_PERMANENT_GRAPH, "2025-05-12T09:00:00Z"),
+			deadLetterSQSMessage(t, "d", `{"event_type": "file_sync", "payload": {"owner_id": 123}}`, ERROR_CLASS_MISSING_INTEGRATION, "2025-05-10T09:00:00Z"),
+		},
+	}
+	publisher := &recordingPublisher{}
+
+	result, err := replayer{queue: queue, queueURL: "dlq", publisher: publisher}.replay(context.Background(), ReplayOptions{
+		Filter: ReplayFilter{
+			OwnerID:    123,
+			EventType:  FILE_SYNC_MESSAGE_TYPE,
+			ErrorClass: ERROR_CLASS_MISSING_INTEGRATION,
+			Since:      time.Date(2025, 5, 11, 0, 0, 0, 0, time.UTC),
+		},
+		Set: map[string]json.RawMessage{"drive_id": json.RawMessage(`"b!new"`)},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, ReplayResult{Scanned: 4, Replayed: 1}, result)
+	assert.Equal(t, []string{"a"}, queue.deleted)
+	assert.ElementsMatch(t, []string{"b", "c", "d"}, queue.released)
+
+	assert.Equal(t, "one-drive-sync", publisher.topic)
+	assert.Len(t, publisher.messages, 1)
+	replayed := publisher.messages[0]
+	assert.Equal(t, "a", replayed.UUID)
+	assert.JSONEq(t, `{"event_type": "file_sync", "payload": {"owner_id": 123, "drive_id": "b!new"}}`, string(replayed.Payload))
+	assert.NotEmpty(t, replayed.Metadata.Get(REPLAYED_AT_METADATA_KEY))
+	assert.Empty(t, replayed.Metadata.Get(DLQ_ERROR_CLASS_METADATA_KEY))
+}
+
+func TestReplay_DryRun(t *testing.T) {
+	queue := &fakeDeadLetterQueue{
+		messages: []types.Message{
+			deadLetterSQSMessage(t, "a", `{"event_type": "file_sync", "payload": {"owner_id": 123}}`, ERROR_CLASS_PARSE, "2025-05-12T09:00:00Z"),
+		},
+	}
+	publisher := &recordingPublisher{}
+
+	result, err := replayer{queue: queue, queueURL: "dlq", publisher: publisher}.replay(context.Background(), ReplayOptions{DryRun: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, ReplayResult{Scanned: 1, Replayed: 1}, result)
+	assert.Empty(t, publisher.messages)
+	assert.Empty(t, queue.deleted)
+	assert.Equal(t, []string{"a"}, queue.released)
+}
+
+// failingUnmarshaler can't read the dead letters in bad.
+type failingUnmarshaler struct {
+	bad map[string]bool
+}
+
+func (u failingUnmarshaler) Unmarshal(sqsMsg *types.Message) (*message.Message, error) {
+	if u.bad[*sqsMsg.ReceiptHandle] {
+		return nil, errors.New("malformed message attributes")
+	}
+	return sqsUnmarshaler{}.Unmarshal(sqsMsg)
+}
+
+func TestReplay_SkipsUnreadableDeadLetters(t *testing.T) {
+	queue := &fakeDeadLetterQueue{
+		messages: []types.Message{
+			deadLetterSQSMessage(t, "a", `{"event_type": "file_sync", "payload": {"owner_id": 123}}`, ERROR_CLASS_PARSE, "2025-05-12T09:00:00Z"),
+			deadLetterSQSMessage(t, "b", `{"event_type": "file_sync", "payload": {"owner_id": 123}}`, ERROR_CLASS_PARSE, "2025-05-12T09:00:00Z"),
+		},
+	}
+	publisher := &recordingPublisher{}
+
+	result, err := replayer{
+		queue:       queue,
+		queueURL:    "dlq",
+		publisher:   publisher,
+		unmarshaler: failingUnmarshaler{bad: map[string]bool{"a": true}},
+	}.replay(context.Background(), ReplayOptions{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, ReplayResult{Scanned: 2, Replayed: 1}, result)
+	assert.Equal(t, []string{"b"}, queue.deleted)
+	assert.Equal(t, []string{"a"}, queue.released)
+}
+
+func TestReplay_StopsAtMessageSeenBefore(t *testing.T) {
+	skipped := deadLetterSQSMessage(t, "a", `{"event_type": "file_sync", "payload": {"owner_id": 456}}`, ERROR_CLASS_PARSE, "2025-05-12T09:00:00Z")
+	// a's visibility ran out while the queue was being scanned
+	again := skipped
+	again.ReceiptHandle = aws.String("a-again")
+
+	queue := &fakeDeadLetterQueue{
+		messages: []types.Message{
+			skipped,
+			deadLetterSQSMessage(t, "b", `{"event_type": "file_sync", "payload": {"owner_id": 123}}`, ERROR_CLASS_PARSE, "2025-05-12T09:00:00Z"),
+			again,
+			deadLetterSQSMessage(t, "c", `{"event_type": "file_sync", "payload": {"owner_id": 123}}`, ERROR_CLASS_PARSE, "2025-05-12T09:00:00Z"),
+		},
+	}
+	publisher := &recordingPublisher{}
+
+	result, err := replayer{queue: queue, queueURL: "dlq", publisher: publisher}.replay(context.Background(), ReplayOptions{
+		Filter: ReplayFilter{OwnerID: 123},
+		DryRun: true,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, ReplayResult{Scanned: 3, Replayed: 2}, result)
+	assert.Equal(t, 1, queue.receives)
+	assert.ElementsMatch(t, []string{"a", "b", "a-again", "c"}, queue.released)
+}
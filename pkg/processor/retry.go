@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/jaibhavaya/gogo-files/pkg/onedrive"
+)
+
+// retry retries a failed handler with jittered exponential backoff, like
+// watermill's Retry middleware, but only retries transient errors: anything
+// errorClass considers permanent is returned straight away, and a throttled
+// Graph error waits at least as long as Graph asked. If Graph asks for longer
+// than maxInterval the error is returned too, leaving the message to be
+// redelivered by the queue.
+type retry struct {
+	maxRetries      int
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	logger          watermill.LoggerAdapter
+}
+
+func (r retry) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		for attempt := 0; ; attempt++ {
+			msgs, err := h(msg)
+			if err == nil || errorClass(err) != ERROR_CLASS_TRANSIENT || attempt >= r.maxRetries {
+				return msgs, err
+			}
+
+			retryAfter := onedrive.RetryAfter(err)
+			if retryAfter > r.maxInterval {
+				return msgs, err
+			}
+
+			delay := r.delay(attempt, retryAfter)
+			r.logger.Error("Error occurred, retrying", err, watermill.LogFields{
+				"retry_no":     attempt + 1,
+				"max_retries":  r.maxRetries,
+				"wait_time":    delay,
+				"message_uuid": msg.UUID,
+			})
+
+			select {
+			case <-time.After(delay):
+			case <-msg.Context().Done():
+				return msgs, err
+			}
+		}
+	}
+}
+
+// delay returns how long to wait before retry number attempt+1.
+func (r retry) delay(attempt int, retryAfter time.Duration) time.Duration {
+	backoff := r.initialInterval << attempt
+	if backoff > r.maxInterval || backoff <= 0 {
+		backoff = r.maxInterval
+	}
+
+	delay := backoff/2 + rand.N(backoff/2+1)
+	return max(delay, retryAfter)
+}
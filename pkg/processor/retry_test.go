@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/jaibhavaya/gogo-files/pkg/onedrive"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"transient graph error", &onedrive.GraphError{StatusCode: http.StatusServiceUnavailable}, 3},
+		{"other error", errors.New("database is unavailable"), 3},
+		{"permanent graph error", &onedrive.GraphError{StatusCode: http.StatusNotFound}, 1},
+		{"parse failure", fmt.Errorf("%w: bad json", errParseMessage), 1},
+		{"throttled for longer than max interval", &onedrive.GraphError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			handler := retry{
+				maxRetries:  2,
+				maxInterval: time.Millisecond,
+				logger:      watermill.NopLogger{},
+			}.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+				calls++
+				return nil, tt.err
+			})
+
+			_, err := handler(message.NewMessage("1", nil))
+
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.expected, calls)
+		})
+	}
+}
+
+func TestRetryDelay_HonoursRetryAfter(t *testing.T) {
+	r := retry{initialInterval: time.Second, maxInterval: time.Minute}
+
+	assert.Equal(t, 30*time.Second, r.delay(0, 30*time.Second))
+
+	delay := r.delay(2, 0)
+	assert.GreaterOrEqual(t, delay, 2*time.Second)
+	assert.LessOrEqual(t, delay, 4*time.Second)
+}
@@ -1,14 +1,15 @@
 package processor
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
 
-	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill-aws/sqs"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/jaibhavaya/gogo-files/pkg/file"
 	"github.com/jaibhavaya/gogo-files/pkg/onedrive"
 )
@@ -19,7 +20,9 @@ func (p *SQSProcessor) setup() error {
 		return fmt.Errorf("failed to start Queue Processor: %v", err)
 	}
 
-	p.addMiddleware()
+	if err := p.addMiddleware(); err != nil {
+		return fmt.Errorf("failed to start Queue Processor: %w", err)
+	}
 	p.addAuthHandler()
 	p.addSyncHandler()
 	p.addOpsHandler()
@@ -36,17 +39,44 @@ func (p *SQSProcessor) createRouter() error {
 	return nil
 }
 
-func (p *SQSProcessor) addMiddleware() {
+func (p *SQSProcessor) addMiddleware() error {
+	deadLetterPublisher, err := sqs.NewPublisher(p.publisherConfig, p.logger)
+	if err != nil {
+		return fmt.Errorf("failed to create dead letter publisher: %w", err)
+	}
+
 	p.router.AddMiddleware(
+		// outermost, so Shutdown can wait for everything below it
+		p.drain,
 		middleware.NewThrottle(10, time.Second).Middleware,
+		// outside Recoverer, so panics are dead-lettered like other errors
+		deadLetter{
+			publisher:    deadLetterPublisher,
+			topic:        p.cfg.DeadLetterQueue,
+			maxReceives:  5,
+			logger:       p.logger,
+			deadLettered: p.failSyncJob,
+		}.Middleware,
+		// inside deadLetter, so messages that keep hitting the ceiling are
+		// dead-lettered
+		(&heartbeat{
+			queue:             awssqs.NewFromConfig(p.subscriberConfig.AWSConfig, p.subscriberConfig.OptFns...),
+			interval:          p.cfg.VisibilityHeartbeatInterval(),
+			visibilityTimeout: p.cfg.VisibilityTimeoutDuration(),
+			ceiling:           p.cfg.MaxProcessingDuration(),
+			logger:            p.logger,
+		}).Middleware,
 		middleware.Recoverer,
-		middleware.Retry{
-			MaxRetries:      3,
-			InitialInterval: time.Second,
-			Logger:          p.logger,
+		retry{
+			maxRetries:      3,
+			initialInterval: time.Second,
+			maxInterval:     time.Minute,
+			logger:          p.logger,
 		}.Middleware,
 		concurrencyLimiter(5),
 	)
+
+	return nil
 }
 
 func (p *SQSProcessor) addSyncHandler() error {
@@ -69,16 +99,12 @@ func (p *SQSProcessor) addSyncHandler() error {
 		func(msg *message.Message) ([]*message.Message, error) {
 			log.Printf("Processing message: %s", msg.UUID)
 
-			// handle initial syncs
-			// p.processMessage(msg)
-
-			notificationMsg := message.NewMessage(
-				watermill.NewUUID(),
-				[]byte("Processing completed successfully"),
-			)
+			statusMsgs, err := p.processMessage(msg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to process sync message: %w", err)
+			}
 
-			// TODO: publish status to publish queue
-			return []*message.Message{notificationMsg}, nil
+			return statusMsgs, nil
 		},
 	)
 
@@ -105,16 +131,12 @@ func (p *SQSProcessor) addOpsHandler() error {
 		func(msg *message.Message) ([]*message.Message, error) {
 			log.Printf("Processing message: %s", msg.UUID)
 
-			// handle file/folder ops
-			// p.processMessage(msg)
-
-			notificationMsg := message.NewMessage(
-				watermill.NewUUID(),
-				[]byte("Processing completed successfully"),
-			)
+			statusMsgs, err := p.processMessage(msg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to process ops message: %w", err)
+			}
 
-			// TODO: publish status to publish queue
-			return []*message.Message{notificationMsg}, nil
+			return statusMsgs, nil
 		},
 	)
 
@@ -134,10 +156,9 @@ func (p *SQSProcessor) addAuthHandler() error {
 		func(msg *message.Message) error {
 			log.Printf("Processing message: %s", msg.UUID)
 
-			err := p.processMessage(msg)
+			_, err := p.processMessage(msg)
 			if err != nil {
-				// Figure out what to do on error here
-				log.Printf("failed to process auth message: %v", err)
+				return fmt.Errorf("failed to process auth message: %w", err)
 			}
 
 			return nil
@@ -162,35 +183,75 @@ func concurrencyLimiter(maxConcurrent int) message.HandlerMiddleware {
 	}
 }
 
-func (p *SQSProcessor) processMessage(msg *message.Message) error {
+// processMessage handles a message and returns any status messages that
+// should be published about it. A message that was already processed is not
+// handled again; the status messages from the first time are returned.
+func (p *SQSProcessor) processMessage(msg *message.Message) ([]*message.Message, error) {
 	defer logEnd(logStart(msg))
 
-	// TODO error handling in terms of what to do with the event
-	// requeue? depends on type of error
-
 	message, err := parseMessage(msg)
 	if err != nil {
-		return fmt.Errorf("error Parsing Message: %v", err)
+		return nil, fmt.Errorf("%w: %w", errParseMessage, err)
 	}
 
-	handler, err := p.handlerForMessage(message)
+	key := idempotencyKey(msg)
+	statusMsgs, processed, err := p.previousResult(msg.Context(), key)
 	if err != nil {
-		return fmt.Errorf("error retrieving handler for message: %v", err)
+		return nil, fmt.Errorf("failed to check whether message was processed: %w", err)
+	}
+	if processed {
+		log.Printf("Message %s was already processed, republishing its result", key)
+		return statusMsgs, nil
 	}
 
-	err = handler.Handle()
+	handler, err := p.handlerForMessage(key, message)
 	if err != nil {
-		return fmt.Errorf("failed to handle message %v", err)
+		return nil, fmt.Errorf("error retrieving handler for message: %w", err)
 	}
 
-	return nil
+	err = handler.Handle(msg.Context())
+	if err != nil {
+		return nil, fmt.Errorf("failed to handle message: %w", err)
+	}
+
+	statusMsgs, err = statusMessages(msg, handler)
+	if err != nil {
+		return nil, err
+	}
+
+	p.recordResult(msg.Context(), key, message.Type(), statusMsgs)
+
+	return statusMsgs, nil
+}
+
+// statusMessages builds the events reporting the outcome of a handled message.
+func statusMessages(msg *message.Message, handler Handler) ([]*message.Message, error) {
+	switch handler := handler.(type) {
+	case *file.SyncHandler:
+		statusMsg, err := newStatusMessage(msg, newFilesSyncedEvent(handler))
+		if err != nil {
+			return nil, err
+		}
+		return []*message.Message{statusMsg}, nil
+
+	case *onedrive.OpsHandler:
+		statusMsg, err := newStatusMessage(msg, newOpCompletedEvent(handler))
+		if err != nil {
+			return nil, err
+		}
+		return []*message.Message{statusMsg}, nil
+	}
+
+	return nil, nil
 }
 
 type Handler interface {
-	Handle() error
+	Handle(ctx context.Context) error
 }
 
-func (p *SQSProcessor) handlerForMessage(msg Message) (Handler, error) {
+// handlerForMessage returns the handler for msg. key identifies the message
+// across redeliveries.
+func (p *SQSProcessor) handlerForMessage(key string, msg Message) (Handler, error) {
 	switch msg := msg.(type) {
 	case *OneDriveAuthorizationMessage:
 		return &onedrive.OneDriveAuthHandler{
@@ -198,19 +259,37 @@ func (p *SQSProcessor) handlerForMessage(msg Message) (Handler, error) {
 			OwnerID:      msg.Payload.OwnerID,
 			UserID:       msg.Payload.UserID,
 			DbPool:       p.dbPool,
+			Config:       p.cfg,
 		}, nil
 
 	case *FileSyncMessage:
-		// TODO part of the SyncHandler fix, need to allow this to take in my records
 		return &file.SyncHandler{
-			OwnerID:     msg.Payload.OwnerID,
-			UserID:      msg.Payload.UserID,
-			Bucket:      "",
-			Destination: "",
-			Config:      p.cfg,
-			DbPool:      p.dbPool,
+			OwnerID:          msg.Payload.OwnerID,
+			UserID:           msg.Payload.UserID,
+			DriveID:          msg.Payload.DriveID,
+			Items:            msg.Payload.fileItems(),
+			Config:           p.cfg,
+			DbPool:           p.dbPool,
+			ConflictBehavior: msg.Payload.ConflictBehavior,
+			JobID:            key,
+		}, nil
+
+	case *OneDriveOpMessage:
+		return &onedrive.OpsHandler{
+			Op:      msg.EventType,
+			OwnerID: msg.Payload.OwnerID,
+			UserID:  msg.Payload.UserID,
+			DriveID: msg.Payload.DriveID,
+			Item: onedrive.ItemRef{
+				ID:   msg.Payload.ItemID,
+				Path: msg.Payload.Path,
+			},
+			DestinationPath: msg.Payload.DestinationPath,
+			Name:            msg.Payload.Name,
+			Config:          p.cfg,
+			DbPool:          p.dbPool,
 		}, nil
 	}
 
-	return nil, fmt.Errorf("unknown Message Type %T", msg)
+	return nil, fmt.Errorf("%w: %T", errUnknownMessageType, msg)
 }
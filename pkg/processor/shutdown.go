@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// abortTimeout is how long messages cancelled by Shutdown get to abort their
+// uploads and return.
+var abortTimeout = 10 * time.Second
+
+var (
+	// errShuttingDown is returned for messages received once Shutdown has
+	// begun, leaving them for the queue to redeliver.
+	errShuttingDown = fmt.Errorf("processor is shutting down: %w", context.Canceled)
+
+	// ErrAbandoned is returned by Shutdown when messages were still being
+	// handled after the router's CloseTimeout and had to be cancelled.
+	ErrAbandoned = errors.New("in-flight messages were cancelled before they finished")
+)
+
+// drain tracks the messages being handled so Shutdown can wait for them, and
+// refuses messages that arrive once it has begun. Each message's context is
+// cancelled if Shutdown gives up waiting for it, which aborts its uploads.
+//
+// It has to be the outermost middleware: watermill's Router.Close cancels
+// message contexts as soon as it is called, so the router is only closed once
+// drain has let the in-flight messages finish.
+func (p *SQSProcessor) drain(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		p.drainMu.Lock()
+		if p.draining {
+			p.drainMu.Unlock()
+			return nil, errShuttingDown
+		}
+		p.wg.Add(1)
+		p.drainMu.Unlock()
+		defer p.wg.Done()
+
+		ctx, cancel := context.WithCancel(msg.Context())
+		defer cancel()
+		stop := context.AfterFunc(p.ctx, cancel)
+		defer stop()
+		msg.SetContext(ctx)
+
+		return h(msg)
+	}
+}
+
+// Shutdown stops the processor. Messages received from now on are left for
+// the queue to redeliver, and those being handled are given the router's
+// CloseTimeout to finish. Any still running after that are cancelled, and
+// Shutdown returns ErrAbandoned once they have returned. The router then
+// closes its subscribers and publishers.
+func (p *SQSProcessor) Shutdown() error {
+	p.drainMu.Lock()
+	p.draining = true
+	p.drainMu.Unlock()
+
+	var errs []error
+
+	log.Printf("Waiting up to %s for in-flight messages to finish...", p.routerConfig.CloseTimeout)
+	if !waitTimeout(&p.wg, p.routerConfig.CloseTimeout) {
+		log.Printf("In-flight messages still running after %s, cancelling them", p.routerConfig.CloseTimeout)
+		p.cancel()
+		errs = append(errs, ErrAbandoned)
+
+		if !waitTimeout(&p.wg, abortTimeout) {
+			log.Printf("Cancelled messages still running after %s, closing anyway", abortTimeout)
+		}
+	}
+	p.cancel()
+
+	if p.router != nil {
+		if err := p.router.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close router: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// waitTimeout waits for wg, returning false if it took longer than timeout.
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
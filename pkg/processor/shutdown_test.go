@@ -0,0 +1,75 @@
+package processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDrainingProcessor(closeTimeout time.Duration) *SQSProcessor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SQSProcessor{
+		ctx:          ctx,
+		cancel:       cancel,
+		routerConfig: message.RouterConfig{CloseTimeout: closeTimeout},
+	}
+}
+
+func TestShutdown_WaitsForInFlightMessages(t *testing.T) {
+	p := newDrainingProcessor(time.Minute)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handled := make(chan error, 1)
+	handler := p.drain(func(msg *message.Message) ([]*message.Message, error) {
+		close(started)
+		<-release
+		return nil, msg.Context().Err()
+	})
+
+	go func() {
+		_, err := handler(message.NewMessage("1", nil))
+		handled <- err
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- p.Shutdown() }()
+
+	// messages arriving while draining are left for the queue
+	assert.Eventually(t, func() bool {
+		_, err := handler(message.NewMessage("2", nil))
+		return err == errShuttingDown
+	}, time.Second, time.Millisecond)
+
+	close(release)
+
+	assert.NoError(t, <-handled)
+	assert.NoError(t, <-shutdown)
+}
+
+func TestShutdown_CancelsAbandonedMessages(t *testing.T) {
+	p := newDrainingProcessor(10 * time.Millisecond)
+
+	started := make(chan struct{})
+	handled := make(chan error, 1)
+	handler := p.drain(func(msg *message.Message) ([]*message.Message, error) {
+		close(started)
+		<-msg.Context().Done()
+		return nil, msg.Context().Err()
+	})
+
+	go func() {
+		_, err := handler(message.NewMessage("1", nil))
+		handled <- err
+	}()
+	<-started
+
+	err := p.Shutdown()
+
+	assert.ErrorIs(t, err, ErrAbandoned)
+	assert.ErrorIs(t, <-handled, context.Canceled)
+}
@@ -1,32 +1,154 @@
 package processor
 
-// {
-//   "event_type": "files_synced",
-//   "payload": {
-//     "firm_id": 123,
-//     "user_id": 456,
-//     "timestamp": "2025-03-24T13:05:23Z",
-//     "items": [
-//       {
-//         "type": "file",
-//         "id": "01ABCDEF1234567890",
-//         "name": "Contract.docx",
-//         "path": "/Documents/Contracts/Contract.docx",
-//         "size": 245789,
-//         "last_modified": "2025-03-23T10:15:30Z",
-//         "s3_key": "firms/123/users/456/Documents/Contracts/Contract.docx",
-//         "onedrive_id": "01ABCDEF1234567890"
-//       },
-//       {
-//         "type": "file",
-//         "id": "01GHIJKL9876543210",
-//         "name": "Agreement.pdf",
-//         "path": "/Documents/Agreements/Agreement.pdf",
-//         "size": 1245678,
-//         "last_modified": "2025-03-22T14:30:45Z",
-//         "s3_key": "firms/123/users/456/Documents/Agreements/Agreement.pdf",
-//         "onedrive_id": "01GHIJKL9876543210"
-//       }
-//     ]
-//   }
-// }
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/jaibhavaya/gogo-files/pkg/db"
+	"github.com/jaibhavaya/gogo-files/pkg/file"
+)
+
+const FILES_SYNCED_EVENT_TYPE = "files_synced"
+
+// FilesSyncedEvent is published to the status topic once every item of a
+// file_sync message has been processed. job_id identifies the sync job that
+// tracked its progress:
+//
+//	{
+//	  "event_type": "files_synced",
+//	  "payload": {
+//	    "owner_id": 123,
+//	    "user_id": "456",
+//	    "job_id": "3f2c9a4e-8d1b-4c6a-9e0f-5b7d2a1c8e34",
+//	    "timestamp": "2025-03-24T13:05:23Z",
+//	    "items": [
+//	      {
+//	        "type": "file",
+//	        "id": "789",
+//	        "name": "Contract.docx",
+//	        "path": "/Documents/Contracts/Contract.docx",
+//	        "size": 245789,
+//	        "last_modified": "2025-03-23T10:15:30Z",
+//	        "s3_key": "owners/123/users/456/Documents/Contracts/Contract.docx",
+//	        "onedrive_id": "01ABCDEF1234567890",
+//	        "status": "synced",
+//	        "conflict_outcome": "replaced"
+//	      },
+//	      {
+//	        "type": "file",
+//	        "id": "790",
+//	        "name": "Agreement.pdf",
+//	        "path": "/Documents/Agreements/Agreement.pdf",
+//	        "size": 0,
+//	        "s3_key": "owners/123/users/456/Documents/Agreements/Agreement.pdf",
+//	        "status": "failed",
+//	        "error_code": "s3_read_failed",
+//	        "error": "couldn't get object: NoSuchKey"
+//	      }
+//	    ]
+//	  }
+//	}
+type FilesSyncedEvent struct {
+	EventType string             `json:"event_type"`
+	Payload   FilesSyncedPayload `json:"payload"`
+}
+
+type FilesSyncedPayload struct {
+	OwnerID   int64            `json:"owner_id"`
+	UserID    string           `json:"user_id"`
+	JobID     string           `json:"job_id,omitempty"`
+	Timestamp time.Time        `json:"timestamp"`
+	Items     []SyncedFileItem `json:"items"`
+}
+
+type SyncedFileItem struct {
+	Type           string     `json:"type"`
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	Path           string     `json:"path"`
+	Size           int64      `json:"size"`
+	LastModified   *time.Time `json:"last_modified,omitempty"`
+	S3Key          string     `json:"s3_key"`
+	OneDriveID     string     `json:"onedrive_id,omitempty"`
+	Status         string     `json:"status"`
+	ErrorCode      string     `json:"error_code,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	GraphErrorCode string     `json:"graph_error_code,omitempty"`
+	RequestID      string     `json:"request_id,omitempty"`
+	// ConflictOutcome is replaced, renamed, kept_existing or rejected when
+	// the destination was taken by an item the last sync didn't upload.
+	ConflictOutcome string `json:"conflict_outcome,omitempty"`
+}
+
+func newFilesSyncedEvent(handler *file.SyncHandler) FilesSyncedEvent {
+	items := make([]SyncedFileItem, len(handler.Results))
+	for i, result := range handler.Results {
+		items[i] = SyncedFileItem{
+			Type:            "file",
+			ID:              result.ItemID,
+			Name:            result.Name,
+			Path:            result.Path,
+			Size:            result.Size,
+			S3Key:           result.S3Key,
+			OneDriveID:      result.OneDriveID,
+			Status:          result.Status,
+			ErrorCode:       result.ErrorCode,
+			Error:           result.Error,
+			GraphErrorCode:  result.GraphErrorCode,
+			RequestID:       result.RequestID,
+			ConflictOutcome: result.ConflictOutcome,
+		}
+		if !result.LastModified.IsZero() {
+			items[i].LastModified = &result.LastModified
+		}
+	}
+
+	return FilesSyncedEvent{
+		EventType: FILES_SYNCED_EVENT_TYPE,
+		Payload: FilesSyncedPayload{
+			OwnerID:   handler.OwnerID,
+			UserID:    handler.UserID,
+			JobID:     handler.JobID,
+			Timestamp: time.Now().UTC(),
+			Items:     items,
+		},
+	}
+}
+
+// failSyncJob marks the sync job of a dead-lettered message as failed. Only
+// file_sync messages have one, so nothing changes for other messages.
+func (p *SQSProcessor) failSyncJob(msg *message.Message, err error) {
+	key := idempotencyKey(msg)
+	dbErr := db.FinishSyncJob(context.WithoutCancel(msg.Context()), p.dbPool, key, db.SyncJobFailed, err.Error())
+	if dbErr != nil {
+		log.Printf("failed to mark sync job %s as failed: %v", key, dbErr)
+	}
+}
+
+// newStatusMessage wraps an outgoing event in a message correlated with the
+// inbound message that caused it.
+func newStatusMessage(inbound *message.Message, event any) (*message.Message, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal status event: %w", err)
+	}
+
+	outbound := message.NewMessage(watermill.NewUUID(), payload)
+
+	correlationID := middleware.MessageCorrelationID(inbound)
+	if correlationID == "" {
+		correlationID = inbound.UUID
+	}
+	middleware.SetCorrelationID(correlationID, outbound)
+	outbound.Metadata.Set(CAUSATION_ID_METADATA_KEY, inbound.UUID)
+
+	return outbound, nil
+}
+
+const CAUSATION_ID_METADATA_KEY = "causation_id"
@@ -0,0 +1,105 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/jaibhavaya/gogo-files/pkg/file"
+	"github.com/jaibhavaya/gogo-files/pkg/onedrive"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFilesSyncedEvent(t *testing.T) {
+	lastModified := time.Date(2025, 3, 23, 10, 15, 30, 0, time.UTC)
+	handler := &file.SyncHandler{
+		OwnerID: 123,
+		UserID:  "456",
+		Results: []file.FileResult{
+			{
+				ItemID:          "1",
+				Name:            "Contract.docx",
+				Path:            "/Documents/Contract.docx",
+				S3Key:           "owners/123/Contract.docx",
+				Size:            245789,
+				LastModified:    lastModified,
+				OneDriveID:      "01ABC",
+				Status:          file.StatusSynced,
+				ConflictOutcome: file.ConflictOutcomeReplaced,
+			},
+			{
+				ItemID:    "2",
+				Name:      "Agreement.pdf",
+				Path:      "/Documents/Agreement.pdf",
+				S3Key:     "owners/123/Agreement.pdf",
+				Status:    file.StatusFailed,
+				ErrorCode: file.ErrorCodeS3Read,
+				Error:     "couldn't get object",
+			},
+		},
+	}
+
+	event := newFilesSyncedEvent(handler)
+
+	assert.Equal(t, FILES_SYNCED_EVENT_TYPE, event.EventType)
+	assert.Equal(t, int64(123), event.Payload.OwnerID)
+	assert.Len(t, event.Payload.Items, 2)
+	assert.Equal(t, "01ABC", event.Payload.Items[0].OneDriveID)
+	assert.Equal(t, &lastModified, event.Payload.Items[0].LastModified)
+	assert.Equal(t, file.ConflictOutcomeReplaced, event.Payload.Items[0].ConflictOutcome)
+	assert.Equal(t, file.StatusFailed, event.Payload.Items[1].Status)
+	assert.Equal(t, file.ErrorCodeS3Read, event.Payload.Items[1].ErrorCode)
+	assert.Nil(t, event.Payload.Items[1].LastModified)
+}
+
+func TestNewFilesSyncedEvent_JobID(t *testing.T) {
+	event := newFilesSyncedEvent(&file.SyncHandler{JobID: "job"})
+	assert.Equal(t, "job", event.Payload.JobID)
+
+	payload, err := json.Marshal(newFilesSyncedEvent(&file.SyncHandler{}))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(payload), "job_id")
+}
+
+func TestNewStatusMessage_Correlation(t *testing.T) {
+	inbound := message.NewMessage("inbound-uuid", []byte(`{}`))
+
+	outbound, err := newStatusMessage(inbound, map[string]string{"event_type": "test"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "inbound-uuid", middleware.MessageCorrelationID(outbound))
+	assert.Equal(t, "inbound-uuid", outbound.Metadata.Get(CAUSATION_ID_METADATA_KEY))
+
+	var event map[string]string
+	assert.NoError(t, json.Unmarshal(outbound.Payload, &event))
+	assert.Equal(t, "test", event["event_type"])
+
+	middleware.SetCorrelationID("upstream-correlation", inbound)
+	outbound, err = newStatusMessage(inbound, map[string]string{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "upstream-correlation", middleware.MessageCorrelationID(outbound))
+	assert.Equal(t, "inbound-uuid", outbound.Metadata.Get(CAUSATION_ID_METADATA_KEY))
+}
+
+func TestNewOpCompletedEvent_GraphError(t *testing.T) {
+	handler := &onedrive.OpsHandler{
+		Op:      onedrive.OpDelete,
+		OwnerID: 123,
+		Err: fmt.Errorf("delete failed: %w", &onedrive.GraphError{
+			StatusCode: http.StatusForbidden,
+			Code:       "accessDenied",
+			RequestID:  "req-1",
+		}),
+	}
+
+	event := newOpCompletedEvent(handler)
+
+	assert.Equal(t, OP_STATUS_FAILED, event.Payload.Status)
+	assert.Equal(t, "accessDenied", event.Payload.GraphErrorCode)
+	assert.Equal(t, "req-1", event.Payload.RequestID)
+}